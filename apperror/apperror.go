@@ -0,0 +1,119 @@
+package apperror
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/lib/pq"
+	"net/http"
+)
+
+type Code string
+
+const (
+	CodeBadRequest      Code = "bad_request"
+	CodeValidation      Code = "validation_failed"
+	CodeUnauthorized    Code = "unauthorized"
+	CodeForbidden       Code = "forbidden"
+	CodeNotFound        Code = "not_found"
+	CodeConflict        Code = "conflict"
+	CodeTooManyRequests Code = "too_many_requests"
+	CodeUnavailable     Code = "unavailable"
+	CodeInternal        Code = "internal"
+)
+
+// statusByCode is the one place an error code is turned into an http status
+var statusByCode = map[Code]int{
+	CodeBadRequest:      http.StatusBadRequest,
+	CodeValidation:      http.StatusUnprocessableEntity,
+	CodeUnauthorized:    http.StatusUnauthorized,
+	CodeForbidden:       http.StatusForbidden,
+	CodeNotFound:        http.StatusNotFound,
+	CodeConflict:        http.StatusConflict,
+	CodeTooManyRequests: http.StatusTooManyRequests,
+	CodeUnavailable:     http.StatusServiceUnavailable,
+	CodeInternal:        http.StatusInternalServerError,
+}
+
+// postgres error codes, https://www.postgresql.org/docs/current/errcodes-appendix.html
+const (
+	pqUniqueViolation     = "23505"
+	pqForeignKeyViolation = "23503"
+	pqCheckViolation      = "23514"
+	pqNotNullViolation    = "23502"
+	pqInvalidTextValue    = "22P02"
+)
+
+// Error is the typed error of the domain layer. Message and Details are safe to show to the client, Err is the
+// underlying cause and is only logged.
+type Error struct {
+	Code    Code
+	Message string
+	Details interface{}
+	Err     error
+}
+
+func New(code Code, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+func Wrap(err error, code Code, message string) *Error {
+	return &Error{Code: code, Message: message, Err: err}
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// WithDetails returns a copy of e carrying details, sentinel errors stay untouched
+func (e *Error) WithDetails(details interface{}) *Error {
+	copied := *e
+	copied.Details = details
+	return &copied
+}
+
+func (e *Error) Status() int {
+	if status, ok := statusByCode[e.Code]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// From maps any error returned by helper, provider or the database driver to an *Error
+func From(err error) *Error {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return appErr
+	}
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return Wrap(err, CodeNotFound, "resource not found")
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code {
+		case pqUniqueViolation:
+			return Wrap(err, CodeConflict, "resource already exists")
+		case pqForeignKeyViolation:
+			return Wrap(err, CodeValidation, "referenced resource does not exist")
+		case pqCheckViolation, pqNotNullViolation:
+			return Wrap(err, CodeValidation, "request violates a data constraint")
+		case pqInvalidTextValue:
+			return Wrap(err, CodeBadRequest, "invalid value in request")
+		}
+	}
+
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return Wrap(err, CodeUnavailable, "request timed out")
+	}
+
+	return Wrap(err, CodeInternal, "internal server error")
+}
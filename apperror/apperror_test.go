@@ -0,0 +1,81 @@
+package apperror
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"net/http"
+	"testing"
+)
+
+func TestStatus(t *testing.T) {
+	tests := []struct {
+		code Code
+		want int
+	}{
+		{CodeBadRequest, http.StatusBadRequest},
+		{CodeValidation, http.StatusUnprocessableEntity},
+		{CodeUnauthorized, http.StatusUnauthorized},
+		{CodeForbidden, http.StatusForbidden},
+		{CodeNotFound, http.StatusNotFound},
+		{CodeConflict, http.StatusConflict},
+		{CodeTooManyRequests, http.StatusTooManyRequests},
+		{CodeUnavailable, http.StatusServiceUnavailable},
+		{CodeInternal, http.StatusInternalServerError},
+		{Code("unknown"), http.StatusInternalServerError},
+	}
+	for _, test := range tests {
+		if got := New(test.code, "message").Status(); got != test.want {
+			t.Errorf("status of %s = %d, want %d", test.code, got, test.want)
+		}
+	}
+}
+
+func TestFrom(t *testing.T) {
+	sentinel := New(CodeForbidden, "not allowed")
+
+	tests := []struct {
+		name string
+		err  error
+		want Code
+	}{
+		{"apperror", sentinel, CodeForbidden},
+		{"wrapped apperror", fmt.Errorf("context: %w", sentinel), CodeForbidden},
+		{"no rows", sql.ErrNoRows, CodeNotFound},
+		{"wrapped no rows", fmt.Errorf("get: %w", sql.ErrNoRows), CodeNotFound},
+		{"unique violation", &pq.Error{Code: pqUniqueViolation}, CodeConflict},
+		{"foreign key violation", &pq.Error{Code: pqForeignKeyViolation}, CodeValidation},
+		{"check violation", &pq.Error{Code: pqCheckViolation}, CodeValidation},
+		{"not null violation", &pq.Error{Code: pqNotNullViolation}, CodeValidation},
+		{"invalid text value", &pq.Error{Code: pqInvalidTextValue}, CodeBadRequest},
+		{"other postgres error", &pq.Error{Code: "40001"}, CodeInternal},
+		{"cancelled", context.Canceled, CodeUnavailable},
+		{"deadline", fmt.Errorf("query: %w", context.DeadlineExceeded), CodeUnavailable},
+		{"anything else", errors.New("boom"), CodeInternal},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := From(test.err)
+			if got.Code != test.want {
+				t.Errorf("From(%v).Code = %s, want %s", test.err, got.Code, test.want)
+			}
+			if !errors.Is(got, test.err) && got != sentinel {
+				t.Errorf("From(%v) lost the cause", test.err)
+			}
+		})
+	}
+}
+
+func TestWithDetails(t *testing.T) {
+	sentinel := New(CodeValidation, "invalid")
+	detailed := sentinel.WithDetails(map[string]string{"email": "required"})
+
+	if sentinel.Details != nil {
+		t.Error("WithDetails changed the sentinel")
+	}
+	if detailed.Details == nil || detailed.Code != sentinel.Code || detailed.Message != sentinel.Message {
+		t.Errorf("WithDetails = %+v, want the sentinel with details", detailed)
+	}
+}
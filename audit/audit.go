@@ -0,0 +1,136 @@
+package audit
+
+import (
+	"encoding/json"
+	"firebaseAuth/utilities"
+	"github.com/jmoiron/sqlx/types"
+	"net/http"
+	"reflect"
+	"time"
+)
+
+// Event names what happened, it is stored as is in audit_log.event
+type Event string
+
+const (
+	EventRegister               Event = "register"
+	EventLoginSucceeded         Event = "login.succeeded"
+	EventLoginFailed            Event = "login.failed"
+	EventLogout                 Event = "logout"
+	EventProfileUpdated         Event = "profile.updated"
+	EventEmailChanged           Event = "email.changed"
+	EventPasswordChanged        Event = "password.changed"
+	EventPasswordReset          Event = "password.reset"
+	EventMFAEnabled             Event = "mfa.enabled"
+	EventMFADisabled            Event = "mfa.disabled"
+	EventAccountDeactivated     Event = "account.deactivated"
+	EventAccountReactivated     Event = "account.reactivated"
+	EventAccountPurged          Event = "account.purged"
+	EventAccountExported        Event = "account.exported"
+	EventAccountErased          Event = "account.erased"
+	EventFriendRequestSent      Event = "friend_request.sent"
+	EventFriendRequestAccepted  Event = "friend_request.accepted"
+	EventFriendRequestRejected  Event = "friend_request.rejected"
+	EventAdminAuditViewed       Event = "admin.audit_viewed"
+	EventAdminLockoutCleared    Event = "admin.lockout_cleared"
+	EventAdminRoleChanged       Event = "admin.role_changed"
+	EventAdminUserDisabled      Event = "admin.user_disabled"
+	EventAdminUserEnabled       Event = "admin.user_enabled"
+	EventAdminSessionsRevoked   Event = "admin.sessions_revoked"
+	EventAdminPasswordResetSent Event = "admin.password_reset_sent"
+	EventAdminUserErased        Event = "admin.user_erased"
+)
+
+// Entry is one row of the audit trail. ActorID is the user who did it and TargetID the user it was done to, nil
+// when there is none, e.g. no actor for a failed login or an admin command run from the shell.
+type Entry struct {
+	ID        int64          `json:"id" db:"id"`
+	CreatedAt time.Time      `json:"createdAt" db:"created_at"`
+	Event     Event          `json:"event" db:"event"`
+	ActorID   *int           `json:"actorId" db:"actor_id"`
+	TargetID  *int           `json:"targetId" db:"target_id"`
+	IP        string         `json:"ip" db:"ip"`
+	UserAgent string         `json:"userAgent" db:"user_agent"`
+	Changes   types.JSONText `json:"changes" db:"changes"`
+}
+
+// Filter narrows Query down, zero values do not filter
+type Filter struct {
+	From     time.Time
+	To       time.Time
+	Events   []Event
+	ActorID  int
+	TargetID int
+	Limit    int
+	Page     int
+}
+
+// Change is the before and after of one field in a diff
+type Change struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// NewEntry describes event for the client of r. actorID and targetID 0 mean none, changes is stored as json.
+func NewEntry(r *http.Request, event Event, actorID, targetID int, changes interface{}) (Entry, error) {
+	entry := Entry{
+		Event:    event,
+		ActorID:  userID(actorID),
+		TargetID: userID(targetID),
+	}
+	if r != nil {
+		entry.IP = utilities.ClientIP(r)
+		entry.UserAgent = r.UserAgent()
+	}
+	if changes == nil {
+		changes = struct{}{}
+	}
+	content, err := json.Marshal(changes)
+	if err != nil {
+		return entry, err
+	}
+	entry.Changes = content
+	return entry, nil
+}
+
+// Diff compares the json forms of before and after and returns the fields that differ, keyed by their json name.
+// Fields tagged json:"-" are never part of it.
+func Diff(before, after interface{}) (map[string]Change, error) {
+	beforeFields, err := jsonFields(before)
+	if err != nil {
+		return nil, err
+	}
+	afterFields, err := jsonFields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := make(map[string]Change)
+	for name, from := range beforeFields {
+		if to := afterFields[name]; !reflect.DeepEqual(from, to) {
+			diff[name] = Change{From: from, To: to}
+		}
+	}
+	for name, to := range afterFields {
+		if _, ok := beforeFields[name]; !ok {
+			diff[name] = Change{To: to}
+		}
+	}
+	return diff, nil
+}
+
+func jsonFields(value interface{}) (map[string]interface{}, error) {
+	content, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	fields := make(map[string]interface{})
+	return fields, json.Unmarshal(content, &fields)
+}
+
+func userID(id int) *int {
+	if id == 0 {
+		return nil
+	}
+	return &id
+}
@@ -0,0 +1,101 @@
+package audit
+
+import (
+	"context"
+	"firebaseAuth/database"
+	"github.com/lib/pq"
+	"github.com/sirupsen/logrus"
+)
+
+// Recorder appends to and reads the audit_log table. Rows are never updated or deleted, the table refuses both.
+type Recorder struct{}
+
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+func (a *Recorder) Record(ctx context.Context, entry Entry) error {
+	// language=SQL
+	SQL := `INSERT INTO audit_log(event, actor_id, target_id, ip, user_agent, changes)
+            VALUES ($1, $2, $3, $4, $5, $6)`
+
+	// sent as text, lib/pq would encode a []byte as bytea which jsonb does not accept
+	changes := string(entry.Changes)
+	if changes == "" {
+		changes = "{}"
+	}
+
+	_, err := database.FirebaseDB.ExecContext(ctx, SQL, entry.Event, entry.ActorID, entry.TargetID, entry.IP, entry.UserAgent, changes)
+	if err != nil {
+		logrus.Printf("audit Record: cannot record %s:%v", entry.Event, err)
+		return err
+	}
+	return nil
+}
+
+// Query returns the entries matching filter, newest first
+func (a *Recorder) Query(ctx context.Context, filter Filter) ([]Entry, error) {
+	// language=SQL
+	SQL := `SELECT id,
+                   created_at,
+                   event,
+                   actor_id,
+                   target_id,
+                   ip,
+                   user_agent,
+                   changes
+            FROM   audit_log
+            WHERE  ($1::timestamptz IS NULL OR created_at >= $1)
+            AND    ($2::timestamptz IS NULL OR created_at < $2)
+            AND    (cardinality($3::text[]) = 0 OR event = ANY($3))
+            AND    ($4 = 0 OR actor_id = $4)
+            AND    ($5 = 0 OR target_id = $5)
+            ORDER BY created_at DESC, id DESC
+            LIMIT $6 OFFSET $7`
+
+	var from, to interface{}
+	if !filter.From.IsZero() {
+		from = filter.From
+	}
+	if !filter.To.IsZero() {
+		to = filter.To
+	}
+	events := make([]string, 0, len(filter.Events))
+	for _, event := range filter.Events {
+		events = append(events, string(event))
+	}
+
+	entries := make([]Entry, 0)
+	err := database.FirebaseDB.SelectContext(ctx, &entries, SQL, from, to, pq.Array(events), filter.ActorID, filter.TargetID,
+		filter.Limit, filter.Limit*filter.Page)
+	if err != nil {
+		logrus.Printf("audit Query: cannot get audit log:%v", err)
+		return entries, err
+	}
+	return entries, nil
+}
+
+// ForUser returns every entry where userID is the actor or the target, oldest first
+func (a *Recorder) ForUser(ctx context.Context, userID int) ([]Entry, error) {
+	// language=SQL
+	SQL := `SELECT id,
+                   created_at,
+                   event,
+                   actor_id,
+                   target_id,
+                   ip,
+                   user_agent,
+                   changes
+            FROM   audit_log
+            WHERE  actor_id = $1
+            OR     target_id = $1
+            ORDER BY created_at, id`
+
+	entries := make([]Entry, 0)
+	err := database.FirebaseDB.SelectContext(ctx, &entries, SQL, userID)
+	if err != nil {
+		logrus.Printf("audit ForUser: cannot get audit log of %d:%v", userID, err)
+		return entries, err
+	}
+	return entries, nil
+}
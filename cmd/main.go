@@ -1,30 +1,118 @@
 package main
 
 import (
+	"context"
+	"firebaseAuth/audit"
+	"firebaseAuth/config"
 	"firebaseAuth/database"
+	"firebaseAuth/database/helper"
+	"firebaseAuth/jobs"
+	"firebaseAuth/lockout"
+	"firebaseAuth/mailer"
+	"firebaseAuth/provider"
 	"firebaseAuth/server"
 	"fmt"
 	"github.com/sirupsen/logrus"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 )
 
 func main() {
-	host := os.Getenv("host")
-	port := os.Getenv("port")
-	databaseName := os.Getenv("databaseName")
-	user := os.Getenv("user")
-	password := os.Getenv("password")
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		logrus.Fatalf("Load: invalid configuration:%v", err)
+	}
 
-	err := database.ConnectAndMigrate(host, port, databaseName, user, password, database.SSLModeDisable)
+	dbConfig := cfg.Database
+	err = database.ConnectAndMigrate(dbConfig.Host, dbConfig.Port, dbConfig.Name, dbConfig.User, dbConfig.Password, database.SSLMode(dbConfig.SSLMode))
 	if err != nil {
 		logrus.Printf("ConnectAndMigrate: error is:%v", err)
 		return
 	}
+	database.SetPool(dbConfig.MaxOpenConns, dbConfig.MaxIdleConns, dbConfig.ConnMaxLifetime)
 	fmt.Println("connected")
-	srv := server.SetupRoutes()
-	err = srv.Run(":8080")
+
+	promoted, err := helper.BootstrapAdmins(cfg.Admin.Emails)
 	if err != nil {
-		logrus.Printf("could not run the server error:%v", err)
+		logrus.Printf("BootstrapAdmins: cannot promote admins:%v", err)
 		return
 	}
+	if promoted > 0 {
+		logrus.Printf("BootstrapAdmins: promoted %d users to admin", promoted)
+	}
+
+	var identityProvider provider.IdentityProvider
+	var memoryProvider *provider.MemoryProvider
+	if cfg.Identity.Provider == config.IdentityProviderMemory {
+		memoryProvider, err = provider.NewMemory()
+		if err != nil {
+			logrus.Printf("NewMemory: cannot create in-memory auth backend:%v", err)
+			return
+		}
+		identityProvider = memoryProvider
+	} else {
+		identityProvider, err = provider.NewFirebase(context.Background(), cfg.Identity.FirebaseKey)
+		if err != nil {
+			logrus.Printf("NewFirebase: cannot create firebase auth client:%v", err)
+			return
+		}
+	}
+
+	mail, err := mailer.New(cfg.Mail)
+	if err != nil {
+		logrus.Printf("New: cannot create mailer:%v", err)
+		return
+	}
+
+	lockoutStore, err := lockout.NewStore(cfg.Lockout)
+	if err != nil {
+		logrus.Printf("NewStore: cannot create lockout store:%v", err)
+		return
+	}
+	guard := lockout.NewGuard(lockoutStore, cfg.Lockout)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		jobs.ReapSessions(ctx, cfg.Session)
+	}()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		jobs.PurgeLoginAttempts(ctx, guard, cfg.Lockout.Window)
+	}()
+
+	recorder := audit.NewRecorder()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		jobs.PurgeDeactivatedAccounts(ctx, identityProvider, recorder, cfg.Account)
+	}()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		jobs.BuildExports(ctx, recorder, cfg.Export)
+	}()
+
+	srv := server.SetupRoutes(cfg, identityProvider, mail, guard, recorder)
+	if memoryProvider != nil {
+		// same path the Firebase client SDKs call when pointed at an auth emulator
+		srv.Post("/identitytoolkit.googleapis.com/v1/accounts:signInWithCustomToken", memoryProvider.SignInWithCustomTokenHandler)
+	}
+	err = srv.Run(ctx, cfg.Server.ListenAddr)
+	if err != nil {
+		logrus.Printf("could not run the server error:%v", err)
+	}
+
+	stop()
+	wg.Wait()
+	if err := database.ShutdownDatabase(); err != nil {
+		logrus.Printf("ShutdownDatabase: cannot close database:%v", err)
+	}
 }
@@ -0,0 +1,64 @@
+// Command reconcile reports users whose Firebase record no longer matches Postgres and, with -repair, brings
+// Firebase back in line. It takes the same configuration flags, file and environment as the server.
+//
+//	go run ./cmd/reconcile [-repair] [config flags]
+package main
+
+import (
+	"context"
+	"firebaseAuth/config"
+	"firebaseAuth/database"
+	"firebaseAuth/jobs"
+	"firebaseAuth/provider"
+	"github.com/sirupsen/logrus"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+func main() {
+	repair := false
+	configArgs := make([]string, 0, len(os.Args))
+	for _, arg := range os.Args[1:] {
+		if arg == "-repair" || arg == "--repair" {
+			repair = true
+			continue
+		}
+		configArgs = append(configArgs, arg)
+	}
+
+	cfg, err := config.Load(configArgs)
+	if err != nil {
+		logrus.Fatalf("Load: invalid configuration:%v", err)
+	}
+	if cfg.Identity.Provider != config.IdentityProviderFirebase {
+		logrus.Fatalf("reconcile: needs the firebase identity provider, got %q", cfg.Identity.Provider)
+	}
+
+	dbConfig := cfg.Database
+	err = database.ConnectAndMigrate(dbConfig.Host, dbConfig.Port, dbConfig.Name, dbConfig.User, dbConfig.Password, database.SSLMode(dbConfig.SSLMode))
+	if err != nil {
+		logrus.Fatalf("ConnectAndMigrate: error is:%v", err)
+	}
+	defer func() {
+		if err := database.ShutdownDatabase(); err != nil {
+			logrus.Printf("ShutdownDatabase: cannot close database:%v", err)
+		}
+	}()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	identityProvider, err := provider.NewFirebase(ctx, cfg.Identity.FirebaseKey)
+	if err != nil {
+		logrus.Printf("NewFirebase: cannot create firebase auth client:%v", err)
+		return
+	}
+
+	report, err := jobs.ReconcileUsers(ctx, identityProvider, repair)
+	logrus.Printf("reconcile: checked %d, drifted %d, repaired %d, missing %d, failed %d",
+		report.Checked, report.Drifted, report.Repaired, report.Missing, report.Failed)
+	if err != nil {
+		logrus.Printf("reconcile: stopped early:%v", err)
+	}
+}
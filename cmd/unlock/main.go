@@ -0,0 +1,79 @@
+// Command unlock lifts the login lockout of emails, ips or two-factor logins before it runs out. It takes the same
+// configuration flags, file and environment as the server and only works with the postgres lockout store, the
+// memory one lives and dies with the server process. Admins can do the same over http with DELETE /admin/lockouts.
+//
+//	go run ./cmd/unlock [config flags] email:<email>... ip:<ip>... mfa:<user id>...
+package main
+
+import (
+	"context"
+	"firebaseAuth/audit"
+	"firebaseAuth/config"
+	"firebaseAuth/database"
+	"firebaseAuth/lockout"
+	"github.com/sirupsen/logrus"
+	"os"
+	"strconv"
+	"strings"
+)
+
+func main() {
+	keys := make([]string, 0, len(os.Args))
+	configArgs := make([]string, 0, len(os.Args))
+	for _, arg := range os.Args[1:] {
+		switch {
+		case strings.HasPrefix(arg, "email:"):
+			keys = append(keys, lockout.EmailKey(strings.TrimPrefix(arg, "email:")))
+		case strings.HasPrefix(arg, "ip:"):
+			keys = append(keys, lockout.IPKey(strings.TrimPrefix(arg, "ip:")))
+		case strings.HasPrefix(arg, "mfa:"):
+			userID, err := strconv.Atoi(strings.TrimPrefix(arg, "mfa:"))
+			if err != nil {
+				logrus.Fatalf("unlock: %q is not mfa:<user id>", arg)
+			}
+			keys = append(keys, lockout.MFAKey(userID))
+		default:
+			configArgs = append(configArgs, arg)
+		}
+	}
+	if len(keys) == 0 {
+		logrus.Fatalf("unlock: name at least one email:<email>, ip:<ip> or mfa:<user id>")
+	}
+
+	cfg, err := config.Load(configArgs)
+	if err != nil {
+		logrus.Fatalf("Load: invalid configuration:%v", err)
+	}
+	if cfg.Lockout.Store != config.LockoutStorePostgres {
+		logrus.Fatalf("unlock: needs the postgres lockout store, got %q", cfg.Lockout.Store)
+	}
+
+	dbConfig := cfg.Database
+	err = database.ConnectAndMigrate(dbConfig.Host, dbConfig.Port, dbConfig.Name, dbConfig.User, dbConfig.Password, database.SSLMode(dbConfig.SSLMode))
+	if err != nil {
+		logrus.Fatalf("ConnectAndMigrate: error is:%v", err)
+	}
+	defer func() {
+		if err := database.ShutdownDatabase(); err != nil {
+			logrus.Printf("ShutdownDatabase: cannot close database:%v", err)
+		}
+	}()
+
+	guard := lockout.NewGuard(lockout.NewPostgres(), cfg.Lockout)
+	recorder := audit.NewRecorder()
+	for _, key := range keys {
+		if err := guard.Clear(context.Background(), key); err != nil {
+			logrus.Printf("unlock: cannot clear %s:%v", key, err)
+			continue
+		}
+		logrus.Printf("unlock: cleared %s", key)
+
+		entry, err := audit.NewEntry(nil, audit.EventAdminLockoutCleared, 0, 0, map[string]string{"key": key, "via": "cmd/unlock"})
+		if err == nil {
+			err = recorder.Record(context.Background(), entry)
+		}
+		if err != nil {
+			logrus.Printf("unlock: cannot record the unlock of %s:%v", key, err)
+		}
+	}
+}
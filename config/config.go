@@ -0,0 +1,632 @@
+package config
+
+import (
+	"errors"
+	"firebaseAuth/secrets"
+	"flag"
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	IdentityProviderFirebase = "firebase"
+	IdentityProviderMemory   = "memory"
+
+	MailDriverSMTP = "smtp"
+	MailDriverLog  = "log"
+
+	// VerificationPolicyOff lets unverified users do everything, VerificationPolicyRestrict keeps them out of the
+	// social routes until they verify and VerificationPolicyBlockLogin does not let them log in at all
+	VerificationPolicyOff        = "off"
+	VerificationPolicyRestrict   = "restrict"
+	VerificationPolicyBlockLogin = "block_login"
+
+	LockoutStorePostgres = "postgres"
+	LockoutStoreMemory   = "memory"
+)
+
+// Config is loaded once at startup. Values are applied in this order, later ones win:
+// defaults, the config file (yaml or json), environment variables, command-line flags.
+type Config struct {
+	Server       Server       `yaml:"server"`
+	Database     Database     `yaml:"database"`
+	Identity     Identity     `yaml:"identity"`
+	Session      Session      `yaml:"session"`
+	Pagination   Pagination   `yaml:"pagination"`
+	Friends      Friends      `yaml:"friends"`
+	Mail         Mail         `yaml:"mail"`
+	Password     Password     `yaml:"password"`
+	Verification Verification `yaml:"verification"`
+	MFA          MFA          `yaml:"mfa"`
+	Lockout      Lockout      `yaml:"lockout"`
+	RateLimit    RateLimit    `yaml:"rate_limit"`
+	Admin        Admin        `yaml:"admin"`
+	Account      Account      `yaml:"account"`
+	Export       Export       `yaml:"export"`
+}
+
+// Server.TrustedProxies lists the CIDRs, or single ips, of the load balancers in front of the server. Only a request
+// coming from one of them has its client ip taken from X-Forwarded-For, any other peer is the client itself.
+type Server struct {
+	ListenAddr     string   `yaml:"listen_addr"`
+	TrustedProxies []string `yaml:"trusted_proxies"`
+}
+
+// TrustedProxyNets parses TrustedProxies, a single ip is a network of its own
+func (s Server) TrustedProxyNets() ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(s.TrustedProxies))
+	for _, proxy := range s.TrustedProxies {
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return nil, fmt.Errorf("%q is not an ip or CIDR", proxy)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an ip or CIDR", proxy)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+type Database struct {
+	Host            string        `yaml:"host"`
+	Port            string        `yaml:"port"`
+	Name            string        `yaml:"name"`
+	User            string        `yaml:"user"`
+	Password        string        `yaml:"password"`
+	SSLMode         string        `yaml:"ssl_mode"`
+	MaxOpenConns    int           `yaml:"max_open_conns"`
+	MaxIdleConns    int           `yaml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`
+}
+
+type Identity struct {
+	Provider    string `yaml:"provider"`
+	FirebaseKey string `yaml:"firebase_key"`
+}
+
+type Session struct {
+	TTL          time.Duration `yaml:"ttl"`
+	IdleTimeout  time.Duration `yaml:"idle_timeout"`
+	ReapInterval time.Duration `yaml:"reap_interval"`
+	Retention    time.Duration `yaml:"retention"`
+}
+
+type Friends struct {
+	RequestCooldown time.Duration `yaml:"request_cooldown"`
+}
+
+// Mail picks how outgoing email is delivered, smtp for real delivery or log to write it to the log (or LogFile)
+type Mail struct {
+	Driver       string `yaml:"driver"`
+	From         string `yaml:"from"`
+	SMTPHost     string `yaml:"smtp_host"`
+	SMTPPort     string `yaml:"smtp_port"`
+	SMTPUser     string `yaml:"smtp_user"`
+	SMTPPassword string `yaml:"smtp_password"`
+	LogFile      string `yaml:"log_file"`
+}
+
+type Password struct {
+	ResetTokenTTL time.Duration `yaml:"reset_token_ttl"`
+	// ResetURL is the page the emailed link opens, the token is added as the token query param
+	ResetURL string `yaml:"reset_url"`
+}
+
+type Verification struct {
+	Policy   string        `yaml:"policy"`
+	TokenTTL time.Duration `yaml:"token_ttl"`
+	// URL is what the emailed link opens, the token is added as the token query param
+	URL string `yaml:"url"`
+}
+
+type MFA struct {
+	// Issuer is the account name authenticator apps show next to the code
+	Issuer       string        `yaml:"issuer"`
+	ChallengeTTL time.Duration `yaml:"challenge_ttl"`
+	// MaxAttempts is how many wrong codes one login challenge takes before the password has to be entered again
+	MaxAttempts int `yaml:"max_attempts"`
+	// SecretKey encrypts the TOTP secrets in the database and keys the hashes of the recovery codes, 32 random bytes
+	// base64 encoded, e.g. from openssl rand -base64 32. Changing it makes every enrolled authenticator and every
+	// recovery code useless.
+	SecretKey string `yaml:"secret_key"`
+}
+
+// Lockout slows down password guessing on /login. Failures are counted per email and per client ip and forgotten
+// after Window without a new one. From BackoffAfter failures on an email every further failure locks it for twice
+// as long, starting at BaseDelay, and Threshold failures lock it for Duration. An ip is locked for Duration after
+// IPThreshold failures, across all the emails tried from it.
+type Lockout struct {
+	Store        string        `yaml:"store"`
+	Window       time.Duration `yaml:"window"`
+	BackoffAfter int           `yaml:"backoff_after"`
+	BaseDelay    time.Duration `yaml:"base_delay"`
+	Threshold    int           `yaml:"threshold"`
+	Duration     time.Duration `yaml:"duration"`
+	IPThreshold  int           `yaml:"ip_threshold"`
+}
+
+// RateLimit has one token bucket per route group. Public routes are limited per client ip, the /user and /admin
+// routes per user id. Those two are also limited per client ip by Authenticated before the token is checked, so
+// requests with bad tokens cannot flood the identity provider and the database.
+type RateLimit struct {
+	Public        RateLimitPolicy `yaml:"public"`
+	User          RateLimitPolicy `yaml:"user"`
+	Authenticated RateLimitPolicy `yaml:"authenticated"`
+}
+
+// RateLimitPolicy lets a client make Burst requests at once and refills its bucket at Requests per Per.
+// Requests 0 turns limiting off for the group.
+type RateLimitPolicy struct {
+	Requests int           `yaml:"requests"`
+	Per      time.Duration `yaml:"per"`
+	Burst    int           `yaml:"burst"`
+}
+
+// Admin names the users, by email, who are made admins at startup. Later admins are appointed through
+// PUT /admin/users/{id}/role, and taking an email off the list does not demote its user.
+type Admin struct {
+	Emails []string `yaml:"emails"`
+}
+
+// Account is the life cycle of deactivated accounts. A user who deletes their account can get it back by logging in
+// within DeletionGrace, after that it is purged for good on the next run, every PurgeInterval.
+type Account struct {
+	DeletionGrace time.Duration `yaml:"deletion_grace"`
+	PurgeInterval time.Duration `yaml:"purge_interval"`
+	// ErasureKey keys the HMAC an erased email is kept as in its tombstone, 32 random bytes base64 encoded.
+	// Changing it makes the tombstones written before unreachable by email.
+	ErasureKey string `yaml:"erasure_key"`
+}
+
+// Export is GET /user/export. An account with up to SyncMaxRows sessions, friend requests, blocks and audit entries
+// gets its archive in the response, a bigger one is built in the background, polled every PollInterval, and can be
+// downloaded for TTL. A job running longer than StaleAfter is taken over by another worker.
+type Export struct {
+	SyncMaxRows  int           `yaml:"sync_max_rows"`
+	TTL          time.Duration `yaml:"ttl"`
+	PollInterval time.Duration `yaml:"poll_interval"`
+	StaleAfter   time.Duration `yaml:"stale_after"`
+}
+
+type Pagination struct {
+	DefaultLimit int `yaml:"default_limit"`
+	MaxLimit     int `yaml:"max_limit"`
+}
+
+func Default() Config {
+	return Config{
+		Server: Server{
+			ListenAddr: ":8080",
+		},
+		Database: Database{
+			SSLMode:         "disable",
+			MaxOpenConns:    25,
+			MaxIdleConns:    5,
+			ConnMaxLifetime: 30 * time.Minute,
+		},
+		Identity: Identity{
+			Provider: IdentityProviderFirebase,
+		},
+		Session: Session{
+			TTL:          30 * 24 * time.Hour,
+			IdleTimeout:  7 * 24 * time.Hour,
+			ReapInterval: 15 * time.Minute,
+			Retention:    30 * 24 * time.Hour,
+		},
+		Pagination: Pagination{
+			DefaultLimit: 10,
+			MaxLimit:     100,
+		},
+		Friends: Friends{
+			RequestCooldown: 7 * 24 * time.Hour,
+		},
+		Mail: Mail{
+			Driver:   MailDriverLog,
+			From:     "no-reply@localhost",
+			SMTPPort: "587",
+		},
+		Password: Password{
+			ResetTokenTTL: time.Hour,
+			ResetURL:      "http://localhost:3000/reset-password",
+		},
+		Verification: Verification{
+			Policy:   VerificationPolicyRestrict,
+			TokenTTL: 48 * time.Hour,
+			URL:      "http://localhost:8080/verify-email",
+		},
+		MFA: MFA{
+			Issuer:       "firebaseAuth",
+			ChallengeTTL: 5 * time.Minute,
+			MaxAttempts:  5,
+		},
+		Lockout: Lockout{
+			Store:        LockoutStorePostgres,
+			Window:       time.Hour,
+			BackoffAfter: 3,
+			BaseDelay:    time.Second,
+			Threshold:    10,
+			Duration:     15 * time.Minute,
+			IPThreshold:  50,
+		},
+		RateLimit: RateLimit{
+			Public: RateLimitPolicy{Requests: 60, Per: time.Minute, Burst: 20},
+			User:   RateLimitPolicy{Requests: 120, Per: time.Minute, Burst: 60},
+			// above User, an ip can be shared by several users
+			Authenticated: RateLimitPolicy{Requests: 600, Per: time.Minute, Burst: 200},
+		},
+		Account: Account{
+			DeletionGrace: 30 * 24 * time.Hour,
+			PurgeInterval: time.Hour,
+		},
+		Export: Export{
+			SyncMaxRows:  1000,
+			TTL:          24 * time.Hour,
+			PollInterval: 10 * time.Second,
+			StaleAfter:   15 * time.Minute,
+		},
+	}
+}
+
+// setting binds one value to its env var and flag name
+type setting struct {
+	env   string
+	flag  string
+	usage string
+	set   func(c *Config, value string) error
+}
+
+var settings = []setting{
+	{"listen_addr", "listen-addr", "address the http server listens on", stringValue(func(c *Config) *string { return &c.Server.ListenAddr })},
+	{"trusted_proxies", "trusted-proxies", "comma separated CIDRs of the proxies allowed to set X-Forwarded-For", listValue(func(c *Config) *[]string { return &c.Server.TrustedProxies })},
+	{"host", "db-host", "database host", stringValue(func(c *Config) *string { return &c.Database.Host })},
+	{"port", "db-port", "database port", stringValue(func(c *Config) *string { return &c.Database.Port })},
+	{"databaseName", "db-name", "database name", stringValue(func(c *Config) *string { return &c.Database.Name })},
+	{"user", "db-user", "database user", stringValue(func(c *Config) *string { return &c.Database.User })},
+	{"password", "db-password", "database password", stringValue(func(c *Config) *string { return &c.Database.Password })},
+	{"ssl_mode", "db-ssl-mode", "database sslmode", stringValue(func(c *Config) *string { return &c.Database.SSLMode })},
+	{"db_max_open_conns", "db-max-open-conns", "maximum open database connections, 0 is unlimited", intValue(func(c *Config) *int { return &c.Database.MaxOpenConns })},
+	{"db_max_idle_conns", "db-max-idle-conns", "maximum idle database connections", intValue(func(c *Config) *int { return &c.Database.MaxIdleConns })},
+	{"db_conn_max_lifetime", "db-conn-max-lifetime", "maximum lifetime of a database connection, e.g. 30m", durationValue(func(c *Config) *time.Duration { return &c.Database.ConnMaxLifetime })},
+	{"identity_provider", "identity-provider", "identity backend, firebase or memory", stringValue(func(c *Config) *string { return &c.Identity.Provider })},
+	{"firebase_key", "firebase-key", "firebase service account json", stringValue(func(c *Config) *string { return &c.Identity.FirebaseKey })},
+	{"session_ttl", "session-ttl", "absolute lifetime of a login session, e.g. 720h", durationValue(func(c *Config) *time.Duration { return &c.Session.TTL })},
+	{"session_idle_timeout", "session-idle-timeout", "a session unused for this long expires, 0 disables it", durationValue(func(c *Config) *time.Duration { return &c.Session.IdleTimeout })},
+	{"session_reap_interval", "session-reap-interval", "how often expired sessions are cleaned up", durationValue(func(c *Config) *time.Duration { return &c.Session.ReapInterval })},
+	{"session_retention", "session-retention", "how long expired sessions are kept before they are deleted", durationValue(func(c *Config) *time.Duration { return &c.Session.Retention })},
+	{"pagination_default_limit", "pagination-default-limit", "page size used when the limit query param is missing", intValue(func(c *Config) *int { return &c.Pagination.DefaultLimit })},
+	{"friend_request_cooldown", "friend-request-cooldown", "how long after a rejection the same friend request cannot be sent again", durationValue(func(c *Config) *time.Duration { return &c.Friends.RequestCooldown })},
+	{"pagination_max_limit", "pagination-max-limit", "largest page size a client can ask for", intValue(func(c *Config) *int { return &c.Pagination.MaxLimit })},
+	{"mail_driver", "mail-driver", "how email is delivered, smtp or log", stringValue(func(c *Config) *string { return &c.Mail.Driver })},
+	{"mail_from", "mail-from", "sender address of outgoing email", stringValue(func(c *Config) *string { return &c.Mail.From })},
+	{"smtp_host", "smtp-host", "smtp server host", stringValue(func(c *Config) *string { return &c.Mail.SMTPHost })},
+	{"smtp_port", "smtp-port", "smtp server port", stringValue(func(c *Config) *string { return &c.Mail.SMTPPort })},
+	{"smtp_user", "smtp-user", "smtp user, empty disables authentication", stringValue(func(c *Config) *string { return &c.Mail.SMTPUser })},
+	{"smtp_password", "smtp-password", "smtp password", stringValue(func(c *Config) *string { return &c.Mail.SMTPPassword })},
+	{"mail_log_file", "mail-log-file", "file the log mail driver appends messages to, empty writes them to the log", stringValue(func(c *Config) *string { return &c.Mail.LogFile })},
+	{"password_reset_token_ttl", "password-reset-token-ttl", "how long a password reset link stays valid", durationValue(func(c *Config) *time.Duration { return &c.Password.ResetTokenTTL })},
+	{"password_reset_url", "password-reset-url", "page the password reset link points to", stringValue(func(c *Config) *string { return &c.Password.ResetURL })},
+	{"email_verification_policy", "email-verification-policy", "what unverified users may do, off, restrict or block_login", stringValue(func(c *Config) *string { return &c.Verification.Policy })},
+	{"email_verification_token_ttl", "email-verification-token-ttl", "how long an email verification link stays valid", durationValue(func(c *Config) *time.Duration { return &c.Verification.TokenTTL })},
+	{"email_verification_url", "email-verification-url", "address the email verification link points to", stringValue(func(c *Config) *string { return &c.Verification.URL })},
+	{"mfa_issuer", "mfa-issuer", "issuer name shown by authenticator apps", stringValue(func(c *Config) *string { return &c.MFA.Issuer })},
+	{"mfa_challenge_ttl", "mfa-challenge-ttl", "how long the second login step can be completed after the password", durationValue(func(c *Config) *time.Duration { return &c.MFA.ChallengeTTL })},
+	{"mfa_max_attempts", "mfa-max-attempts", "wrong codes allowed per login challenge", intValue(func(c *Config) *int { return &c.MFA.MaxAttempts })},
+	{"mfa_secret_key", "mfa-secret-key", "base64 of 32 random bytes that encrypts the stored TOTP secrets and keys the recovery code hashes", stringValue(func(c *Config) *string { return &c.MFA.SecretKey })},
+	{"lockout_store", "lockout-store", "where failed logins are counted, postgres or memory", stringValue(func(c *Config) *string { return &c.Lockout.Store })},
+	{"lockout_window", "lockout-window", "failed logins older than this are forgotten", durationValue(func(c *Config) *time.Duration { return &c.Lockout.Window })},
+	{"lockout_backoff_after", "lockout-backoff-after", "failed logins on an email before each further one is delayed", intValue(func(c *Config) *int { return &c.Lockout.BackoffAfter })},
+	{"lockout_base_delay", "lockout-base-delay", "first back-off delay, it doubles with every failure", durationValue(func(c *Config) *time.Duration { return &c.Lockout.BaseDelay })},
+	{"lockout_threshold", "lockout-threshold", "failed logins that lock an email", intValue(func(c *Config) *int { return &c.Lockout.Threshold })},
+	{"lockout_duration", "lockout-duration", "how long a locked email or ip stays locked", durationValue(func(c *Config) *time.Duration { return &c.Lockout.Duration })},
+	{"lockout_ip_threshold", "lockout-ip-threshold", "failed logins that lock a client ip", intValue(func(c *Config) *int { return &c.Lockout.IPThreshold })},
+	{"rate_limit_public_requests", "rate-limit-public-requests", "requests per rate-limit-public-per a client ip can make to the public routes, 0 disables it", intValue(func(c *Config) *int { return &c.RateLimit.Public.Requests })},
+	{"rate_limit_public_per", "rate-limit-public-per", "period the public request budget refills over, e.g. 1m", durationValue(func(c *Config) *time.Duration { return &c.RateLimit.Public.Per })},
+	{"rate_limit_public_burst", "rate-limit-public-burst", "requests a client ip can make at once to the public routes", intValue(func(c *Config) *int { return &c.RateLimit.Public.Burst })},
+	{"rate_limit_user_requests", "rate-limit-user-requests", "requests per rate-limit-user-per a user can make to the /user routes, 0 disables it", intValue(func(c *Config) *int { return &c.RateLimit.User.Requests })},
+	{"rate_limit_user_per", "rate-limit-user-per", "period the /user request budget refills over, e.g. 1m", durationValue(func(c *Config) *time.Duration { return &c.RateLimit.User.Per })},
+	{"rate_limit_user_burst", "rate-limit-user-burst", "requests a user can make at once to the /user routes", intValue(func(c *Config) *int { return &c.RateLimit.User.Burst })},
+	{"rate_limit_authenticated_requests", "rate-limit-authenticated-requests", "requests per rate-limit-authenticated-per a client ip can make to the /user and /admin routes before authentication, 0 disables it", intValue(func(c *Config) *int { return &c.RateLimit.Authenticated.Requests })},
+	{"rate_limit_authenticated_per", "rate-limit-authenticated-per", "period the per ip /user and /admin budget refills over, e.g. 1m", durationValue(func(c *Config) *time.Duration { return &c.RateLimit.Authenticated.Per })},
+	{"rate_limit_authenticated_burst", "rate-limit-authenticated-burst", "requests a client ip can make at once to the /user and /admin routes", intValue(func(c *Config) *int { return &c.RateLimit.Authenticated.Burst })},
+	{"admin_emails", "admin-emails", "comma separated emails of the users made admins at startup", listValue(func(c *Config) *[]string { return &c.Admin.Emails })},
+	{"account_deletion_grace", "account-deletion-grace", "how long a deleted account can be reactivated by logging in before it is purged", durationValue(func(c *Config) *time.Duration { return &c.Account.DeletionGrace })},
+	{"account_purge_interval", "account-purge-interval", "how often accounts past their deletion grace are purged", durationValue(func(c *Config) *time.Duration { return &c.Account.PurgeInterval })},
+	{"account_erasure_key", "account-erasure-key", "base64 of 32 random bytes that keys the hash of erased emails", stringValue(func(c *Config) *string { return &c.Account.ErasureKey })},
+	{"export_sync_max_rows", "export-sync-max-rows", "largest export, in rows, answered right away instead of in the background", intValue(func(c *Config) *int { return &c.Export.SyncMaxRows })},
+	{"export_ttl", "export-ttl", "how long a finished background export can be downloaded", durationValue(func(c *Config) *time.Duration { return &c.Export.TTL })},
+	{"export_poll_interval", "export-poll-interval", "how often the export worker looks for queued exports", durationValue(func(c *Config) *time.Duration { return &c.Export.PollInterval })},
+	{"export_stale_after", "export-stale-after", "a background export running this long is restarted", durationValue(func(c *Config) *time.Duration { return &c.Export.StaleAfter })},
+}
+
+// Load builds the Config from args (usually os.Args[1:]), the environment and the file named by -config or
+// config_file, and validates it.
+func Load(args []string) (Config, error) {
+	cfg := Default()
+
+	flagSet := flag.NewFlagSet("firebaseAuth", flag.ContinueOnError)
+	configFile := flagSet.String("config", os.Getenv("config_file"), "path to a yaml or json config file")
+	for _, s := range settings {
+		flagSet.String(s.flag, "", s.usage+" (env "+s.env+")")
+	}
+	if err := flagSet.Parse(args); err != nil {
+		return cfg, err
+	}
+
+	if *configFile != "" {
+		if err := loadFile(&cfg, *configFile); err != nil {
+			return cfg, err
+		}
+	}
+
+	for _, s := range settings {
+		value, ok := os.LookupEnv(s.env)
+		if !ok || value == "" {
+			continue
+		}
+		if err := s.set(&cfg, value); err != nil {
+			return cfg, fmt.Errorf("config: env %s: %v", s.env, err)
+		}
+	}
+
+	var flagErr error
+	flagSet.Visit(func(f *flag.Flag) {
+		for _, s := range settings {
+			if s.flag != f.Name || flagErr != nil {
+				continue
+			}
+			if err := s.set(&cfg, f.Value.String()); err != nil {
+				flagErr = fmt.Errorf("config: flag -%s: %v", f.Name, err)
+			}
+		}
+	})
+	if flagErr != nil {
+		return cfg, flagErr
+	}
+
+	return cfg, cfg.Validate()
+}
+
+func loadFile(cfg *Config, path string) error {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config: cannot read %s: %v", path, err)
+	}
+	// json is valid yaml, so one decoder covers both file formats
+	if err := yaml.UnmarshalStrict(content, cfg); err != nil {
+		return fmt.Errorf("config: cannot parse %s: %v", path, err)
+	}
+	return nil
+}
+
+// Validate reports every invalid or missing value at once so a bad deployment fails on the first start
+func (c Config) Validate() error {
+	var problems []string
+	require := func(value, name string) {
+		if strings.TrimSpace(value) == "" {
+			problems = append(problems, name+" is required")
+		}
+	}
+
+	require(c.Server.ListenAddr, "listen_addr")
+	if _, err := c.Server.TrustedProxyNets(); err != nil {
+		problems = append(problems, "trusted_proxies: "+err.Error())
+	}
+	require(c.Database.Host, "host")
+	require(c.Database.Port, "port")
+	require(c.Database.Name, "databaseName")
+	require(c.Database.User, "user")
+
+	switch c.Database.SSLMode {
+	case "disable", "allow", "prefer", "require", "verify-ca", "verify-full":
+	default:
+		problems = append(problems, fmt.Sprintf("ssl_mode %q is not a postgres sslmode", c.Database.SSLMode))
+	}
+	if c.Database.MaxOpenConns < 0 {
+		problems = append(problems, "db_max_open_conns cannot be negative")
+	}
+	if c.Database.MaxIdleConns < 0 {
+		problems = append(problems, "db_max_idle_conns cannot be negative")
+	}
+	if c.Database.MaxOpenConns > 0 && c.Database.MaxIdleConns > c.Database.MaxOpenConns {
+		problems = append(problems, "db_max_idle_conns cannot be larger than db_max_open_conns")
+	}
+	if c.Database.ConnMaxLifetime < 0 {
+		problems = append(problems, "db_conn_max_lifetime cannot be negative")
+	}
+
+	switch c.Identity.Provider {
+	case IdentityProviderFirebase:
+		require(c.Identity.FirebaseKey, "firebase_key")
+	case IdentityProviderMemory:
+	default:
+		problems = append(problems, fmt.Sprintf("identity_provider %q must be %s or %s", c.Identity.Provider, IdentityProviderFirebase, IdentityProviderMemory))
+	}
+
+	if c.Session.TTL <= 0 {
+		problems = append(problems, "session_ttl must be positive")
+	}
+	if c.Session.IdleTimeout < 0 {
+		problems = append(problems, "session_idle_timeout cannot be negative")
+	}
+	if c.Session.ReapInterval <= 0 {
+		problems = append(problems, "session_reap_interval must be positive")
+	}
+	if c.Session.Retention < 0 {
+		problems = append(problems, "session_retention cannot be negative")
+	}
+
+	if c.Pagination.DefaultLimit <= 0 {
+		problems = append(problems, "pagination_default_limit must be positive")
+	}
+	if c.Pagination.MaxLimit < c.Pagination.DefaultLimit {
+		problems = append(problems, "pagination_max_limit cannot be smaller than pagination_default_limit")
+	}
+
+	if c.Friends.RequestCooldown < 0 {
+		problems = append(problems, "friend_request_cooldown cannot be negative")
+	}
+
+	require(c.Mail.From, "mail_from")
+	switch c.Mail.Driver {
+	case MailDriverSMTP:
+		require(c.Mail.SMTPHost, "smtp_host")
+		require(c.Mail.SMTPPort, "smtp_port")
+	case MailDriverLog:
+	default:
+		problems = append(problems, fmt.Sprintf("mail_driver %q must be %s or %s", c.Mail.Driver, MailDriverSMTP, MailDriverLog))
+	}
+
+	if c.Password.ResetTokenTTL <= 0 {
+		problems = append(problems, "password_reset_token_ttl must be positive")
+	}
+	require(c.Password.ResetURL, "password_reset_url")
+
+	switch c.Verification.Policy {
+	case VerificationPolicyOff, VerificationPolicyRestrict, VerificationPolicyBlockLogin:
+	default:
+		problems = append(problems, fmt.Sprintf("email_verification_policy %q must be %s, %s or %s", c.Verification.Policy,
+			VerificationPolicyOff, VerificationPolicyRestrict, VerificationPolicyBlockLogin))
+	}
+	if c.Verification.TokenTTL <= 0 {
+		problems = append(problems, "email_verification_token_ttl must be positive")
+	}
+	require(c.Verification.URL, "email_verification_url")
+
+	require(c.MFA.Issuer, "mfa_issuer")
+	if c.MFA.ChallengeTTL <= 0 {
+		problems = append(problems, "mfa_challenge_ttl must be positive")
+	}
+	if c.MFA.MaxAttempts <= 0 {
+		problems = append(problems, "mfa_max_attempts must be positive")
+	}
+	if _, err := secrets.DecodeKey(c.MFA.SecretKey); err != nil {
+		problems = append(problems, "mfa_secret_key must be 32 random bytes, base64 encoded")
+	}
+
+	switch c.Lockout.Store {
+	case LockoutStorePostgres, LockoutStoreMemory:
+	default:
+		problems = append(problems, fmt.Sprintf("lockout_store %q must be %s or %s", c.Lockout.Store, LockoutStorePostgres, LockoutStoreMemory))
+	}
+	if c.Lockout.Window <= 0 {
+		problems = append(problems, "lockout_window must be positive")
+	}
+	if c.Lockout.BackoffAfter <= 0 {
+		problems = append(problems, "lockout_backoff_after must be positive")
+	}
+	if c.Lockout.BaseDelay < 0 {
+		problems = append(problems, "lockout_base_delay cannot be negative")
+	}
+	if c.Lockout.Threshold < c.Lockout.BackoffAfter {
+		problems = append(problems, "lockout_threshold cannot be smaller than lockout_backoff_after")
+	}
+	if c.Lockout.Duration <= 0 {
+		problems = append(problems, "lockout_duration must be positive")
+	}
+	if c.Lockout.IPThreshold <= 0 {
+		problems = append(problems, "lockout_ip_threshold must be positive")
+	}
+
+	rateLimits := []struct {
+		name   string
+		policy RateLimitPolicy
+	}{{"public", c.RateLimit.Public}, {"user", c.RateLimit.User}, {"authenticated", c.RateLimit.Authenticated}}
+	for _, group := range rateLimits {
+		name, policy := group.name, group.policy
+		if policy.Requests < 0 {
+			problems = append(problems, "rate_limit_"+name+"_requests cannot be negative")
+		}
+		if policy.Requests > 0 && policy.Per <= 0 {
+			problems = append(problems, "rate_limit_"+name+"_per must be positive")
+		}
+		if policy.Requests > 0 && policy.Burst <= 0 {
+			problems = append(problems, "rate_limit_"+name+"_burst must be positive")
+		}
+	}
+
+	if c.Account.DeletionGrace <= 0 {
+		problems = append(problems, "account_deletion_grace must be positive")
+	}
+	if c.Account.PurgeInterval <= 0 {
+		problems = append(problems, "account_purge_interval must be positive")
+	}
+	if _, err := secrets.DecodeKey(c.Account.ErasureKey); err != nil {
+		problems = append(problems, "account_erasure_key must be 32 random bytes, base64 encoded")
+	}
+
+	if c.Export.SyncMaxRows < 0 {
+		problems = append(problems, "export_sync_max_rows cannot be negative")
+	}
+	if c.Export.TTL <= 0 {
+		problems = append(problems, "export_ttl must be positive")
+	}
+	if c.Export.PollInterval <= 0 {
+		problems = append(problems, "export_poll_interval must be positive")
+	}
+	if c.Export.StaleAfter <= 0 {
+		problems = append(problems, "export_stale_after must be positive")
+	}
+
+	if len(problems) > 0 {
+		return errors.New("config: " + strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func stringValue(field func(c *Config) *string) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		*field(c) = value
+		return nil
+	}
+}
+
+func listValue(field func(c *Config) *[]string) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		list := make([]string, 0)
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		*field(c) = list
+		return nil
+	}
+}
+
+func intValue(field func(c *Config) *int) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		number, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		*field(c) = number
+		return nil
+	}
+}
+
+func durationValue(field func(c *Config) *time.Duration) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		*field(c) = duration
+		return nil
+	}
+}
@@ -0,0 +1,217 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testKey is base64 of 32 bytes, what mfa_secret_key and account_erasure_key expect
+const testKey = "MDEyMzQ1Njc4OTAxMjM0NTY3ODkwMTIzNDU2Nzg5MDE="
+
+// setEnv sets every setting the tests do not list to empty, which Load treats as unset, so the environment of
+// the machine running the tests does not leak in, and restores it afterwards
+func setEnv(t *testing.T, values map[string]string) {
+	t.Helper()
+	for _, s := range append(settings, setting{env: "config_file"}) {
+		previous, ok := os.LookupEnv(s.env)
+		os.Setenv(s.env, values[s.env])
+		env := s.env
+		t.Cleanup(func() {
+			if ok {
+				os.Setenv(env, previous)
+			} else {
+				os.Unsetenv(env)
+			}
+		})
+	}
+}
+
+// validEnv is the least a config needs to pass Validate
+func validEnv() map[string]string {
+	return map[string]string{
+		"host":                "localhost",
+		"port":                "5432",
+		"databaseName":        "firebase",
+		"user":                "postgres",
+		"identity_provider":   IdentityProviderMemory,
+		"mfa_secret_key":      testKey,
+		"account_erasure_key": testKey,
+	}
+}
+
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeFile(t, `
+server:
+  listen_addr: ":9001"
+session:
+  ttl: 2h
+  idle_timeout: 3h
+pagination:
+  default_limit: 20
+`)
+
+	env := validEnv()
+	env["session_idle_timeout"] = "4h"
+	env["pagination_default_limit"] = "30"
+	setEnv(t, env)
+
+	cfg, err := Load([]string{"-config", path, "-pagination-default-limit", "40"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		got  interface{}
+		want interface{}
+	}{
+		{"default", cfg.Session.ReapInterval, Default().Session.ReapInterval},
+		{"file over default", cfg.Server.ListenAddr, ":9001"},
+		{"file over default", cfg.Session.TTL, 2 * time.Hour},
+		{"env over file", cfg.Session.IdleTimeout, 4 * time.Hour},
+		{"flag over env", cfg.Pagination.DefaultLimit, 40},
+	}
+	for _, test := range tests {
+		if test.got != test.want {
+			t.Errorf("%s: got %v, want %v", test.name, test.got, test.want)
+		}
+	}
+}
+
+func TestLoadConfigFileFromEnv(t *testing.T) {
+	path := writeFile(t, `{"server": {"listen_addr": ":9002"}}`)
+	env := validEnv()
+	env["config_file"] = path
+	setEnv(t, env)
+
+	cfg, err := Load(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server.ListenAddr != ":9002" {
+		t.Errorf("ListenAddr = %q, want the :9002 of the json file", cfg.Server.ListenAddr)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		env     map[string]string
+		args    []string
+		wantErr string
+	}{
+		{"unknown file key", "server:\n  listen_port: 1\n", nil, nil, "cannot parse"},
+		{"bad env duration", "", map[string]string{"session_ttl": "soon"}, nil, "env session_ttl"},
+		{"bad env int", "", map[string]string{"pagination_max_limit": "many"}, nil, "env pagination_max_limit"},
+		{"bad flag duration", "", nil, []string{"-session-ttl", "soon"}, "flag -session-ttl"},
+		{"invalid value", "", map[string]string{"mail_driver": "pigeon"}, nil, "mail_driver"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			env := validEnv()
+			for key, value := range test.env {
+				env[key] = value
+			}
+			if test.file != "" {
+				env["config_file"] = writeFile(t, test.file)
+			}
+			setEnv(t, env)
+
+			_, err := Load(test.args)
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("Load error = %v, want one mentioning %q", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := func() Config {
+		cfg := Default()
+		cfg.Database.Host = "localhost"
+		cfg.Database.Port = "5432"
+		cfg.Database.Name = "firebase"
+		cfg.Database.User = "postgres"
+		cfg.Identity.Provider = IdentityProviderMemory
+		cfg.MFA.SecretKey = testKey
+		cfg.Account.ErasureKey = testKey
+		return cfg
+	}
+
+	if err := valid().Validate(); err != nil {
+		t.Fatalf("Validate of a valid config: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		change  func(c *Config)
+		wantErr string
+	}{
+		{"missing host", func(c *Config) { c.Database.Host = " " }, "host is required"},
+		{"bad ssl mode", func(c *Config) { c.Database.SSLMode = "maybe" }, "ssl_mode"},
+		{"idle above open conns", func(c *Config) { c.Database.MaxOpenConns, c.Database.MaxIdleConns = 2, 3 }, "db_max_idle_conns"},
+		{"firebase without key", func(c *Config) { c.Identity.Provider = IdentityProviderFirebase }, "firebase_key is required"},
+		{"unknown provider", func(c *Config) { c.Identity.Provider = "ldap" }, "identity_provider"},
+		{"bad trusted proxy", func(c *Config) { c.Server.TrustedProxies = []string{"proxy"} }, "trusted_proxies"},
+		{"zero session ttl", func(c *Config) { c.Session.TTL = 0 }, "session_ttl"},
+		{"max limit below default", func(c *Config) { c.Pagination.MaxLimit = 1 }, "pagination_max_limit"},
+		{"smtp without host", func(c *Config) { c.Mail.Driver = MailDriverSMTP }, "smtp_host is required"},
+		{"short mfa key", func(c *Config) { c.MFA.SecretKey = "c2hvcnQ=" }, "mfa_secret_key"},
+		{"missing erasure key", func(c *Config) { c.Account.ErasureKey = "" }, "account_erasure_key"},
+		{"unknown lockout store", func(c *Config) { c.Lockout.Store = "redis" }, "lockout_store"},
+		{"zero purge interval", func(c *Config) { c.Account.PurgeInterval = 0 }, "account_purge_interval"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := valid()
+			test.change(&cfg)
+			err := cfg.Validate()
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("Validate error = %v, want one mentioning %q", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateReportsEveryProblem(t *testing.T) {
+	err := Config{}.Validate()
+	if err == nil {
+		t.Fatal("Validate of an empty config passed")
+	}
+	for _, want := range []string{"listen_addr is required", "host is required", "mfa_secret_key", "account_erasure_key"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Validate error %q does not mention %q", err, want)
+		}
+	}
+}
+
+func TestTrustedProxyNets(t *testing.T) {
+	server := Server{TrustedProxies: []string{"10.0.0.0/8", "192.0.2.1", "2001:db8::1"}}
+	nets, err := server.TrustedProxyNets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"10.0.0.0/8", "192.0.2.1/32", "2001:db8::1/128"}
+	if len(nets) != len(want) {
+		t.Fatalf("TrustedProxyNets = %v, want %v", nets, want)
+	}
+	for i := range want {
+		if nets[i].String() != want[i] {
+			t.Errorf("TrustedProxyNets[%d] = %s, want %s", i, nets[i], want[i])
+		}
+	}
+}
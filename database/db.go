@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/sirupsen/logrus"
+	"time"
 
 	// for importing migrations
 	_ "github.com/golang-migrate/migrate/v4/source/file"
@@ -38,6 +39,13 @@ func ConnectAndMigrate(host, port, databaseName, user, password string, sslMode
 	return migrateUp(DB)
 }
 
+// SetPool applies the connection pool limits, zero values keep the database/sql defaults
+func SetPool(maxOpenConns, maxIdleConns int, connMaxLifetime time.Duration) {
+	FirebaseDB.SetMaxOpenConns(maxOpenConns)
+	FirebaseDB.SetMaxIdleConns(maxIdleConns)
+	FirebaseDB.SetConnMaxLifetime(connMaxLifetime)
+}
+
 func ShutdownDatabase() error {
 	return FirebaseDB.Close()
 }
@@ -63,8 +71,8 @@ func migrateUp(db *sqlx.DB) error {
 	return nil
 }
 
-// Tx provides the transaction wrapper
-func Tx(fn func(tx *sqlx.Tx) error) error {
+// Tx provides the transaction wrapper. It rolls back when fn fails and otherwise returns the error of the commit
+func Tx(fn func(tx *sqlx.Tx) error) (err error) {
 	tx, err := FirebaseDB.Beginx()
 	if err != nil {
 		return fmt.Errorf("failed to start a transaction: %+v", err)
@@ -78,6 +86,7 @@ func Tx(fn func(tx *sqlx.Tx) error) error {
 		}
 		if commitErr := tx.Commit(); commitErr != nil {
 			logrus.Errorf("failed to commit tx: %s", commitErr)
+			err = fmt.Errorf("failed to commit tx: %w", commitErr)
 		}
 	}()
 	err = fn(tx)
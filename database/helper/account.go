@@ -0,0 +1,157 @@
+package helper
+
+import (
+	"firebaseAuth/database"
+	"firebaseAuth/models"
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+	"strings"
+	"time"
+)
+
+// DeactivateAccount archives the user, which hides them everywhere the archived_at filters apply, expires every
+// session and pending two-factor login and calls updateProvider with the user uid inside the transaction, a failure
+// there rolls everything back. It returns when the account was archived. sql.ErrNoRows means there is no such
+// active user.
+func DeactivateAccount(userID int, updateProvider func(uid string) error) (time.Time, error) {
+	// language=SQL
+	SQL := `UPDATE users
+            SET    archived_at           = now(),
+                   purge_attempts        = 0,
+                   purge_next_attempt_at = NULL,
+                   updated_at            = now()
+            WHERE  id = $1
+            AND    archived_at IS NULL
+            RETURNING COALESCE(user_uid, '') as user_uid, archived_at`
+
+	// language=SQL
+	challengeSQL := `UPDATE mfa_challenges
+                     SET    used_at = now()
+                     WHERE  user_id = $1
+                     AND    used_at IS NULL`
+
+	var archivedAt time.Time
+
+	txErr := database.Tx(func(tx *sqlx.Tx) error {
+		var row struct {
+			UID        string    `db:"user_uid"`
+			ArchivedAt time.Time `db:"archived_at"`
+		}
+		err := tx.Get(&row, SQL, userID)
+		if err != nil {
+			return err
+		}
+		archivedAt = row.ArchivedAt
+
+		_, err = expireUserSessions(tx, userID, "")
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(challengeSQL, userID)
+		if err != nil {
+			return err
+		}
+
+		return updateProvider(row.UID)
+	})
+	if txErr != nil {
+		logrus.Printf("DeactivateAccount: cannot deactivate user %d:%v", userID, txErr)
+		return archivedAt, txErr
+	}
+	return archivedAt, nil
+}
+
+// FetchDeactivatedCredentials is FetchPasswordAndID for a user who deactivated the account less than grace ago and
+// can still get it back. sql.ErrNoRows means there is no such user.
+func FetchDeactivatedCredentials(email string, grace time.Duration) (models.UserCredentials, error) {
+	// language=SQL
+	SQL := `SELECT id,
+                   COALESCE(password, '') as password,
+                   email_verified_at IS NOT NULL as email_verified,
+                   disabled_at IS NOT NULL as disabled,
+                   role
+            FROM   users
+            WHERE  email = $1
+            AND    archived_at IS NOT NULL
+            AND    archived_at > now() - make_interval(secs => $2::float8)`
+
+	var userCredentials models.UserCredentials
+
+	err := database.FirebaseDB.Get(&userCredentials, SQL, strings.ToLower(email), grace.Seconds())
+	if err != nil {
+		logrus.Printf("FetchDeactivatedCredentials: cannot get credentials:%v", err)
+		return userCredentials, err
+	}
+	return userCredentials, nil
+}
+
+// ReactivateAccount undoes DeactivateAccount while the grace period lasts and calls updateProvider with the user uid
+// inside the transaction. sql.ErrNoRows means the account is not deactivated or can no longer be reactivated.
+func ReactivateAccount(userID int, grace time.Duration, updateProvider func(uid string) error) error {
+	// language=SQL
+	SQL := `UPDATE users
+            SET    archived_at = NULL,
+                   updated_at  = now()
+            WHERE  id = $1
+            AND    archived_at IS NOT NULL
+            AND    archived_at > now() - make_interval(secs => $2::float8)
+            AND    disabled_at IS NULL
+            RETURNING COALESCE(user_uid, '')`
+
+	txErr := database.Tx(func(tx *sqlx.Tx) error {
+		var uid string
+		err := tx.Get(&uid, SQL, userID, grace.Seconds())
+		if err != nil {
+			return err
+		}
+		return updateProvider(uid)
+	})
+	if txErr != nil {
+		logrus.Printf("ReactivateAccount: cannot reactivate user %d:%v", userID, txErr)
+		return txErr
+	}
+	return nil
+}
+
+// ExpiredDeactivations returns up to limit users whose account was deactivated more than grace ago, oldest first,
+// leaving out the ones DeferPurge put off until later
+func ExpiredDeactivations(grace time.Duration, limit int) ([]models.UserIdentity, error) {
+	// language=SQL
+	SQL := `SELECT id,
+                   email,
+                   COALESCE(user_uid, '') as user_uid,
+                   role
+            FROM   users
+            WHERE  archived_at IS NOT NULL
+            AND    archived_at <= now() - make_interval(secs => $1::float8)
+            AND    (purge_next_attempt_at IS NULL OR purge_next_attempt_at <= now())
+            ORDER BY archived_at
+            LIMIT $2`
+
+	users := make([]models.UserIdentity, 0)
+
+	err := database.FirebaseDB.Select(&users, SQL, grace.Seconds(), limit)
+	if err != nil {
+		logrus.Printf("ExpiredDeactivations: cannot get users:%v", err)
+		return users, err
+	}
+	return users, nil
+}
+
+// DeferPurge puts the purge of a user off after it failed, by retryDelay doubled for every earlier failure and at
+// most maxDelay
+func DeferPurge(userID int, retryDelay, maxDelay time.Duration) error {
+	// language=SQL
+	SQL := `UPDATE users
+            SET    purge_attempts        = purge_attempts + 1,
+                   purge_next_attempt_at = now() + make_interval(secs => LEAST($2::float8 * power(2, purge_attempts), $3::float8))
+            WHERE  id = $1`
+
+	_, err := database.FirebaseDB.Exec(SQL, userID, retryDelay.Seconds(), maxDelay.Seconds())
+	if err != nil {
+		logrus.Printf("DeferPurge: cannot defer the purge of %d:%v", userID, err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+package helper
+
+import (
+	"firebaseAuth/apperror"
+	"firebaseAuth/database"
+	"firebaseAuth/models"
+	"firebaseAuth/utilities"
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+	"strings"
+)
+
+var ErrAccountDisabled = apperror.New(apperror.CodeForbidden, "account is disabled")
+
+// SearchUsers lists users for admins, archived and disabled ones included when the filter asks for them
+func SearchUsers(filter models.AdminUserFilter) ([]models.AdminUser, error) {
+	// language=SQL
+	SQL := `SELECT u.id,
+                   COALESCE(u.name, '')     as name,
+                   u.email,
+                   COALESCE(u.phone_no, '') as phone_no,
+                   COALESCE(u.age, 0)       as age,
+                   COALESCE(u.gender, '')   as gender,
+                   u.role,
+                   u.email_verified_at IS NOT NULL as email_verified,
+                   u.created_at,
+                   u.disabled_at,
+                   u.archived_at,
+                   COALESCE(u.user_uid, '') as user_uid
+            FROM   users u
+            WHERE  ($1 = '' OR u.name ILIKE '%' || $1 || '%' OR u.email ILIKE '%' || $1 || '%')
+            AND    ($2 = 'all' OR ($2 = 'true') = (u.archived_at IS NOT NULL))
+            AND    ($3 = '' OR ($3 = 'true') = (u.disabled_at IS NOT NULL))
+            AND    ($4::timestamptz IS NULL OR u.created_at >= $4)
+            AND    ($5::timestamptz IS NULL OR u.created_at < $5)
+            AND    ($6 = '' OR split_part(u.email, '@', 2) = $6)
+            ORDER BY u.id
+            LIMIT $7 OFFSET $8`
+
+	var createdFrom, createdTo interface{}
+	if !filter.CreatedFrom.IsZero() {
+		createdFrom = filter.CreatedFrom
+	}
+	if !filter.CreatedTo.IsZero() {
+		createdTo = filter.CreatedTo
+	}
+	archived := filter.Archived
+	if archived == "" {
+		archived = "false"
+	}
+	emailDomain := strings.ToLower(strings.TrimPrefix(filter.EmailDomain, "@"))
+
+	users := make([]models.AdminUser, 0)
+
+	err := database.FirebaseDB.Select(&users, SQL, escapeLike(filter.Query), archived, filter.Disabled, createdFrom, createdTo,
+		emailDomain, filter.Limit, filter.Limit*filter.Page)
+	if err != nil {
+		logrus.Printf("SearchUsers: cannot search users:%v", err)
+		return users, err
+	}
+	return users, nil
+}
+
+// GetAdminUser returns any user, archived or not, sql.ErrNoRows means there is no such user
+func GetAdminUser(userID int) (models.AdminUser, error) {
+	// language=SQL
+	SQL := `SELECT id,
+                   COALESCE(name, '')     as name,
+                   email,
+                   COALESCE(phone_no, '') as phone_no,
+                   COALESCE(age, 0)       as age,
+                   COALESCE(gender, '')   as gender,
+                   role,
+                   email_verified_at IS NOT NULL as email_verified,
+                   created_at,
+                   disabled_at,
+                   archived_at,
+                   COALESCE(user_uid, '') as user_uid
+            FROM   users
+            WHERE  id = $1`
+
+	var user models.AdminUser
+
+	err := database.FirebaseDB.Get(&user, SQL, userID)
+	if err != nil {
+		logrus.Printf("GetAdminUser: cannot get user %d:%v", userID, err)
+		return user, err
+	}
+	return user, nil
+}
+
+// GetFriendCounts counts the friends, pending friend requests and blocks of a user
+func GetFriendCounts(userID int) (models.FriendCounts, error) {
+	// language=SQL
+	SQL := `SELECT (SELECT COUNT(DISTINCT CASE WHEN fr.request_from = $1 THEN fr.request_to ELSE fr.request_from END)
+                    FROM   friend_request fr
+                    WHERE  (fr.request_from = $1 OR fr.request_to = $1)
+                    AND    fr.status = $2
+                    AND    fr.archived_at IS NULL) as friends,
+                   (SELECT COUNT(*)
+                    FROM   friend_request fr
+                    WHERE  fr.request_from = $1
+                    AND    fr.status = $3
+                    AND    fr.archived_at IS NULL) as pending_sent,
+                   (SELECT COUNT(*)
+                    FROM   friend_request fr
+                    WHERE  fr.request_to = $1
+                    AND    fr.status = $3
+                    AND    fr.archived_at IS NULL) as pending_received,
+                   (SELECT COUNT(*)
+                    FROM   user_blocks ub
+                    WHERE  ub.blocker_id = $1
+                    AND    ub.archived_at IS NULL) as blocked`
+
+	var friendCounts models.FriendCounts
+
+	err := database.FirebaseDB.Get(&friendCounts, SQL, userID, utilities.Accepted, utilities.Pending)
+	if err != nil {
+		logrus.Printf("GetFriendCounts: cannot count friends of %d:%v", userID, err)
+		return friendCounts, err
+	}
+	return friendCounts, nil
+}
+
+// SetDisabled disables or enables a user and calls updateProvider with the user uid inside the transaction, a
+// failure there rolls everything back. Disabling also expires every session and pending two-factor login of the
+// user, it returns how many sessions that ended. sql.ErrNoRows means there is no such active user.
+func SetDisabled(userID int, disabled bool, updateProvider func(uid string) error) (int64, error) {
+	// language=SQL
+	SQL := `UPDATE users
+            SET    disabled_at = CASE WHEN $2 THEN COALESCE(disabled_at, now()) END,
+                   updated_at  = now()
+            WHERE  id = $1
+            AND    archived_at IS NULL
+            RETURNING COALESCE(user_uid, '')`
+
+	var loggedOut int64
+
+	txErr := database.Tx(func(tx *sqlx.Tx) error {
+		var uid string
+		err := tx.Get(&uid, SQL, userID, disabled)
+		if err != nil {
+			return err
+		}
+
+		if disabled {
+			loggedOut, err = expireUserSessions(tx, userID, "")
+			if err != nil {
+				return err
+			}
+
+			// language=SQL
+			challengeSQL := `UPDATE mfa_challenges
+                             SET    used_at = now()
+                             WHERE  user_id = $1
+                             AND    used_at IS NULL`
+			_, err = tx.Exec(challengeSQL, userID)
+			if err != nil {
+				return err
+			}
+		}
+
+		return updateProvider(uid)
+	})
+	if txErr != nil {
+		logrus.Printf("SetDisabled: cannot change user %d:%v", userID, txErr)
+		return 0, txErr
+	}
+	return loggedOut, nil
+}
+
+// LogoutAllSessions expires every active session of the user and returns how many it expired
+func LogoutAllSessions(userID int) (int64, error) {
+	var loggedOut int64
+	txErr := database.Tx(func(tx *sqlx.Tx) error {
+		var err error
+		loggedOut, err = expireUserSessions(tx, userID, "")
+		return err
+	})
+	if txErr != nil {
+		logrus.Printf("LogoutAllSessions: cannot expire sessions of %d:%v", userID, txErr)
+		return 0, txErr
+	}
+	return loggedOut, nil
+}
+
+// escapeLike makes the LIKE wildcards in a search term match themselves
+func escapeLike(term string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(term)
+}
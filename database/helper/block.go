@@ -0,0 +1,122 @@
+package helper
+
+import (
+	"database/sql"
+	"firebaseAuth/apperror"
+	"firebaseAuth/database"
+	"firebaseAuth/models"
+	"firebaseAuth/utilities"
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	ErrSelfBlock   = apperror.New(apperror.CodeBadRequest, "cannot block yourself")
+	ErrUserBlocked = apperror.New(apperror.CodeForbidden, "one of the users has blocked the other")
+)
+
+// BlockUser blocks blockedID for userID and archives any friendship or pending request between the two.
+// Blocking someone who is already blocked is a no-op.
+func BlockUser(userID, blockedID int) error {
+	if userID == blockedID {
+		return ErrSelfBlock
+	}
+
+	// language=SQL
+	lockSQL := `SELECT pg_advisory_xact_lock(LEAST($1::int, $2::int), GREATEST($1::int, $2::int))`
+
+	// language=SQL
+	userSQL := `SELECT EXISTS(SELECT 1
+                              FROM   users
+                              WHERE  id = $1
+                              AND    archived_at IS NULL)`
+
+	// language=SQL
+	blockSQL := `INSERT INTO user_blocks(blocker_id, blocked_id)
+                 VALUES ($1, $2)
+                 ON CONFLICT (blocker_id, blocked_id) WHERE archived_at IS NULL DO NOTHING`
+
+	// language=SQL
+	archiveRequestsSQL := `UPDATE friend_request
+                           SET    archived_at = now(),
+                                  updated_at = now()
+                           WHERE  archived_at IS NULL
+                           AND    status IN ($3, $4)
+                           AND    ((request_from = $1 AND request_to = $2) OR (request_from = $2 AND request_to = $1))`
+
+	err := database.Tx(func(tx *sqlx.Tx) error {
+		_, err := tx.Exec(lockSQL, userID, blockedID)
+		if err != nil {
+			return err
+		}
+
+		var exists bool
+		err = tx.Get(&exists, userSQL, blockedID)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return ErrUserNotFound
+		}
+
+		_, err = tx.Exec(blockSQL, userID, blockedID)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(archiveRequestsSQL, userID, blockedID, utilities.Pending, utilities.Accepted)
+		return err
+	})
+	if err != nil {
+		logrus.Printf("BlockUser: cannot block user:%v", err)
+		return err
+	}
+	return nil
+}
+
+// UnblockUser lifts a block, sql.ErrNoRows means userID had not blocked blockedID
+func UnblockUser(userID, blockedID int) error {
+	// language=SQL
+	SQL := `UPDATE user_blocks
+            SET    archived_at = now()
+            WHERE  blocker_id = $1
+            AND    blocked_id = $2
+            AND    archived_at IS NULL`
+
+	result, err := database.FirebaseDB.Exec(SQL, userID, blockedID)
+	if err != nil {
+		logrus.Printf("UnblockUser: cannot unblock user:%v", err)
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		logrus.Printf("UnblockUser: cannot get affected rows:%v", err)
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func GetBlockedUsers(filterCheck models.FiltersCheck, userID int) ([]models.BlockedUser, error) {
+	// language=SQL
+	SQL := `SELECT u.id                  as user_id,
+                   COALESCE(u.name, '')  as user_name,
+                   ub.created_at         as blocked_at
+            FROM   user_blocks ub
+                   JOIN users u on u.id = ub.blocked_id
+            WHERE  ub.blocker_id = $1
+            AND    ub.archived_at IS NULL
+            ORDER BY ub.created_at DESC
+            LIMIT $2 OFFSET $3`
+
+	blockedUsers := make([]models.BlockedUser, 0)
+
+	err := database.FirebaseDB.Select(&blockedUsers, SQL, userID, filterCheck.Limit, filterCheck.Limit*filterCheck.Page)
+	if err != nil {
+		logrus.Printf("GetBlockedUsers: cannot get blocked users:%v", err)
+		return blockedUsers, err
+	}
+	return blockedUsers, nil
+}
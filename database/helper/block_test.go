@@ -0,0 +1,66 @@
+package helper
+
+import (
+	"database/sql"
+	"firebaseAuth/models"
+	"firebaseAuth/utilities"
+	"github.com/DATA-DOG/go-sqlmock"
+	"testing"
+	"time"
+)
+
+func TestBlockUserArchivesFriendship(t *testing.T) {
+	mock := mockDatabase(t)
+	mock.ExpectBegin()
+	mock.ExpectExec(`pg_advisory_xact_lock`).WithArgs(1, 2).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`FROM\s+users`).WithArgs(2).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectExec(`INSERT INTO user_blocks`).WithArgs(1, 2).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`UPDATE friend_request`).WithArgs(1, 2, utilities.Pending, utilities.Accepted).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	if err := BlockUser(1, 2); err != nil {
+		t.Fatalf("BlockUser: %v", err)
+	}
+}
+
+func TestBlockUserRejects(t *testing.T) {
+	mock := mockDatabase(t)
+	if err := BlockUser(1, 1); err != ErrSelfBlock {
+		t.Fatalf("self block: err = %v, want ErrSelfBlock", err)
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`pg_advisory_xact_lock`).WithArgs(1, 3).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`FROM\s+users`).WithArgs(3).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectRollback()
+	if err := BlockUser(1, 3); err != ErrUserNotFound {
+		t.Fatalf("unknown user: err = %v, want ErrUserNotFound", err)
+	}
+}
+
+func TestUnblockUser(t *testing.T) {
+	mock := mockDatabase(t)
+	mock.ExpectExec(`UPDATE user_blocks`).WithArgs(1, 2).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE user_blocks`).WithArgs(1, 2).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	if err := UnblockUser(1, 2); err != nil {
+		t.Fatalf("UnblockUser: %v", err)
+	}
+	if err := UnblockUser(1, 2); err != sql.ErrNoRows {
+		t.Fatalf("unblock without a block: err = %v, want sql.ErrNoRows", err)
+	}
+}
+
+func TestSendFriendRequestBlocked(t *testing.T) {
+	mock := mockDatabase(t)
+	mock.ExpectBegin()
+	mock.ExpectExec(`pg_advisory_xact_lock`).WithArgs(1, 2).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`FROM\s+users`).WithArgs(2).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectQuery(`FROM\s+user_blocks`).WithArgs(1, 2).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectRollback()
+
+	_, err := SendFriendRequest(models.FriendRequest{RequestTo: 2}, 1, time.Hour)
+	if err != ErrUserBlocked {
+		t.Fatalf("err = %v, want ErrUserBlocked", err)
+	}
+}
@@ -0,0 +1,125 @@
+package helper
+
+import (
+	"database/sql"
+	"firebaseAuth/apperror"
+	"firebaseAuth/database"
+	"firebaseAuth/utilities"
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+var (
+	ErrEmailAlreadyVerified = apperror.New(apperror.CodeConflict, "email address is already verified")
+	ErrEmailNotVerified     = apperror.New(apperror.CodeForbidden, "email address is not verified")
+)
+
+// CreateEmailVerification issues a verification token for the current email of the user, valid for ttl, and
+// returns it with the email it has to be sent to. Older unused tokens of the user stop working.
+func CreateEmailVerification(userID int, ttl time.Duration) (string, string, error) {
+	// language=SQL
+	SQL := `SELECT email,
+                   email_verified_at IS NOT NULL as email_verified
+            FROM   users
+            WHERE  id = $1
+            AND    archived_at IS NULL`
+
+	token, err := utilities.GenerateToken(32)
+	if err != nil {
+		logrus.Printf("CreateEmailVerification: cannot generate token:%v", err)
+		return "", "", err
+	}
+
+	var user struct {
+		Email         string `db:"email"`
+		EmailVerified bool   `db:"email_verified"`
+	}
+	txErr := database.Tx(func(tx *sqlx.Tx) error {
+		err := tx.Get(&user, SQL, userID)
+		if err != nil {
+			return err
+		}
+		if user.EmailVerified {
+			return ErrEmailAlreadyVerified
+		}
+
+		// language=SQL
+		invalidateSQL := `UPDATE email_verifications
+                          SET    used_at = now()
+                          WHERE  user_id = $1
+                          AND    used_at IS NULL`
+		_, err = tx.Exec(invalidateSQL, userID)
+		if err != nil {
+			return err
+		}
+
+		// language=SQL
+		insertSQL := `INSERT INTO email_verifications(user_id, email, token_hash, expires_at)
+                      VALUES ($1, $2, $3, now() + make_interval(secs => $4::float8))`
+		_, err = tx.Exec(insertSQL, userID, user.Email, utilities.HashToken(token), ttl.Seconds())
+		return err
+	})
+	if txErr != nil {
+		logrus.Printf("CreateEmailVerification: cannot create email verification:%v", txErr)
+		return "", "", txErr
+	}
+	return token, user.Email, nil
+}
+
+// VerifyEmail spends a verification token and marks the email of its user as verified, updateProvider runs with
+// the user uid inside the transaction. sql.ErrNoRows means the token is unknown, used, expired or was sent to an
+// address the user no longer has.
+func VerifyEmail(token string, updateProvider func(uid string) error) error {
+	// language=SQL
+	SQL := `SELECT ev.id,
+                   ev.user_id,
+                   COALESCE(u.user_uid, '') as user_uid
+            FROM   email_verifications ev
+                   JOIN users u on u.id = ev.user_id
+            WHERE  ev.token_hash = $1
+            AND    ev.used_at IS NULL
+            AND    ev.expires_at > now()
+            AND    ev.email = u.email
+            AND    u.archived_at IS NULL
+            FOR UPDATE OF ev, u`
+
+	txErr := database.Tx(func(tx *sqlx.Tx) error {
+		var verification struct {
+			ID     int    `db:"id"`
+			UserID int    `db:"user_id"`
+			UID    string `db:"user_uid"`
+		}
+		err := tx.Get(&verification, SQL, utilities.HashToken(token))
+		if err != nil {
+			return err
+		}
+
+		// language=SQL
+		markUsedSQL := `UPDATE email_verifications
+                        SET    used_at = now()
+                        WHERE  id = $1`
+		_, err = tx.Exec(markUsedSQL, verification.ID)
+		if err != nil {
+			return err
+		}
+
+		// language=SQL
+		verifySQL := `UPDATE users
+                      SET    email_verified_at = COALESCE(email_verified_at, now()),
+                             updated_at        = now()
+                      WHERE  id = $1`
+		_, err = tx.Exec(verifySQL, verification.UserID)
+		if err != nil {
+			return err
+		}
+		return updateProvider(verification.UID)
+	})
+	if txErr != nil {
+		if txErr != sql.ErrNoRows {
+			logrus.Printf("VerifyEmail: cannot verify email:%v", txErr)
+		}
+		return txErr
+	}
+	return nil
+}
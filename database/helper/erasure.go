@@ -0,0 +1,124 @@
+package helper
+
+import (
+	"firebaseAuth/database"
+	"firebaseAuth/models"
+	"firebaseAuth/secrets"
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+	"strings"
+)
+
+// EraseUser deletes the user for good, archived and disabled ones included. Every row that references the user
+// goes with it through ON DELETE CASCADE. The audit log has no foreign keys, its entries stay but are anonymised: the
+// user id, the values of changes and the ip and user agent of the user's own requests are blanked out. The tombstone
+// proving the erasure, its email hashed with hashKey, is written in the same transaction and deleteProvider is called
+// with the user uid last, a failure there rolls everything back. requestedBy 0 means nobody asked for it.
+// sql.ErrNoRows means there is no such user.
+func EraseUser(userID, requestedBy int, reason string, hashKey []byte, deleteProvider func(uid string) error) (models.Erasure, error) {
+	// language=SQL
+	SQL := `SELECT id,
+                   email,
+                   COALESCE(user_uid, '') as user_uid,
+                   role
+            FROM   users
+            WHERE  id = $1
+            FOR UPDATE`
+
+	// language=SQL
+	tombstoneSQL := `INSERT INTO erasures(user_id, email_hash, requested_by, reason)
+                     VALUES ($1, $2, $3, $4)
+                     RETURNING id, user_id, email_hash, requested_by, reason, erased_at`
+
+	// language=SQL
+	deleteSQL := `DELETE FROM users WHERE id = $1`
+
+	// audit_log_append_only lets this update through, see migration 0014
+	// language=SQL
+	allowScrubSQL := `SET LOCAL audit.erasing = 'on'`
+
+	// language=SQL
+	scrubSQL := `UPDATE audit_log
+                 SET    actor_id = NULLIF(actor_id, $1),
+                        target_id = NULLIF(target_id, $1),
+                        ip = CASE WHEN actor_id = $1 OR actor_id IS NULL THEN '' ELSE ip END,
+                        user_agent = CASE WHEN actor_id = $1 OR actor_id IS NULL THEN '' ELSE user_agent END,
+                        changes = COALESCE((SELECT jsonb_object_agg(key, 'null'::jsonb) FROM jsonb_each(changes)), '{}')
+                 WHERE  actor_id = $1
+                 OR     target_id = $1
+                 OR     lower(changes->>'email') = $2`
+
+	var requester interface{}
+	if requestedBy != 0 {
+		requester = requestedBy
+	}
+
+	var erasure models.Erasure
+
+	txErr := database.Tx(func(tx *sqlx.Tx) error {
+		var user models.UserIdentity
+		err := tx.Get(&user, SQL, userID)
+		if err != nil {
+			return err
+		}
+
+		err = tx.Get(&erasure, tombstoneSQL, userID, EmailHash(hashKey, user.Email), requester, reason)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(allowScrubSQL)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(scrubSQL, userID, strings.ToLower(user.Email))
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(deleteSQL, userID)
+		if err != nil {
+			return err
+		}
+
+		if user.UID == "" {
+			return nil
+		}
+		return deleteProvider(user.UID)
+	})
+	if txErr != nil {
+		logrus.Printf("EraseUser: cannot erase user %d:%v", userID, txErr)
+		return erasure, txErr
+	}
+	return erasure, nil
+}
+
+// GetErasures returns the tombstones of the user id or email hash, zero values do not filter
+func GetErasures(userID int, emailHash string) ([]models.Erasure, error) {
+	// language=SQL
+	SQL := `SELECT id,
+                   user_id,
+                   email_hash,
+                   requested_by,
+                   reason,
+                   erased_at
+            FROM   erasures
+            WHERE  ($1 = 0 OR user_id = $1)
+            AND    ($2 = '' OR email_hash = $2)
+            ORDER BY erased_at DESC`
+
+	erasures := make([]models.Erasure, 0)
+
+	err := database.FirebaseDB.Select(&erasures, SQL, userID, emailHash)
+	if err != nil {
+		logrus.Printf("GetErasures: cannot get erasures:%v", err)
+		return erasures, err
+	}
+	return erasures, nil
+}
+
+// EmailHash is how an erased email is kept in its tombstone, an HMAC under the configured erasure key
+func EmailHash(hashKey []byte, email string) string {
+	return secrets.MAC(hashKey, strings.ToLower(strings.TrimSpace(email)))
+}
@@ -0,0 +1,80 @@
+package helper
+
+import (
+	"bytes"
+	"errors"
+	"firebaseAuth/models"
+	"firebaseAuth/secrets"
+	"github.com/DATA-DOG/go-sqlmock"
+	"testing"
+	"time"
+)
+
+var testErasureKey = bytes.Repeat([]byte{3}, secrets.KeySize)
+
+// expectErasure queues the queries EraseUser runs for user 42 up to the delete, the caller finishes the transaction
+func expectErasure(mock sqlmock.Sqlmock, requestedBy interface{}) {
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FROM\s+users\s+WHERE\s+id = \$1\s+FOR UPDATE`).WithArgs(42).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "user_uid", "role"}).AddRow(42, "Someone@Example.com", "uid-42", models.RoleUser))
+	mock.ExpectQuery(`INSERT INTO erasures`).
+		WithArgs(42, EmailHash(testErasureKey, "someone@example.com"), requestedBy, models.ErasureUserRequest).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "email_hash", "requested_by", "reason", "erased_at"}).
+			AddRow(5, 42, EmailHash(testErasureKey, "someone@example.com"), requestedBy, models.ErasureUserRequest, time.Now()))
+	mock.ExpectExec(`SET LOCAL audit.erasing = 'on'`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`UPDATE audit_log`).WithArgs(42, "someone@example.com").WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectExec(`DELETE FROM users`).WithArgs(42).WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+func TestEraseUser(t *testing.T) {
+	mock := mockDatabase(t)
+	expectErasure(mock, 42)
+	mock.ExpectCommit()
+
+	var deleted string
+	erasure, err := EraseUser(42, 42, models.ErasureUserRequest, testErasureKey, func(uid string) error {
+		deleted = uid
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("EraseUser: %v", err)
+	}
+	if deleted != "uid-42" {
+		t.Errorf("provider delete got %q, want uid-42", deleted)
+	}
+	if erasure.ID != 5 || erasure.EmailHash == "someone@example.com" {
+		t.Errorf("erasure = %+v, want tombstone 5 with the hashed email", erasure)
+	}
+}
+
+func TestEraseUserWithoutRequester(t *testing.T) {
+	mock := mockDatabase(t)
+	expectErasure(mock, nil)
+	mock.ExpectCommit()
+
+	_, err := EraseUser(42, 0, models.ErasureUserRequest, testErasureKey, func(uid string) error { return nil })
+	if err != nil {
+		t.Fatalf("EraseUser: %v", err)
+	}
+}
+
+func TestEraseUserProviderFailureRollsBack(t *testing.T) {
+	mock := mockDatabase(t)
+	expectErasure(mock, 42)
+	mock.ExpectRollback()
+
+	providerErr := errors.New("provider unavailable")
+	_, err := EraseUser(42, 42, models.ErasureUserRequest, testErasureKey, func(uid string) error { return providerErr })
+	if err != providerErr {
+		t.Fatalf("err = %v, want the provider error", err)
+	}
+}
+
+func TestEmailHash(t *testing.T) {
+	if EmailHash(testErasureKey, " Someone@Example.com ") != EmailHash(testErasureKey, "someone@example.com") {
+		t.Error("EmailHash does not normalise the email")
+	}
+	if EmailHash(testErasureKey, "someone@example.com") == EmailHash(bytes.Repeat([]byte{4}, secrets.KeySize), "someone@example.com") {
+		t.Error("EmailHash does not depend on the key")
+	}
+}
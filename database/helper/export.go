@@ -0,0 +1,299 @@
+package helper
+
+import (
+	"database/sql"
+	"firebaseAuth/database"
+	"firebaseAuth/models"
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+// GetExportUser returns the users row of any user, archived and disabled ones included, without the password hash
+func GetExportUser(userID int) (models.ExportUser, error) {
+	// language=SQL
+	SQL := `SELECT id,
+                   name,
+                   email,
+                   phone_no,
+                   age,
+                   gender,
+                   role,
+                   user_uid,
+                   email_verified_at,
+                   created_at,
+                   updated_at,
+                   disabled_at,
+                   archived_at
+            FROM   users
+            WHERE  id = $1`
+
+	var user models.ExportUser
+
+	err := database.FirebaseDB.Get(&user, SQL, userID)
+	if err != nil {
+		logrus.Printf("GetExportUser: cannot get user %d:%v", userID, err)
+		return user, err
+	}
+	return user, nil
+}
+
+// GetAllSessions returns every session of the user, expired ones included, newest first
+func GetAllSessions(userID int) ([]models.Session, error) {
+	// language=SQL
+	SQL := `SELECT session_uid,
+                   COALESCE(device_name, '') as device_name,
+                   COALESCE(ip_address, '')  as ip_address,
+                   COALESCE(user_agent, '')  as user_agent,
+                   created_at,
+                   updated_at,
+                   expires_at
+            FROM   sessions
+            WHERE  user_id = $1
+            ORDER BY created_at DESC`
+
+	sessions := make([]models.Session, 0)
+
+	err := database.FirebaseDB.Select(&sessions, SQL, userID)
+	if err != nil {
+		logrus.Printf("GetAllSessions: cannot get sessions of %d:%v", userID, err)
+		return sessions, err
+	}
+	return sessions, nil
+}
+
+// GetExportFriendRequests returns every friend request the user sent or received, archived ones included
+func GetExportFriendRequests(userID int) ([]models.ExportFriendRequest, error) {
+	// language=SQL
+	SQL := `SELECT id,
+                   request_from,
+                   request_to,
+                   status,
+                   created_at,
+                   updated_at,
+                   archived_at
+            FROM   friend_request
+            WHERE  request_from = $1
+            OR     request_to = $1
+            ORDER BY id`
+
+	requests := make([]models.ExportFriendRequest, 0)
+
+	err := database.FirebaseDB.Select(&requests, SQL, userID)
+	if err != nil {
+		logrus.Printf("GetExportFriendRequests: cannot get friend requests of %d:%v", userID, err)
+		return requests, err
+	}
+	return requests, nil
+}
+
+// GetExportBlocks returns every block the user made or received, lifted ones included
+func GetExportBlocks(userID int) ([]models.ExportBlock, error) {
+	// language=SQL
+	SQL := `SELECT id,
+                   blocker_id,
+                   blocked_id,
+                   created_at,
+                   archived_at
+            FROM   user_blocks
+            WHERE  blocker_id = $1
+            OR     blocked_id = $1
+            ORDER BY id`
+
+	blocks := make([]models.ExportBlock, 0)
+
+	err := database.FirebaseDB.Select(&blocks, SQL, userID)
+	if err != nil {
+		logrus.Printf("GetExportBlocks: cannot get blocks of %d:%v", userID, err)
+		return blocks, err
+	}
+	return blocks, nil
+}
+
+// GetExportMFA describes the two-factor setup of the user without its secrets
+func GetExportMFA(userID int) (models.ExportMFA, error) {
+	// language=SQL
+	SQL := `SELECT EXISTS(SELECT 1 FROM user_mfa WHERE user_id = $1)            as enrolled,
+                   (SELECT confirmed_at FROM user_mfa WHERE user_id = $1)       as confirmed_at,
+                   (SELECT COUNT(*)
+                    FROM   mfa_recovery_codes
+                    WHERE  user_id = $1
+                    AND    used_at IS NULL)                                     as recovery_codes_unused,
+                   (SELECT COUNT(*)
+                    FROM   mfa_recovery_codes
+                    WHERE  user_id = $1
+                    AND    used_at IS NOT NULL)                                 as recovery_codes_used`
+
+	var mfa models.ExportMFA
+
+	err := database.FirebaseDB.Get(&mfa, SQL, userID)
+	if err != nil {
+		logrus.Printf("GetExportMFA: cannot get mfa of %d:%v", userID, err)
+		return mfa, err
+	}
+	return mfa, nil
+}
+
+// CountExportRows estimates the size of an export by the number of rows it holds
+func CountExportRows(userID int) (int, error) {
+	// language=SQL
+	SQL := `SELECT (SELECT COUNT(*) FROM sessions WHERE user_id = $1) +
+                   (SELECT COUNT(*) FROM friend_request WHERE request_from = $1 OR request_to = $1) +
+                   (SELECT COUNT(*) FROM user_blocks WHERE blocker_id = $1 OR blocked_id = $1) +
+                   (SELECT COUNT(*) FROM audit_log WHERE actor_id = $1 OR target_id = $1)`
+
+	var rows int
+
+	err := database.FirebaseDB.Get(&rows, SQL, userID)
+	if err != nil {
+		logrus.Printf("CountExportRows: cannot count rows of %d:%v", userID, err)
+		return rows, err
+	}
+	return rows, nil
+}
+
+// CreateExportJob queues an export of the user. While one is still pending or running it returns that one instead.
+func CreateExportJob(userID int) (models.ExportJob, error) {
+	// language=SQL
+	SQL := `INSERT INTO export_jobs(user_id)
+            VALUES ($1)
+            ON CONFLICT (user_id) WHERE status IN ('pending', 'running') DO NOTHING
+            RETURNING id, user_id, status, error, created_at, started_at, finished_at, expires_at`
+
+	// language=SQL
+	activeSQL := `SELECT id, user_id, status, error, created_at, started_at, finished_at, expires_at
+                  FROM   export_jobs
+                  WHERE  user_id = $1
+                  AND    status IN ('pending', 'running')`
+
+	var job models.ExportJob
+
+	err := database.FirebaseDB.Get(&job, SQL, userID)
+	if err == sql.ErrNoRows {
+		err = database.FirebaseDB.Get(&job, activeSQL, userID)
+	}
+	if err != nil {
+		logrus.Printf("CreateExportJob: cannot queue export of %d:%v", userID, err)
+		return job, err
+	}
+	return job, nil
+}
+
+// GetExportJob returns an export job of the user, sql.ErrNoRows means the user has no such job or it expired
+func GetExportJob(userID, jobID int) (models.ExportJob, error) {
+	// language=SQL
+	SQL := `SELECT id, user_id, status, error, created_at, started_at, finished_at, expires_at
+            FROM   export_jobs
+            WHERE  id = $1
+            AND    user_id = $2
+            AND    (expires_at IS NULL OR expires_at > now())`
+
+	var job models.ExportJob
+
+	err := database.FirebaseDB.Get(&job, SQL, jobID, userID)
+	if err != nil {
+		logrus.Printf("GetExportJob: cannot get export job %d:%v", jobID, err)
+		return job, err
+	}
+	return job, nil
+}
+
+// GetExportArchive returns the archive of a finished export job of the user, sql.ErrNoRows means there is no such
+// job, it is not done or it expired
+func GetExportArchive(userID, jobID int) ([]byte, error) {
+	// language=SQL
+	SQL := `SELECT archive
+            FROM   export_jobs
+            WHERE  id = $1
+            AND    user_id = $2
+            AND    status = 'done'
+            AND    expires_at > now()`
+
+	var archive []byte
+
+	err := database.FirebaseDB.Get(&archive, SQL, jobID, userID)
+	if err != nil {
+		logrus.Printf("GetExportArchive: cannot get archive of export job %d:%v", jobID, err)
+		return archive, err
+	}
+	return archive, nil
+}
+
+// ClaimExportJob marks the oldest pending export job as running and returns it. A job running for longer than
+// staleAfter is taken to belong to a worker that died and is claimed again. sql.ErrNoRows means there is no work.
+func ClaimExportJob(staleAfter time.Duration) (models.ExportJob, error) {
+	// language=SQL
+	SQL := `UPDATE export_jobs
+            SET    status     = 'running',
+                   started_at = now()
+            WHERE  id = (SELECT id
+                         FROM   export_jobs
+                         WHERE  status = 'pending'
+                         OR     (status = 'running' AND started_at < now() - make_interval(secs => $1::float8))
+                         ORDER BY created_at
+                         LIMIT 1
+                         FOR UPDATE SKIP LOCKED)
+            RETURNING id, user_id, status, error, created_at, started_at, finished_at, expires_at`
+
+	var job models.ExportJob
+
+	err := database.FirebaseDB.Get(&job, SQL, staleAfter.Seconds())
+	if err != nil {
+		if err != sql.ErrNoRows {
+			logrus.Printf("ClaimExportJob: cannot claim export job:%v", err)
+		}
+		return job, err
+	}
+	return job, nil
+}
+
+// FinishExportJob stores the archive of a running job, it can be downloaded for ttl
+func FinishExportJob(jobID int, archive []byte, ttl time.Duration) error {
+	// language=SQL
+	SQL := `UPDATE export_jobs
+            SET    status      = 'done',
+                   archive     = $2,
+                   finished_at = now(),
+                   expires_at  = now() + make_interval(secs => $3::float8)
+            WHERE  id = $1
+            AND    status = 'running'`
+
+	_, err := database.FirebaseDB.Exec(SQL, jobID, archive, ttl.Seconds())
+	if err != nil {
+		logrus.Printf("FinishExportJob: cannot finish export job %d:%v", jobID, err)
+		return err
+	}
+	return nil
+}
+
+// FailExportJob marks a running job as failed, the status stays visible for ttl so the user can ask again
+func FailExportJob(jobID int, reason string, ttl time.Duration) error {
+	// language=SQL
+	SQL := `UPDATE export_jobs
+            SET    status      = 'failed',
+                   error       = $2,
+                   finished_at = now(),
+                   expires_at  = now() + make_interval(secs => $3::float8)
+            WHERE  id = $1
+            AND    status = 'running'`
+
+	_, err := database.FirebaseDB.Exec(SQL, jobID, reason, ttl.Seconds())
+	if err != nil {
+		logrus.Printf("FailExportJob: cannot fail export job %d:%v", jobID, err)
+		return err
+	}
+	return nil
+}
+
+// DeleteExpiredExports deletes the export jobs, and their archives, that expired
+func DeleteExpiredExports() (int64, error) {
+	// language=SQL
+	SQL := `DELETE FROM export_jobs
+            WHERE  expires_at <= now()`
+
+	result, err := database.FirebaseDB.Exec(SQL)
+	if err != nil {
+		logrus.Printf("DeleteExpiredExports: cannot delete expired exports:%v", err)
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,399 @@
+package helper
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"firebaseAuth/apperror"
+	"firebaseAuth/database"
+	"firebaseAuth/models"
+	"firebaseAuth/secrets"
+	"firebaseAuth/totp"
+	"firebaseAuth/utilities"
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	recoveryCodeCount = 10
+	// totpSkew accepts the code of the previous and the next time step too, for clients with a drifting clock
+	totpSkew = 1
+)
+
+var (
+	ErrMFAAlreadyEnabled = apperror.New(apperror.CodeConflict, "two-factor authentication is already enabled")
+	ErrMFANotEnabled     = apperror.New(apperror.CodeNotFound, "two-factor authentication is not enabled")
+	ErrMFANotEnrolling   = apperror.New(apperror.CodeNotFound, "no two-factor enrollment in progress")
+	ErrInvalidMFACode    = apperror.New(apperror.CodeForbidden, "invalid two-factor code")
+)
+
+// StartTOTPEnrollment stores a new unconfirmed TOTP secret for the user, sealed with box, replacing an earlier
+// unconfirmed one
+func StartTOTPEnrollment(userID int, secret string, box *secrets.Box) error {
+	// language=SQL
+	SQL := `INSERT INTO user_mfa(user_id, totp_secret)
+            VALUES ($1, $2)
+            ON CONFLICT (user_id) DO UPDATE
+            SET    totp_secret = EXCLUDED.totp_secret,
+                   updated_at  = now()
+            WHERE  user_mfa.confirmed_at IS NULL`
+
+	sealed, err := box.Seal(secret)
+	if err != nil {
+		logrus.Printf("StartTOTPEnrollment: cannot seal secret:%v", err)
+		return err
+	}
+
+	result, err := database.FirebaseDB.Exec(SQL, userID, sealed)
+	if err != nil {
+		logrus.Printf("StartTOTPEnrollment: cannot store secret:%v", err)
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		logrus.Printf("StartTOTPEnrollment: cannot get affected rows:%v", err)
+		return err
+	}
+	if rows == 0 {
+		return ErrMFAAlreadyEnabled
+	}
+	return nil
+}
+
+// ConfirmTOTP turns two-factor authentication on once the user proves the app produces codes for the enrolled
+// secret, and returns a fresh set of recovery codes. They are only stored hashed, so this is the one time they
+// can be shown.
+func ConfirmTOTP(userID int, code string, box *secrets.Box) ([]string, error) {
+	// language=SQL
+	SQL := `SELECT totp_secret
+            FROM   user_mfa
+            WHERE  user_id = $1
+            AND    confirmed_at IS NULL
+            FOR UPDATE`
+
+	var recoveryCodes []string
+	txErr := database.Tx(func(tx *sqlx.Tx) error {
+		var sealed string
+		err := tx.Get(&sealed, SQL, userID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return ErrMFANotEnrolling
+			}
+			return err
+		}
+		secret, err := box.Open(sealed)
+		if err != nil {
+			return err
+		}
+
+		step, ok := totp.Validate(secret, strings.TrimSpace(code), time.Now(), totpSkew)
+		if !ok {
+			return ErrInvalidMFACode
+		}
+
+		// language=SQL
+		confirmSQL := `UPDATE user_mfa
+                       SET    confirmed_at   = now(),
+                              last_used_step = $2,
+                              updated_at     = now()
+                       WHERE  user_id = $1`
+		_, err = tx.Exec(confirmSQL, userID, step)
+		if err != nil {
+			return err
+		}
+
+		recoveryCodes, err = replaceRecoveryCodes(tx, userID, box)
+		return err
+	})
+	if txErr != nil {
+		logrus.Printf("ConfirmTOTP: cannot confirm two-factor authentication:%v", txErr)
+		return nil, txErr
+	}
+	return recoveryCodes, nil
+}
+
+// DisableMFA turns two-factor authentication off after checking a current TOTP or recovery code
+func DisableMFA(userID int, code string, box *secrets.Box) error {
+	txErr := database.Tx(func(tx *sqlx.Tx) error {
+		err := checkMFACode(tx, userID, code, box)
+		if err != nil {
+			return err
+		}
+
+		// language=SQL
+		deleteCodesSQL := `DELETE FROM mfa_recovery_codes
+                           WHERE  user_id = $1`
+		_, err = tx.Exec(deleteCodesSQL, userID)
+		if err != nil {
+			return err
+		}
+
+		// language=SQL
+		deleteSQL := `DELETE FROM user_mfa
+                      WHERE  user_id = $1`
+		_, err = tx.Exec(deleteSQL, userID)
+		return err
+	})
+	if txErr != nil {
+		logrus.Printf("DisableMFA: cannot disable two-factor authentication:%v", txErr)
+		return txErr
+	}
+	return nil
+}
+
+func MFAEnabled(userID int) (bool, error) {
+	// language=SQL
+	SQL := `SELECT EXISTS(SELECT 1
+                          FROM   user_mfa
+                          WHERE  user_id = $1
+                          AND    confirmed_at IS NOT NULL)`
+
+	var enabled bool
+
+	err := database.FirebaseDB.Get(&enabled, SQL, userID)
+	if err != nil {
+		logrus.Printf("MFAEnabled: cannot check two-factor authentication:%v", err)
+		return false, err
+	}
+	return enabled, nil
+}
+
+// CreateMFAChallenge is the proof that the password step of a login passed, the second step spends it
+func CreateMFAChallenge(userID int, deviceName string, ttl time.Duration) (string, error) {
+	// language=SQL
+	SQL := `INSERT INTO mfa_challenges(user_id, token_hash, device_name, expires_at)
+            VALUES ($1, $2, $3, now() + make_interval(secs => $4::float8))`
+
+	token, err := utilities.GenerateToken(32)
+	if err != nil {
+		logrus.Printf("CreateMFAChallenge: cannot generate token:%v", err)
+		return "", err
+	}
+
+	_, err = database.FirebaseDB.Exec(SQL, userID, utilities.HashToken(token), deviceName, ttl.Seconds())
+	if err != nil {
+		logrus.Printf("CreateMFAChallenge: cannot create challenge:%v", err)
+		return "", err
+	}
+	return token, nil
+}
+
+// MFAChallengeUser returns the user of a login challenge that can still be claimed, so its lockout can be checked
+// first. sql.ErrNoRows means the challenge is unknown, used, expired or out of attempts.
+func MFAChallengeUser(token string, maxAttempts int) (int, error) {
+	// language=SQL
+	SQL := `SELECT user_id
+            FROM   mfa_challenges
+            WHERE  token_hash = $1
+            AND    used_at IS NULL
+            AND    expires_at > now()
+            AND    attempts < $2`
+
+	var userID int
+
+	err := database.FirebaseDB.Get(&userID, SQL, utilities.HashToken(token), maxAttempts)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			logrus.Printf("MFAChallengeUser: cannot get challenge:%v", err)
+		}
+		return 0, err
+	}
+	return userID, nil
+}
+
+// ClaimMFAChallenge spends a login challenge with a TOTP or recovery code. A wrong code counts as an attempt and
+// after maxAttempts the challenge stops working. sql.ErrNoRows means the challenge is unknown, used, expired or
+// out of attempts.
+func ClaimMFAChallenge(token, code string, maxAttempts int, box *secrets.Box) (models.MFAChallenge, error) {
+	// language=SQL
+	SQL := `SELECT id,
+                   user_id,
+                   COALESCE(device_name, '') as device_name
+            FROM   mfa_challenges
+            WHERE  token_hash = $1
+            AND    used_at IS NULL
+            AND    expires_at > now()
+            AND    attempts < $2
+            FOR UPDATE`
+
+	var challenge models.MFAChallenge
+	wrongCode := false
+
+	txErr := database.Tx(func(tx *sqlx.Tx) error {
+		var row struct {
+			ID         int    `db:"id"`
+			UserID     int    `db:"user_id"`
+			DeviceName string `db:"device_name"`
+		}
+		err := tx.Get(&row, SQL, utilities.HashToken(token), maxAttempts)
+		if err != nil {
+			return err
+		}
+
+		// set before the code is checked so a wrong code still tells the caller whose login failed
+		challenge = models.MFAChallenge{UserID: row.UserID, DeviceName: row.DeviceName}
+
+		err = checkMFACode(tx, row.UserID, code, box)
+		if err == ErrInvalidMFACode {
+			// the failed attempt has to be committed, so the error is only returned after the transaction
+			wrongCode = true
+			// language=SQL
+			attemptSQL := `UPDATE mfa_challenges
+                           SET    attempts = attempts + 1
+                           WHERE  id = $1`
+			_, err = tx.Exec(attemptSQL, row.ID)
+			return err
+		}
+		if err != nil {
+			return err
+		}
+
+		// language=SQL
+		markUsedSQL := `UPDATE mfa_challenges
+                        SET    used_at = now()
+                        WHERE  id = $1`
+		_, err = tx.Exec(markUsedSQL, row.ID)
+		return err
+	})
+	if txErr != nil {
+		if txErr != sql.ErrNoRows {
+			logrus.Printf("ClaimMFAChallenge: cannot claim challenge:%v", txErr)
+		}
+		return models.MFAChallenge{}, txErr
+	}
+	if wrongCode {
+		return challenge, ErrInvalidMFACode
+	}
+	return challenge, nil
+}
+
+// checkMFACode accepts a TOTP code newer than the last accepted one, or an unused recovery code which it spends
+func checkMFACode(tx *sqlx.Tx, userID int, code string, box *secrets.Box) error {
+	// language=SQL
+	SQL := `SELECT totp_secret,
+                   COALESCE(last_used_step, 0) as last_used_step
+            FROM   user_mfa
+            WHERE  user_id = $1
+            AND    confirmed_at IS NOT NULL
+            FOR UPDATE`
+
+	var mfa struct {
+		Secret       string `db:"totp_secret"`
+		LastUsedStep int64  `db:"last_used_step"`
+	}
+	err := tx.Get(&mfa, SQL, userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrMFANotEnabled
+		}
+		return err
+	}
+
+	code = strings.TrimSpace(code)
+	if len(code) == totp.Digits {
+		secret, err := box.Open(mfa.Secret)
+		if err != nil {
+			return err
+		}
+		step, ok := totp.Validate(secret, code, time.Now(), totpSkew)
+		// a code that was already accepted once could have been seen by someone else
+		if !ok || step <= mfa.LastUsedStep {
+			return ErrInvalidMFACode
+		}
+
+		// language=SQL
+		stepSQL := `UPDATE user_mfa
+                    SET    last_used_step = $2,
+                           updated_at     = now()
+                    WHERE  user_id = $1`
+		_, err = tx.Exec(stepSQL, userID, step)
+		return err
+	}
+
+	// language=SQL
+	recoverySQL := `UPDATE mfa_recovery_codes
+                    SET    used_at = now()
+                    WHERE  user_id = $1
+                    AND    code_hash = $2
+                    AND    used_at IS NULL`
+	result, err := tx.Exec(recoverySQL, userID, recoveryCodeHash(box, userID, code))
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+func replaceRecoveryCodes(tx *sqlx.Tx, userID int, box *secrets.Box) ([]string, error) {
+	// language=SQL
+	deleteSQL := `DELETE FROM mfa_recovery_codes
+                  WHERE  user_id = $1`
+	_, err := tx.Exec(deleteSQL, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// language=SQL
+	insertSQL := `INSERT INTO mfa_recovery_codes(user_id, code_hash)
+                  VALUES ($1, $2)`
+
+	recoveryCodes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		recoveryCode, err := generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		_, err = tx.Exec(insertSQL, userID, recoveryCodeHash(box, userID, recoveryCode))
+		if err != nil {
+			return nil, err
+		}
+		recoveryCodes = append(recoveryCodes, recoveryCode)
+	}
+	return recoveryCodes, nil
+}
+
+// generateRecoveryCode returns 50 random bits as two groups of five base32 characters, e.g. "k3j9x-pq2mz"
+func generateRecoveryCode() (string, error) {
+	bytes := make([]byte, 10)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	code := strings.ToLower(base32.StdEncoding.EncodeToString(bytes))[:10]
+	return code[:5] + "-" + code[5:], nil
+}
+
+// recoveryCodeHash is how a recovery code is stored. A code has only 50 bits and a plain hash of it could be brute
+// forced from a database dump, so it is keyed with the MFA key and bound to the user.
+func recoveryCodeHash(box *secrets.Box, userID int, code string) string {
+	return box.MAC(strconv.Itoa(userID) + ":" + normalizeRecoveryCode(code))
+}
+
+// normalizeRecoveryCode lets users type a recovery code with or without the dash and in any case
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
+
+// PurgeMFAChallenges deletes login challenges that expired more than retention ago
+func PurgeMFAChallenges(retention time.Duration) (int64, error) {
+	// language=SQL
+	SQL := `DELETE FROM mfa_challenges
+            WHERE  expires_at < now() - make_interval(secs => $1::float8)`
+
+	result, err := database.FirebaseDB.Exec(SQL, retention.Seconds())
+	if err != nil {
+		logrus.Printf("PurgeMFAChallenges: cannot delete expired challenges:%v", err)
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,110 @@
+package helper
+
+import (
+	"bytes"
+	"firebaseAuth/secrets"
+	"firebaseAuth/totp"
+	"github.com/DATA-DOG/go-sqlmock"
+	"testing"
+	"time"
+)
+
+const testTOTPSecret = "JBSWY3DPEHPK3PXP"
+
+func testMFA(t *testing.T) (*secrets.Box, string) {
+	t.Helper()
+	box, err := secrets.NewBox(bytes.Repeat([]byte{1}, secrets.KeySize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := box.Seal(testTOTPSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return box, sealed
+}
+
+func expectMFARow(mock sqlmock.Sqlmock, sealed string, lastUsedStep int64) {
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FROM\s+user_mfa`).WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"totp_secret", "last_used_step"}).AddRow(sealed, lastUsedStep))
+}
+
+func expectMFADeleted(mock sqlmock.Sqlmock) {
+	mock.ExpectExec(`DELETE FROM mfa_recovery_codes`).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 10))
+	mock.ExpectExec(`DELETE FROM user_mfa`).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+}
+
+func TestDisableMFAWithTOTPCode(t *testing.T) {
+	box, sealed := testMFA(t)
+	step := totp.Step(time.Now())
+	code, err := totp.Code(testTOTPSecret, step)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mock := mockDatabase(t)
+	expectMFARow(mock, sealed, step-2)
+	mock.ExpectExec(`UPDATE user_mfa`).WithArgs(1, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+	expectMFADeleted(mock)
+
+	if err := DisableMFA(1, code, box); err != nil {
+		t.Fatalf("DisableMFA: %v", err)
+	}
+}
+
+func TestDisableMFARejectsReplayedStep(t *testing.T) {
+	box, sealed := testMFA(t)
+	step := totp.Step(time.Now())
+	code, err := totp.Code(testTOTPSecret, step)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mock := mockDatabase(t)
+	expectMFARow(mock, sealed, step)
+	mock.ExpectRollback()
+
+	if err := DisableMFA(1, code, box); err != ErrInvalidMFACode {
+		t.Fatalf("err = %v, want ErrInvalidMFACode for a code of an already used step", err)
+	}
+}
+
+func TestDisableMFAWithRecoveryCode(t *testing.T) {
+	box, sealed := testMFA(t)
+
+	mock := mockDatabase(t)
+	expectMFARow(mock, sealed, 0)
+	mock.ExpectExec(`UPDATE mfa_recovery_codes`).WithArgs(1, recoveryCodeHash(box, 1, "abcd-efgh")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectMFADeleted(mock)
+
+	if err := DisableMFA(1, " ABCD-EFGH ", box); err != nil {
+		t.Fatalf("DisableMFA: %v", err)
+	}
+
+	expectMFARow(mock, sealed, 0)
+	mock.ExpectExec(`UPDATE mfa_recovery_codes`).WithArgs(1, recoveryCodeHash(box, 1, "abcd-efgh")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	if err := DisableMFA(1, "abcd-efgh", box); err != ErrInvalidMFACode {
+		t.Fatalf("err = %v, want ErrInvalidMFACode for a spent recovery code", err)
+	}
+}
+
+func TestRecoveryCodeHash(t *testing.T) {
+	box, _ := testMFA(t)
+
+	if recoveryCodeHash(box, 1, "abcd-efgh") == recoveryCodeHash(box, 2, "abcd-efgh") {
+		t.Error("recovery code hash does not depend on the user")
+	}
+	other, err := secrets.NewBox(bytes.Repeat([]byte{2}, secrets.KeySize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recoveryCodeHash(box, 1, "abcd-efgh") == recoveryCodeHash(other, 1, "abcd-efgh") {
+		t.Error("recovery code hash does not depend on the MFA key")
+	}
+}
@@ -0,0 +1,170 @@
+package helper
+
+import (
+	"database/sql"
+	"firebaseAuth/database"
+	"firebaseAuth/utilities"
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+	"time"
+)
+
+// CreatePasswordReset issues a reset token for the active user with this email, valid for ttl. Older unused tokens
+// of the user stop working. sql.ErrNoRows means there is no such user.
+func CreatePasswordReset(email string, ttl time.Duration) (string, error) {
+	// language=SQL
+	SQL := `SELECT id
+            FROM   users
+            WHERE  email = $1
+            AND    archived_at IS NULL`
+
+	token, err := utilities.GenerateToken(32)
+	if err != nil {
+		logrus.Printf("CreatePasswordReset: cannot generate token:%v", err)
+		return "", err
+	}
+
+	txErr := database.Tx(func(tx *sqlx.Tx) error {
+		var userID int
+		err := tx.Get(&userID, SQL, strings.ToLower(email))
+		if err != nil {
+			return err
+		}
+
+		// language=SQL
+		invalidateSQL := `UPDATE password_resets
+                          SET    used_at = now()
+                          WHERE  user_id = $1
+                          AND    used_at IS NULL`
+		_, err = tx.Exec(invalidateSQL, userID)
+		if err != nil {
+			return err
+		}
+
+		// language=SQL
+		insertSQL := `INSERT INTO password_resets(user_id, token_hash, expires_at)
+                      VALUES ($1, $2, now() + make_interval(secs => $3::float8))`
+		_, err = tx.Exec(insertSQL, userID, utilities.HashToken(token), ttl.Seconds())
+		return err
+	})
+	if txErr != nil {
+		if txErr != sql.ErrNoRows {
+			logrus.Printf("CreatePasswordReset: cannot create password reset:%v", txErr)
+		}
+		return "", txErr
+	}
+	return token, nil
+}
+
+// ResetPassword spends a reset token: it stores the bcrypt hash of password, expires every session of the user and
+// calls updateProvider with the user uid inside the transaction, a failure there rolls everything back.
+// sql.ErrNoRows means the token is unknown, used or expired.
+func ResetPassword(token, password string, updateProvider func(uid string) error) (int, error) {
+	// language=SQL
+	SQL := `SELECT pr.id,
+                   pr.user_id,
+                   COALESCE(u.user_uid, '') as user_uid
+            FROM   password_resets pr
+                   JOIN users u on u.id = pr.user_id
+            WHERE  pr.token_hash = $1
+            AND    pr.used_at IS NULL
+            AND    pr.expires_at > now()
+            AND    u.archived_at IS NULL
+            FOR UPDATE OF pr`
+
+	hashPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		logrus.Printf("ResetPassword: Not able to hash password:%v", err)
+		return 0, err
+	}
+
+	var userID int
+	txErr := database.Tx(func(tx *sqlx.Tx) error {
+		var reset struct {
+			ID     int    `db:"id"`
+			UserID int    `db:"user_id"`
+			UID    string `db:"user_uid"`
+		}
+		err := tx.Get(&reset, SQL, utilities.HashToken(token))
+		if err != nil {
+			return err
+		}
+		userID = reset.UserID
+
+		// language=SQL
+		markUsedSQL := `UPDATE password_resets
+                        SET    used_at = now()
+                        WHERE  id = $1`
+		_, err = tx.Exec(markUsedSQL, reset.ID)
+		if err != nil {
+			return err
+		}
+
+		err = setPassword(tx, reset.UserID, hashPassword)
+		if err != nil {
+			return err
+		}
+
+		_, err = expireUserSessions(tx, reset.UserID, "")
+		if err != nil {
+			return err
+		}
+		return updateProvider(reset.UID)
+	})
+	if txErr != nil {
+		if txErr != sql.ErrNoRows {
+			logrus.Printf("ResetPassword: cannot reset password:%v", txErr)
+		}
+		return userID, txErr
+	}
+	return userID, nil
+}
+
+// ChangePassword stores the bcrypt hash of password for the user and calls updateProvider with the user uid inside
+// the transaction. With logoutOthers set every other session than keepSessionID is expired, their count is returned.
+func ChangePassword(userID int, password string, keepSessionID string, logoutOthers bool, updateProvider func(uid string) error) (int64, error) {
+	hashPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		logrus.Printf("ChangePassword: Not able to hash password:%v", err)
+		return 0, err
+	}
+
+	var expired int64
+	txErr := database.Tx(func(tx *sqlx.Tx) error {
+		profile, err := lockProfile(tx, userID)
+		if err != nil {
+			return err
+		}
+
+		err = setPassword(tx, userID, hashPassword)
+		if err != nil {
+			return err
+		}
+
+		if logoutOthers {
+			expired, err = expireUserSessions(tx, userID, keepSessionID)
+			if err != nil {
+				return err
+			}
+		}
+		return updateProvider(profile.UID)
+	})
+	if txErr != nil {
+		logrus.Printf("ChangePassword: cannot change password:%v", txErr)
+		return 0, txErr
+	}
+	return expired, nil
+}
+
+func setPassword(tx *sqlx.Tx, userID int, hashPassword []byte) error {
+	// language=SQL
+	SQL := `UPDATE users
+            SET    password   = $1,
+                   updated_at = now()
+            WHERE  id = $2`
+
+	_, err := tx.Exec(SQL, hashPassword, userID)
+	return err
+}
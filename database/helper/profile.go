@@ -0,0 +1,141 @@
+package helper
+
+import (
+	"firebaseAuth/database"
+	"firebaseAuth/models"
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+	"strings"
+)
+
+// SyncProfile pushes a profile change to the identity provider, it gets the profile before and after the change
+type SyncProfile func(previous, updated models.Profile) error
+
+// UpdateProfile changes only the fields set in profileUpdate and returns the profile as stored afterwards.
+// sync runs inside the transaction, when it fails the local change is rolled back.
+func UpdateProfile(profileUpdate models.ProfileUpdate, userID int, sync SyncProfile) (models.Profile, error) {
+	// language=SQL
+	SQL := `UPDATE users
+            SET    name       = COALESCE($1, name),
+                   phone_no   = COALESCE($2, phone_no),
+                   age        = COALESCE($3::int, age),
+                   gender     = COALESCE($4, gender),
+                   updated_at = now()
+            WHERE  id = $5
+            RETURNING id,
+                   COALESCE(name, '')     as name,
+                   email,
+                   COALESCE(phone_no, '') as phone_no,
+                   COALESCE(age, 0)       as age,
+                   COALESCE(gender, '')   as gender,
+                   COALESCE(user_uid, '') as user_uid,
+                   email_verified_at IS NOT NULL as email_verified`
+
+	var profile models.Profile
+
+	txErr := database.Tx(func(tx *sqlx.Tx) error {
+		previous, err := lockProfile(tx, userID)
+		if err != nil {
+			return err
+		}
+
+		err = tx.Get(&profile, SQL, profileUpdate.Name, profileUpdate.Phone, profileUpdate.Age, profileUpdate.Gender, userID)
+		if err != nil {
+			return err
+		}
+		return sync(previous, profile)
+	})
+	if txErr != nil {
+		logrus.Printf("UpdateProfile: cannot update profile:%v", txErr)
+		return profile, txErr
+	}
+	return profile, nil
+}
+
+// UpdateEmail changes the email of the user, a new address is unverified until the user verifies it.
+// Like UpdateProfile, a failing sync rolls the local change back.
+func UpdateEmail(userID int, email string, sync SyncProfile) (models.Profile, error) {
+	// language=SQL
+	SQL := `UPDATE users
+            SET    email             = $1,
+                   email_verified_at = CASE WHEN email = $1 THEN email_verified_at END,
+                   updated_at        = now()
+            WHERE  id = $2
+            RETURNING id,
+                   COALESCE(name, '')     as name,
+                   email,
+                   COALESCE(phone_no, '') as phone_no,
+                   COALESCE(age, 0)       as age,
+                   COALESCE(gender, '')   as gender,
+                   COALESCE(user_uid, '') as user_uid,
+                   email_verified_at IS NOT NULL as email_verified`
+
+	var profile models.Profile
+
+	txErr := database.Tx(func(tx *sqlx.Tx) error {
+		previous, err := lockProfile(tx, userID)
+		if err != nil {
+			return err
+		}
+
+		err = tx.Get(&profile, SQL, strings.ToLower(email), userID)
+		if err != nil {
+			return err
+		}
+		return sync(previous, profile)
+	})
+	if txErr != nil {
+		logrus.Printf("UpdateEmail: cannot update email:%v", txErr)
+		return profile, txErr
+	}
+	return profile, nil
+}
+
+// lockProfile reads the active user and holds its row until the transaction ends
+func lockProfile(tx *sqlx.Tx, userID int) (models.Profile, error) {
+	// language=SQL
+	SQL := `SELECT id,
+                   COALESCE(name, '')     as name,
+                   email,
+                   COALESCE(phone_no, '') as phone_no,
+                   COALESCE(age, 0)       as age,
+                   COALESCE(gender, '')   as gender,
+                   COALESCE(user_uid, '') as user_uid,
+                   email_verified_at IS NOT NULL as email_verified
+            FROM   users
+            WHERE  id = $1
+            AND    archived_at IS NULL
+            FOR UPDATE`
+
+	var profile models.Profile
+
+	err := tx.Get(&profile, SQL, userID)
+	return profile, err
+}
+
+// GetProfiles returns a page of active users ordered by id, it is what the reconciliation walks through
+func GetProfiles(afterID, limit int) ([]models.Profile, error) {
+	// language=SQL
+	SQL := `SELECT id,
+                   COALESCE(name, '')     as name,
+                   email,
+                   COALESCE(phone_no, '') as phone_no,
+                   COALESCE(age, 0)       as age,
+                   COALESCE(gender, '')   as gender,
+                   COALESCE(user_uid, '') as user_uid,
+                   email_verified_at IS NOT NULL as email_verified
+            FROM   users
+            WHERE  archived_at IS NULL
+            AND    id > $1
+            ORDER BY id
+            LIMIT $2`
+
+	profiles := make([]models.Profile, 0)
+
+	err := database.FirebaseDB.Select(&profiles, SQL, afterID, limit)
+	if err != nil {
+		logrus.Printf("GetProfiles: cannot get profiles:%v", err)
+		return profiles, err
+	}
+	return profiles, nil
+}
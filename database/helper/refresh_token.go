@@ -0,0 +1,148 @@
+package helper
+
+import (
+	"database/sql"
+	"firebaseAuth/apperror"
+	"firebaseAuth/database"
+	"firebaseAuth/models"
+	"firebaseAuth/utilities"
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+// ErrRefreshTokenReused means an already rotated refresh token came back, the whole session has been revoked
+var ErrRefreshTokenReused = apperror.New(apperror.CodeUnauthorized, "refresh token was already used, the session has been revoked")
+
+// CreateRefreshToken issues the first refresh token of a session
+func CreateRefreshToken(sessionID string) (string, error) {
+	// language=SQL
+	SQL := `INSERT INTO refresh_tokens(session_id, token_hash)
+            SELECT id, $2
+            FROM   sessions
+            WHERE  session_uid = $1`
+
+	refreshToken, err := utilities.GenerateToken(32)
+	if err != nil {
+		logrus.Printf("CreateRefreshToken: cannot generate refresh token:%v", err)
+		return refreshToken, err
+	}
+
+	_, err = database.FirebaseDB.Exec(SQL, sessionID, utilities.HashToken(refreshToken))
+	if err != nil {
+		logrus.Printf("CreateRefreshToken: cannot store refresh token:%v", err)
+		return refreshToken, err
+	}
+	return refreshToken, nil
+}
+
+// RotateRefreshToken swaps a refresh token for a new one of the same session. Presenting a token that was already
+// rotated revokes the session and all of its refresh tokens and returns ErrRefreshTokenReused. An unknown token or
+// a session that is expired or idle for longer than idleTimeout returns sql.ErrNoRows.
+func RotateRefreshToken(refreshToken string, idleTimeout time.Duration) (models.RefreshedSession, error) {
+	// language=SQL
+	SQL := `SELECT rt.id,
+                   rt.used_at IS NOT NULL OR rt.revoked_at IS NOT NULL as used,
+                   s.id          as session_id,
+                   s.session_uid,
+                   s.user_id,
+                   s.expires_at > now()
+                   AND ($2::float8 = 0 OR s.updated_at > now() - make_interval(secs => $2::float8)) as active
+            FROM   refresh_tokens rt
+                   JOIN sessions s on s.id = rt.session_id
+            WHERE  rt.token_hash = $1
+            FOR UPDATE OF rt, s`
+
+	var refreshed models.RefreshedSession
+	var reused bool
+
+	txErr := database.Tx(func(tx *sqlx.Tx) error {
+		var current struct {
+			ID         int    `db:"id"`
+			Used       bool   `db:"used"`
+			SessionID  int    `db:"session_id"`
+			SessionUID string `db:"session_uid"`
+			UserID     int    `db:"user_id"`
+			Active     bool   `db:"active"`
+		}
+		err := tx.Get(&current, SQL, utilities.HashToken(refreshToken), idleTimeout.Seconds())
+		if err != nil {
+			return err
+		}
+
+		if current.Used {
+			reused = true
+			return revokeSessionFamily(tx, current.SessionID)
+		}
+		if !current.Active {
+			return sql.ErrNoRows
+		}
+
+		newToken, err := utilities.GenerateToken(32)
+		if err != nil {
+			return err
+		}
+
+		// language=SQL
+		markUsedSQL := `UPDATE refresh_tokens
+                        SET    used_at = now()
+                        WHERE  id = $1`
+		_, err = tx.Exec(markUsedSQL, current.ID)
+		if err != nil {
+			return err
+		}
+
+		// language=SQL
+		insertSQL := `INSERT INTO refresh_tokens(session_id, token_hash)
+                      VALUES ($1, $2)`
+		_, err = tx.Exec(insertSQL, current.SessionID, utilities.HashToken(newToken))
+		if err != nil {
+			return err
+		}
+
+		// language=SQL
+		touchSQL := `UPDATE sessions
+                     SET    updated_at = now()
+                     WHERE  id = $1`
+		_, err = tx.Exec(touchSQL, current.SessionID)
+		if err != nil {
+			return err
+		}
+
+		refreshed = models.RefreshedSession{
+			UserID:       current.UserID,
+			SessionID:    current.SessionUID,
+			RefreshToken: newToken,
+		}
+		return nil
+	})
+	if txErr != nil {
+		logrus.Printf("RotateRefreshToken: cannot rotate refresh token:%v", txErr)
+		return refreshed, txErr
+	}
+	if reused {
+		logrus.Printf("RotateRefreshToken: reused refresh token, revoked session of user")
+		return refreshed, ErrRefreshTokenReused
+	}
+	return refreshed, nil
+}
+
+func revokeSessionFamily(tx *sqlx.Tx, sessionID int) error {
+	// language=SQL
+	revokeTokensSQL := `UPDATE refresh_tokens
+                        SET    revoked_at = now()
+                        WHERE  session_id = $1
+                        AND    revoked_at IS NULL`
+	_, err := tx.Exec(revokeTokensSQL, sessionID)
+	if err != nil {
+		return err
+	}
+
+	// language=SQL
+	expireSessionSQL := `UPDATE sessions
+                         SET    expires_at = now()
+                         WHERE  id = $1
+                         AND    expires_at > now()`
+	_, err = tx.Exec(expireSessionSQL, sessionID)
+	return err
+}
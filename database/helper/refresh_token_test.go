@@ -0,0 +1,91 @@
+package helper
+
+import (
+	"database/sql"
+	"firebaseAuth/database"
+	"firebaseAuth/utilities"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"testing"
+	"time"
+)
+
+// mockDatabase points database.FirebaseDB at a sqlmock until the test ends and fails it on unmet expectations
+func mockDatabase(t *testing.T) sqlmock.Sqlmock {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := database.FirebaseDB
+	database.FirebaseDB = sqlx.NewDb(db, "postgres")
+	t.Cleanup(func() {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+		database.FirebaseDB = previous
+		db.Close()
+	})
+	return mock
+}
+
+func refreshTokenRows(used, active bool) *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "used", "session_id", "session_uid", "user_id", "active"}).
+		AddRow(7, used, 3, "session-uid", 42, active)
+}
+
+func TestRotateRefreshToken(t *testing.T) {
+	mock := mockDatabase(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FOR UPDATE OF rt, s`).WithArgs(utilities.HashToken("old"), time.Hour.Seconds()).
+		WillReturnRows(refreshTokenRows(false, true))
+	mock.ExpectExec(`UPDATE refresh_tokens\s+SET\s+used_at`).WithArgs(7).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO refresh_tokens`).WithArgs(3, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`UPDATE sessions\s+SET\s+updated_at`).WithArgs(3).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	refreshed, err := RotateRefreshToken("old", time.Hour)
+	if err != nil {
+		t.Fatalf("RotateRefreshToken: %v", err)
+	}
+	if refreshed.UserID != 42 || refreshed.SessionID != "session-uid" {
+		t.Errorf("refreshed = %+v, want user 42 on session-uid", refreshed)
+	}
+	if refreshed.RefreshToken == "" || refreshed.RefreshToken == "old" {
+		t.Errorf("refresh token = %q, want a new one", refreshed.RefreshToken)
+	}
+}
+
+func TestRotateRefreshTokenReuseRevokesSession(t *testing.T) {
+	mock := mockDatabase(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FOR UPDATE OF rt, s`).WithArgs(utilities.HashToken("rotated"), time.Hour.Seconds()).
+		WillReturnRows(refreshTokenRows(true, true))
+	mock.ExpectExec(`UPDATE refresh_tokens\s+SET\s+revoked_at`).WithArgs(3).WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(`UPDATE sessions\s+SET\s+expires_at`).WithArgs(3).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	refreshed, err := RotateRefreshToken("rotated", time.Hour)
+	if err != ErrRefreshTokenReused {
+		t.Fatalf("err = %v, want ErrRefreshTokenReused", err)
+	}
+	if refreshed.RefreshToken != "" {
+		t.Errorf("refresh token = %q, want none for a reused token", refreshed.RefreshToken)
+	}
+}
+
+func TestRotateRefreshTokenInactiveSession(t *testing.T) {
+	mock := mockDatabase(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FOR UPDATE OF rt, s`).WithArgs(utilities.HashToken("idle"), time.Hour.Seconds()).
+		WillReturnRows(refreshTokenRows(false, false))
+	mock.ExpectRollback()
+
+	_, err := RotateRefreshToken("idle", time.Hour)
+	if err != sql.ErrNoRows {
+		t.Fatalf("err = %v, want sql.ErrNoRows", err)
+	}
+}
@@ -0,0 +1,57 @@
+package helper
+
+import (
+	"firebaseAuth/database"
+	"firebaseAuth/models"
+	"github.com/lib/pq"
+	"github.com/sirupsen/logrus"
+	"strings"
+)
+
+// SetRole gives the user role and returns the role it had before
+func SetRole(userID int, role string) (string, error) {
+	// language=SQL
+	SQL := `UPDATE users u
+            SET    role       = $2,
+                   updated_at = now()
+            FROM   (SELECT id, role FROM users WHERE id = $1 AND archived_at IS NULL FOR UPDATE) previous
+            WHERE  u.id = previous.id
+            RETURNING previous.role`
+
+	var previous string
+
+	err := database.FirebaseDB.Get(&previous, SQL, userID, role)
+	if err != nil {
+		logrus.Printf("SetRole: cannot set role of user %d:%v", userID, err)
+		return previous, err
+	}
+	return previous, nil
+}
+
+// BootstrapAdmins makes the users with one of emails admins, so a fresh deployment has someone to hand out roles.
+// It never takes a role away, removing an email from the list does not demote the user.
+func BootstrapAdmins(emails []string) (int64, error) {
+	if len(emails) == 0 {
+		return 0, nil
+	}
+
+	// language=SQL
+	SQL := `UPDATE users
+            SET    role       = $2,
+                   updated_at = now()
+            WHERE  email = ANY($1)
+            AND    role <> $2
+            AND    archived_at IS NULL`
+
+	lowered := make([]string, 0, len(emails))
+	for _, email := range emails {
+		lowered = append(lowered, strings.ToLower(email))
+	}
+
+	result, err := database.FirebaseDB.Exec(SQL, pq.Array(lowered), models.RoleAdmin)
+	if err != nil {
+		logrus.Printf("BootstrapAdmins: cannot promote admins:%v", err)
+		return 0, err
+	}
+	return result.RowsAffected()
+}
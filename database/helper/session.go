@@ -0,0 +1,166 @@
+package helper
+
+import (
+	"database/sql"
+	"firebaseAuth/database"
+	"firebaseAuth/models"
+	"firebaseAuth/utilities"
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+// CreateSession stores a new session for one device and returns its opaque id, which goes into the token claims.
+// The session expires ttl after it is created no matter how often it is used.
+func CreateSession(userID int, sessionDetails models.SessionDetails, ttl time.Duration) (string, error) {
+	// language=SQL
+	SQL := `INSERT INTO sessions(user_id, session_uid, device_name, ip_address, user_agent, expires_at)
+            VALUES   ($1, $2, $3, $4, $5, now() + make_interval(secs => $6::float8))
+            `
+	sessionID, err := utilities.GenerateToken(24)
+	if err != nil {
+		logrus.Printf("CreateSession: cannot generate session id:%v", err)
+		return sessionID, err
+	}
+
+	_, err = database.FirebaseDB.Exec(SQL, userID, sessionID, sessionDetails.DeviceName, sessionDetails.IPAddress, sessionDetails.UserAgent, ttl.Seconds())
+	if err != nil {
+		logrus.Printf("CreateSession: cannot create user session:%v", err)
+		return sessionID, err
+	}
+	return sessionID, nil
+}
+
+// TouchSession checks the session is neither expired nor idle for longer than idleTimeout and marks it as used now.
+// It returns sql.ErrNoRows when the session is not valid. An idleTimeout of 0 disables the idle check.
+func TouchSession(userID int, sessionID string, idleTimeout time.Duration) error {
+	// language=SQL
+	SQL := `UPDATE sessions
+            SET    updated_at = now()
+            WHERE  session_uid = $1
+            AND    user_id = $2
+            AND    expires_at > now()
+            AND    ($3::float8 = 0 OR updated_at > now() - make_interval(secs => $3::float8))
+            RETURNING id`
+
+	var id int
+
+	err := database.FirebaseDB.Get(&id, SQL, sessionID, userID, idleTimeout.Seconds())
+	if err != nil {
+		logrus.Printf("TouchSession: session expired:%v", err)
+		return err
+	}
+	return nil
+}
+
+func GetActiveSessions(userID int, idleTimeout time.Duration) ([]models.Session, error) {
+	// language=SQL
+	SQL := `SELECT session_uid,
+                   COALESCE(device_name, '') as device_name,
+                   COALESCE(ip_address, '')  as ip_address,
+                   COALESCE(user_agent, '')  as user_agent,
+                   created_at,
+                   updated_at,
+                   expires_at
+            FROM   sessions
+            WHERE  user_id = $1
+            AND    expires_at > now()
+            AND    ($2::float8 = 0 OR updated_at > now() - make_interval(secs => $2::float8))
+            ORDER BY updated_at DESC`
+
+	sessions := make([]models.Session, 0)
+
+	err := database.FirebaseDB.Select(&sessions, SQL, userID, idleTimeout.Seconds())
+	if err != nil {
+		logrus.Printf("GetActiveSessions: cannot get sessions:%v", err)
+		return sessions, err
+	}
+	return sessions, nil
+}
+
+// Logout expires one session of the user, sql.ErrNoRows means it does not exist or is already expired
+func Logout(userID int, sessionID string) error {
+	// language=SQL
+	SQL := `UPDATE sessions
+            SET    expires_at = now()
+            WHERE  session_uid = $1
+            AND    user_id = $2
+            AND    expires_at > now()`
+
+	result, err := database.FirebaseDB.Exec(SQL, sessionID, userID)
+	if err != nil {
+		logrus.Printf("Logout: cannot do logout:%v", err)
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		logrus.Printf("Logout: cannot get affected rows:%v", err)
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// LogoutOtherSessions expires every active session of the user except keepSessionID and returns how many it expired
+func LogoutOtherSessions(userID int, keepSessionID string) (int64, error) {
+	var loggedOut int64
+	txErr := database.Tx(func(tx *sqlx.Tx) error {
+		var err error
+		loggedOut, err = expireUserSessions(tx, userID, keepSessionID)
+		return err
+	})
+	if txErr != nil {
+		logrus.Printf("LogoutOtherSessions: cannot expire sessions:%v", txErr)
+		return 0, txErr
+	}
+	return loggedOut, nil
+}
+
+// expireUserSessions expires every active session of the user except keepSessionID inside tx, an empty
+// keepSessionID expires them all. Their refresh tokens stop working with them.
+func expireUserSessions(tx *sqlx.Tx, userID int, keepSessionID string) (int64, error) {
+	// language=SQL
+	SQL := `UPDATE sessions
+            SET    expires_at = now()
+            WHERE  user_id = $1
+            AND    session_uid <> $2
+            AND    expires_at > now()`
+
+	result, err := tx.Exec(SQL, userID, keepSessionID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// ExpireIdleSessions marks sessions that went unused for idleTimeout as expired at the moment they went idle
+func ExpireIdleSessions(idleTimeout time.Duration) (int64, error) {
+	// language=SQL
+	SQL := `UPDATE sessions
+            SET    expires_at = updated_at + make_interval(secs => $1::float8)
+            WHERE  expires_at > now()
+            AND    updated_at < now() - make_interval(secs => $1::float8)`
+
+	result, err := database.FirebaseDB.Exec(SQL, idleTimeout.Seconds())
+	if err != nil {
+		logrus.Printf("ExpireIdleSessions: cannot expire idle sessions:%v", err)
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// PurgeExpiredSessions deletes sessions that expired more than retention ago
+func PurgeExpiredSessions(retention time.Duration) (int64, error) {
+	// language=SQL
+	SQL := `DELETE FROM sessions
+            WHERE  expires_at < now() - make_interval(secs => $1::float8)`
+
+	result, err := database.FirebaseDB.Exec(SQL, retention.Seconds())
+	if err != nil {
+		logrus.Printf("PurgeExpiredSessions: cannot delete expired sessions:%v", err)
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -1,16 +1,23 @@
 package helper
 
 import (
+	"database/sql"
+	"firebaseAuth/apperror"
 	"firebaseAuth/database"
 	"firebaseAuth/models"
 	"firebaseAuth/utilities"
+	"github.com/jmoiron/sqlx"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/crypto/bcrypt"
+	"time"
 )
 
 func FetchPasswordAndID(userMail string) (models.UserCredentials, error) {
 	// language=SQL
-	SQL := `SELECT users.id,password
+	SQL := `SELECT users.id,COALESCE(password, '') as password,
+                   email_verified_at IS NOT NULL as email_verified,
+                   disabled_at IS NOT NULL as disabled,
+                   role
             FROM   users
             WHERE  email=$1 
             AND    archived_at IS NULL `
@@ -41,26 +48,9 @@ func CheckEmail(email string) (int, error) {
 	return userID, nil
 }
 
-func CheckSession(userID int) (int, error) {
-	SQL := `SELECT id
-           FROM    sessions
-           WHERE   expires_at IS NULL
-           AND     user_id=$1
-           ORDER BY id DESC 
-           LIMIT 1`
-	var sessionID int
-
-	err := database.FirebaseDB.Get(&sessionID, SQL, userID)
-	if err != nil {
-		logrus.Printf("CheckSession: session expired:%v", err)
-		return sessionID, err
-	}
-	return sessionID, nil
-}
-
 func GetEmailPassword(userID int) ([]models.UserEmailPassword, error) {
 	SQL := `SELECT email,
-                   password
+                   COALESCE(password, '') as password
             FROM   users
             WHERE id=$1`
 
@@ -75,7 +65,7 @@ func GetEmailPassword(userID int) ([]models.UserEmailPassword, error) {
 }
 
 func FetchUID(email string) (string, error) {
-	SQL := `SELECT user_uid
+	SQL := `SELECT COALESCE(user_uid, '')
             FROM   users
             WHERE  email = $1`
 
@@ -89,6 +79,26 @@ func FetchUID(email string) (string, error) {
 	return uid, nil
 }
 
+func FetchUserIdentity(userID int) (models.UserIdentity, error) {
+	// language=SQL
+	SQL := `SELECT id,
+                   email,
+                   COALESCE(user_uid, '') as user_uid,
+                   role
+            FROM   users
+            WHERE  id = $1
+            AND    archived_at IS NULL`
+
+	var userIdentity models.UserIdentity
+
+	err := database.FirebaseDB.Get(&userIdentity, SQL, userID)
+	if err != nil {
+		logrus.Printf("FetchUserIdentity: cannot get user identity:%v", err)
+		return userIdentity, err
+	}
+	return userIdentity, nil
+}
+
 func Register(userDetails models.UserDetails) (int, error) {
 	// language=SQL
 	SQL := `INSERT INTO users(name, email, password, phone_no, age, gender, user_uid) 
@@ -110,47 +120,177 @@ func Register(userDetails models.UserDetails) (int, error) {
 	return userID, nil
 }
 
-func CreateSession(userID int) error {
-	SQL := `INSERT INTO sessions(user_id)
-            VALUES   ($1)
-            `
-	_, err := database.FirebaseDB.Exec(SQL, userID)
-	if err != nil {
-		logrus.Printf("CreateSession: cannot create user session:%v", err)
+var (
+	ErrSelfFriendRequest      = apperror.New(apperror.CodeBadRequest, "cannot send a friend request to yourself")
+	ErrUserNotFound           = apperror.New(apperror.CodeNotFound, "user not found")
+	ErrAlreadyFriends         = apperror.New(apperror.CodeConflict, "already friends")
+	ErrDuplicateFriendRequest = apperror.New(apperror.CodeConflict, "friend request already pending")
+	ErrFriendRequestCooldown  = apperror.New(apperror.CodeTooManyRequests, "friend request was rejected recently, try again later")
+)
+
+// SendFriendRequest applies the friend request rules and returns the status the request ended up in. A pending
+// request in the other direction is accepted instead of creating a second one, and a request rejected less than
+// cooldown ago cannot be sent again yet.
+func SendFriendRequest(friendRequest models.FriendRequest, userID int, cooldown time.Duration) (string, error) {
+	if friendRequest.RequestTo == userID {
+		return "", ErrSelfFriendRequest
+	}
+
+	// language=SQL
+	lockSQL := `SELECT pg_advisory_xact_lock(LEAST($1::int, $2::int), GREATEST($1::int, $2::int))`
+
+	// language=SQL
+	userSQL := `SELECT EXISTS(SELECT 1
+                              FROM   users
+                              WHERE  id = $1
+                              AND    archived_at IS NULL)`
+
+	// language=SQL
+	blockedSQL := `SELECT EXISTS(SELECT 1
+                                 FROM   user_blocks
+                                 WHERE  archived_at IS NULL
+                                 AND    ((blocker_id = $1 AND blocked_id = $2) OR (blocker_id = $2 AND blocked_id = $1)))`
+
+	// language=SQL
+	pairSQL := `SELECT id,
+                       request_from,
+                       status,
+                       updated_at > now() - make_interval(secs => $3::float8) as recent
+                FROM   friend_request
+                WHERE  archived_at IS NULL
+                AND    ((request_from = $1 AND request_to = $2) OR (request_from = $2 AND request_to = $1))
+                ORDER BY id DESC`
+
+	// language=SQL
+	acceptSQL := `UPDATE friend_request
+                  SET    status = $1,
+                         updated_at = now()
+                  WHERE  id = $2`
+
+	// language=SQL
+	insertSQL := `INSERT INTO friend_request(request_from, request_to)
+                  VALUES ($1, $2)`
+
+	var status string
+	err := database.Tx(func(tx *sqlx.Tx) error {
+		_, err := tx.Exec(lockSQL, userID, friendRequest.RequestTo)
+		if err != nil {
+			return err
+		}
+
+		var exists bool
+		err = tx.Get(&exists, userSQL, friendRequest.RequestTo)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return ErrUserNotFound
+		}
+
+		var blocked bool
+		err = tx.Get(&blocked, blockedSQL, userID, friendRequest.RequestTo)
+		if err != nil {
+			return err
+		}
+		if blocked {
+			return ErrUserBlocked
+		}
+
+		pair := make([]struct {
+			ID          int    `db:"id"`
+			RequestFrom int    `db:"request_from"`
+			Status      string `db:"status"`
+			Recent      bool   `db:"recent"`
+		}, 0)
+		err = tx.Select(&pair, pairSQL, userID, friendRequest.RequestTo, cooldown.Seconds())
+		if err != nil {
+			return err
+		}
+
+		for _, request := range pair {
+			if request.Status == utilities.Accepted {
+				return ErrAlreadyFriends
+			}
+		}
+
+		rejectedRecently := false
+		for _, request := range pair {
+			switch {
+			case request.Status == utilities.Pending && request.RequestFrom == userID:
+				return ErrDuplicateFriendRequest
+			case request.Status == utilities.Pending:
+				status = utilities.Accepted
+				_, err = tx.Exec(acceptSQL, utilities.Accepted, request.ID)
+				return err
+			case request.Status == utilities.Rejected && request.RequestFrom == userID && request.Recent:
+				rejectedRecently = true
+			}
+		}
+		if rejectedRecently {
+			return ErrFriendRequestCooldown
+		}
+
+		status = utilities.Pending
+		_, err = tx.Exec(insertSQL, userID, friendRequest.RequestTo)
 		return err
+	})
+	if err != nil {
+		logrus.Printf("SendFriendRequest: cannot send request to user:%v", err)
+		return status, err
 	}
-	return nil
+	return status, nil
 }
 
-func SendFriendRequest(friendRequest models.FriendRequest, userID int) error {
-	SQL := `INSERT INTO friend_request(request_from, request_to) 
-                   VALUES ($1, $2)
-                   `
-	_, err := database.FirebaseDB.Exec(SQL, userID, friendRequest.RequestTo)
+// CancelFriendRequest archives a pending request the user sent, sql.ErrNoRows means there is no such request
+func CancelFriendRequest(requestID, userID int) error {
+	// language=SQL
+	SQL := `UPDATE friend_request
+            SET    archived_at = now(),
+                   updated_at = now()
+            WHERE  id = $1
+            AND    request_from = $2
+            AND    status = $3
+            AND    archived_at IS NULL`
+
+	result, err := database.FirebaseDB.Exec(SQL, requestID, userID, utilities.Pending)
 	if err != nil {
-		logrus.Printf("SendFriendRequest: cannot send request to user:%v", err)
+		logrus.Printf("CancelFriendRequest: cannot cancel request:%v", err)
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		logrus.Printf("CancelFriendRequest: cannot get affected rows:%v", err)
 		return err
 	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
 	return nil
 }
 
 func SeeFriendRequests(filterCheck models.FiltersCheck, userID int) ([]models.RequestList, error) {
 	SQL := `SELECT fr.id as id,
-                   u.name as user_name,
+                   COALESCE(u.name, '') as user_name,
                    u.id as  user_id
        			   
 	        FROM friend_request fr
 	             JOIN users u on u.id = fr.request_from
 	             
             WHERE fr.request_to = $1
+            AND fr.status = $4
             AND fr.archived_at IS NULL 
             AND u.archived_at IS NULL 
+            AND NOT EXISTS(SELECT 1
+                           FROM   user_blocks ub
+                           WHERE  ub.archived_at IS NULL
+                           AND    ((ub.blocker_id = $1 AND ub.blocked_id = u.id) OR (ub.blocker_id = u.id AND ub.blocked_id = $1)))
+            ORDER BY fr.id DESC
             LIMIT $2 OFFSET $3
             `
 
 	allRequests := make([]models.RequestList, 0)
 
-	err := database.FirebaseDB.Select(&allRequests, SQL, userID, filterCheck.Limit, filterCheck.Limit*filterCheck.Page)
+	err := database.FirebaseDB.Select(&allRequests, SQL, userID, filterCheck.Limit, filterCheck.Limit*filterCheck.Page, utilities.Pending)
 	if err != nil {
 		logrus.Printf("SeeFriendRequests: cannot get all requests:%v", err)
 		return allRequests, err
@@ -158,57 +298,45 @@ func SeeFriendRequests(filterCheck models.FiltersCheck, userID int) ([]models.Re
 	return allRequests, nil
 }
 
+// UpdateFriendRequest accepts or rejects a pending request sent to userID, sql.ErrNoRows means there is none
 func UpdateFriendRequest(allRequest models.AllRequests, userID int) error {
 	SQL := `UPDATE friend_request 
-            SET status = $1
+            SET status = $1,
+                updated_at = now()
             WHERE request_to = $2
             AND  request_from = $3
-            AND  status != $4  
+            AND  status = $4
             AND  archived_at IS NULL 
             `
 
-	var status string
-	if allRequest.Status == "accepted" {
-		status = utilities.Accepted
-	} else if allRequest.Status == "rejected" {
-		status = utilities.Rejected
-	}
-	_, err := database.FirebaseDB.Exec(SQL, status, userID, allRequest.RequestFrom, utilities.Rejected)
+	result, err := database.FirebaseDB.Exec(SQL, allRequest.Status, userID, allRequest.RequestFrom, utilities.Pending)
 	if err != nil {
 		logrus.Printf("UpdateFriendRequest: unable to accept request:%v", err)
 		return err
 	}
-	return nil
-}
-
-func UpdateUserInfo(userDetails models.UserDetails, userID int) error {
-	SQL := `UPDATE users
-            SET    name = $1,
-                   email = $2,
-                   password = $3,
-                   phone_no = $4,
-                   age = $5,
-                   gender = $6
-            WHERE id = $7
-            AND archived_at IS NULL `
-
-	_, err := database.FirebaseDB.Exec(SQL, userDetails.Name, userDetails.Email, userDetails.Password, userDetails.Phone, userDetails.Age, userDetails.Gender, userID)
+	rows, err := result.RowsAffected()
 	if err != nil {
-		logrus.Printf("UpdateUserInfo: cannot update user:%v", err)
+		logrus.Printf("UpdateFriendRequest: cannot get affected rows:%v", err)
 		return err
 	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
 	return nil
 }
 
+// GetFriendList returns the other side of every accepted request, whichever of the two users sent it
 func GetFriendList(filterCheck models.FiltersCheck, userID int) ([]models.FriendList, error) {
-	SQL := `SELECT u.id   as user_id,
-       			   u.name as user_name
+	// language=SQL
+	SQL := `SELECT DISTINCT u.id   as user_id,
+                            COALESCE(u.name, '') as user_name
             FROM   friend_request fr
-                   JOIN users u on u.id = fr.request_from
-            WHERE request_to = $1
-            AND   status = $2
-            AND   fr.archived_at IS NULL 
-            AND   u.archived_at  IS NULL 
+                   JOIN users u on u.id = CASE WHEN fr.request_from = $1 THEN fr.request_to ELSE fr.request_from END
+            WHERE  (fr.request_from = $1 OR fr.request_to = $1)
+            AND    fr.status = $2
+            AND    fr.archived_at IS NULL
+            AND    u.archived_at  IS NULL
+            ORDER BY user_name, user_id
             LIMIT $3 OFFSET $4
             `
 
@@ -222,62 +350,69 @@ func GetFriendList(filterCheck models.FiltersCheck, userID int) ([]models.Friend
 	return friendList, nil
 }
 
+// Unfriend archives the accepted request between the two users, sql.ErrNoRows means they are not friends
+func Unfriend(userID, friendID int) error {
+	// language=SQL
+	SQL := `UPDATE friend_request
+            SET    archived_at = now(),
+                   updated_at = now()
+            WHERE  status = $3
+            AND    archived_at IS NULL
+            AND    ((request_from = $1 AND request_to = $2) OR (request_from = $2 AND request_to = $1))`
+
+	result, err := database.FirebaseDB.Exec(SQL, userID, friendID, utilities.Accepted)
+	if err != nil {
+		logrus.Printf("Unfriend: cannot remove friend:%v", err)
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		logrus.Printf("Unfriend: cannot get affected rows:%v", err)
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// GetUsers lists every other active user that neither blocked nor is blocked by userID, status tells whether they
+// are a friend of userID in either direction
 func GetUsers(filterCheck models.FiltersCheck, userID int) ([]models.UserDetails, error) {
-	SQL := `SELECT users.id,
-                  name,
-                  email,
-                  password,
-                  phone_no as phone,
-                  age,
-                  gender
-           FROM   users JOIN friend_request fr on users.id = fr.request_from
-           WHERE users.archived_at IS NULL
-           AND   fr.archived_at IS NULL 
-           AND   (users.id <> fr.request_from AND fr.request_to = $2 AND status = $1)
-           AND   users.id != $2
-           LIMIT $3 OFFSET $4`
+	// language=SQL
+	SQL := `SELECT u.id,
+                   COALESCE(u.name, '')     as name,
+                   u.email,
+                   COALESCE(u.phone_no, '') as phone,
+                   COALESCE(u.age, 0)       as age,
+                   COALESCE(u.gender, '')   as gender,
+                   CASE WHEN EXISTS(
+                            SELECT 1
+                            FROM   friend_request fr
+                            WHERE  fr.status = $2
+                            AND    fr.archived_at IS NULL
+                            AND    ((fr.request_from = u.id AND fr.request_to = $1) OR (fr.request_from = $1 AND fr.request_to = u.id))
+                        ) THEN 'friend' ELSE 'user' END as status
+            FROM   users u
+            WHERE  u.archived_at IS NULL
+            AND    u.id != $1
+            AND    NOT EXISTS(SELECT 1
+                              FROM   user_blocks ub
+                              WHERE  ub.archived_at IS NULL
+                              AND    ((ub.blocker_id = $1 AND ub.blocked_id = u.id) OR (ub.blocker_id = u.id AND ub.blocked_id = $1)))
+            ORDER BY u.id
+            LIMIT $3 OFFSET $4`
 
 	userDetails := make([]models.UserDetails, 0)
 
-	err := database.FirebaseDB.Select(&userDetails, SQL, utilities.Accepted, userID, filterCheck.Limit, filterCheck.Limit*filterCheck.Page)
+	err := database.FirebaseDB.Select(&userDetails, SQL, userID, utilities.Accepted, filterCheck.Limit, filterCheck.Limit*filterCheck.Page)
 	if err != nil {
 		logrus.Printf("GetUsers: cannot get users:%v", err)
 		return userDetails, err
 	}
-	userList := make([]models.UserDetails, 0)
-	for i, _ := range userDetails {
-		for j, _ := range userList {
-			if userDetails[i].Email == userList[j].Email {
-				if userDetails[i].Status == "user" {
-					userList[j].Status = "friend"
-				}
-			} else {
-
-			}
-		}
-	}
 	return userDetails, nil
 }
 
-func Logout(userID int) error {
-	SQL := `UPDATE sessions
-			SET expires_at=now()
-			WHERE  id IN(
-    			SELECT id
-    			FROM sessions
-    			WHERE user_id = 5
-    			ORDER BY id DESC
-    			LIMIT 1
-			)`
-
-	_, err := database.FirebaseDB.Exec(SQL, userID)
-	if err != nil {
-		logrus.Printf("Logout: cannot do logout:%v", err)
-		return err
-	}
-	return nil
-}
-
 //func CreateNewUser(userDetails models.UsersLoginDetails) (int, error) {
 //
 //	var userID int
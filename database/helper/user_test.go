@@ -0,0 +1,110 @@
+package helper
+
+import (
+	"database/sql"
+	"firebaseAuth/models"
+	"firebaseAuth/utilities"
+	"github.com/DATA-DOG/go-sqlmock"
+	"testing"
+	"time"
+)
+
+type pairRow struct {
+	id          int
+	requestFrom int
+	status      string
+	recent      bool
+}
+
+// expectFriendRequestChecks queues the lock, user and block checks SendFriendRequest runs before it looks at the pair
+func expectFriendRequestChecks(mock sqlmock.Sqlmock, from, to int, pair ...pairRow) {
+	mock.ExpectBegin()
+	mock.ExpectExec(`pg_advisory_xact_lock`).WithArgs(from, to).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`FROM\s+users`).WithArgs(to).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectQuery(`FROM\s+user_blocks`).WithArgs(from, to).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	rows := sqlmock.NewRows([]string{"id", "request_from", "status", "recent"})
+	for _, request := range pair {
+		rows.AddRow(request.id, request.requestFrom, request.status, request.recent)
+	}
+	mock.ExpectQuery(`FROM\s+friend_request`).WithArgs(from, to, time.Hour.Seconds()).WillReturnRows(rows)
+}
+
+func TestSendFriendRequest(t *testing.T) {
+	const from, to = 1, 2
+
+	tests := []struct {
+		name       string
+		pair       []pairRow
+		wantInsert bool
+		wantAccept int
+		wantStatus string
+		wantErr    error
+	}{
+		{name: "first request", wantInsert: true, wantStatus: utilities.Pending},
+		{name: "duplicate", pair: []pairRow{{10, from, utilities.Pending, true}}, wantErr: ErrDuplicateFriendRequest},
+		{name: "reverse pending is accepted", pair: []pairRow{{10, to, utilities.Pending, true}}, wantAccept: 10, wantStatus: utilities.Accepted},
+		{name: "already friends", pair: []pairRow{{10, to, utilities.Accepted, false}}, wantErr: ErrAlreadyFriends},
+		{name: "rejected recently", pair: []pairRow{{10, from, utilities.Rejected, true}}, wantErr: ErrFriendRequestCooldown},
+		{name: "rejected before the cooldown", pair: []pairRow{{10, from, utilities.Rejected, false}}, wantInsert: true, wantStatus: utilities.Pending},
+		{name: "own rejection of their request", pair: []pairRow{{10, to, utilities.Rejected, true}}, wantInsert: true, wantStatus: utilities.Pending},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := mockDatabase(t)
+			expectFriendRequestChecks(mock, from, to, tt.pair...)
+			switch {
+			case tt.wantInsert:
+				mock.ExpectExec(`INSERT INTO friend_request`).WithArgs(from, to).WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+			case tt.wantAccept != 0:
+				mock.ExpectExec(`UPDATE friend_request`).WithArgs(utilities.Accepted, tt.wantAccept).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			default:
+				mock.ExpectRollback()
+			}
+
+			status, err := SendFriendRequest(models.FriendRequest{RequestTo: to}, from, time.Hour)
+			if err != tt.wantErr {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if status != tt.wantStatus {
+				t.Errorf("status = %q, want %q", status, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestSendFriendRequestToSelf(t *testing.T) {
+	mockDatabase(t)
+
+	_, err := SendFriendRequest(models.FriendRequest{RequestTo: 1}, 1, time.Hour)
+	if err != ErrSelfFriendRequest {
+		t.Fatalf("err = %v, want ErrSelfFriendRequest", err)
+	}
+}
+
+func TestSendFriendRequestUnknownUser(t *testing.T) {
+	mock := mockDatabase(t)
+	mock.ExpectBegin()
+	mock.ExpectExec(`pg_advisory_xact_lock`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`FROM\s+users`).WithArgs(2).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectRollback()
+
+	_, err := SendFriendRequest(models.FriendRequest{RequestTo: 2}, 1, time.Hour)
+	if err != ErrUserNotFound {
+		t.Fatalf("err = %v, want ErrUserNotFound", err)
+	}
+}
+
+func TestCancelFriendRequest(t *testing.T) {
+	mock := mockDatabase(t)
+	mock.ExpectExec(`UPDATE friend_request`).WithArgs(10, 1, utilities.Pending).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE friend_request`).WithArgs(10, 1, utilities.Pending).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	if err := CancelFriendRequest(10, 1); err != nil {
+		t.Fatalf("CancelFriendRequest: %v", err)
+	}
+	if err := CancelFriendRequest(10, 1); err != sql.ErrNoRows {
+		t.Fatalf("cancel of a request that is no longer pending: err = %v, want sql.ErrNoRows", err)
+	}
+}
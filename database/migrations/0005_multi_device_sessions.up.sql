@@ -0,0 +1,9 @@
+ALTER TABLE sessions ADD COLUMN session_uid TEXT;
+ALTER TABLE sessions ADD COLUMN device_name TEXT;
+ALTER TABLE sessions ADD COLUMN ip_address TEXT;
+ALTER TABLE sessions ADD COLUMN user_agent TEXT;
+
+UPDATE sessions SET session_uid = md5(random()::text || id::text) WHERE session_uid IS NULL;
+
+ALTER TABLE sessions ALTER COLUMN session_uid SET NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS sessions_session_uid_idx ON sessions(session_uid);
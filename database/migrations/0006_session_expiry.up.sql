@@ -0,0 +1,6 @@
+UPDATE sessions SET expires_at = created_at + interval '30 days' WHERE expires_at IS NULL;
+
+ALTER TABLE sessions ALTER COLUMN expires_at SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS sessions_user_id_expires_at_idx ON sessions(user_id, expires_at);
+CREATE INDEX IF NOT EXISTS sessions_expires_at_idx ON sessions(expires_at);
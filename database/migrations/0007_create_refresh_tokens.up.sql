@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS refresh_tokens(
+                                    id serial primary key not null ,
+                                    session_id INTEGER REFERENCES sessions(id) ON DELETE CASCADE NOT NULL ,
+                                    token_hash TEXT UNIQUE NOT NULL ,
+                                    created_at TIMESTAMP WITH TIME ZONE DEFAULT now() NOT NULL ,
+                                    used_at TIMESTAMP WITH TIME ZONE ,
+                                    revoked_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS refresh_tokens_session_id_idx ON refresh_tokens(session_id);
@@ -0,0 +1,19 @@
+UPDATE friend_request SET archived_at = now() WHERE request_from = request_to AND archived_at IS NULL;
+
+UPDATE friend_request fr
+SET    archived_at = now()
+WHERE  fr.status = 'pending'
+AND    fr.archived_at IS NULL
+AND    EXISTS(SELECT 1
+              FROM   friend_request older
+              WHERE  older.request_from = fr.request_from
+              AND    older.request_to = fr.request_to
+              AND    older.status = 'pending'
+              AND    older.archived_at IS NULL
+              AND    older.id < fr.id);
+
+ALTER TABLE friend_request ADD CONSTRAINT friend_request_not_self CHECK (request_from <> request_to) NOT VALID;
+
+CREATE UNIQUE INDEX IF NOT EXISTS friend_request_pending_pair_idx ON friend_request(request_from, request_to)
+    WHERE status = 'pending' AND archived_at IS NULL;
+CREATE INDEX IF NOT EXISTS friend_request_request_to_idx ON friend_request(request_to) WHERE archived_at IS NULL;
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS user_blocks(
+                                    id serial primary key not null ,
+                                    blocker_id INTEGER REFERENCES users(id) NOT NULL ,
+                                    blocked_id INTEGER REFERENCES users(id) NOT NULL ,
+                                    created_at TIMESTAMP WITH TIME ZONE DEFAULT now() NOT NULL ,
+                                    archived_at TIMESTAMP WITH TIME ZONE ,
+                                    CHECK (blocker_id <> blocked_id)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS user_blocks_pair_idx ON user_blocks(blocker_id, blocked_id) WHERE archived_at IS NULL;
+CREATE INDEX IF NOT EXISTS user_blocks_blocked_id_idx ON user_blocks(blocked_id) WHERE archived_at IS NULL;
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS password_resets(
+                                    id serial primary key not null ,
+                                    user_id INTEGER REFERENCES users(id) NOT NULL ,
+                                    token_hash TEXT UNIQUE NOT NULL ,
+                                    expires_at TIMESTAMP WITH TIME ZONE NOT NULL ,
+                                    created_at TIMESTAMP WITH TIME ZONE DEFAULT now() NOT NULL ,
+                                    used_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS password_resets_user_id_idx ON password_resets(user_id) WHERE used_at IS NULL;
@@ -0,0 +1,16 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verified_at TIMESTAMP WITH TIME ZONE;
+
+-- accounts created so far were registered as verified in Firebase, keep them verified
+UPDATE users SET email_verified_at = created_at WHERE email_verified_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS email_verifications(
+                                    id serial primary key not null ,
+                                    user_id INTEGER REFERENCES users(id) NOT NULL ,
+                                    email TEXT NOT NULL ,
+                                    token_hash TEXT UNIQUE NOT NULL ,
+                                    expires_at TIMESTAMP WITH TIME ZONE NOT NULL ,
+                                    created_at TIMESTAMP WITH TIME ZONE DEFAULT now() NOT NULL ,
+                                    used_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS email_verifications_user_id_idx ON email_verifications(user_id) WHERE used_at IS NULL;
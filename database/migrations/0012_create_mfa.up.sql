@@ -0,0 +1,31 @@
+CREATE TABLE IF NOT EXISTS user_mfa(
+                                    user_id INTEGER PRIMARY KEY REFERENCES users(id) NOT NULL ,
+                                    totp_secret TEXT NOT NULL ,
+                                    confirmed_at TIMESTAMP WITH TIME ZONE ,
+                                    last_used_step BIGINT ,
+                                    created_at TIMESTAMP WITH TIME ZONE DEFAULT now() NOT NULL ,
+                                    updated_at TIMESTAMP WITH TIME ZONE DEFAULT now() NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS mfa_recovery_codes(
+                                    id serial primary key not null ,
+                                    user_id INTEGER REFERENCES users(id) NOT NULL ,
+                                    code_hash TEXT NOT NULL ,
+                                    created_at TIMESTAMP WITH TIME ZONE DEFAULT now() NOT NULL ,
+                                    used_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS mfa_recovery_codes_user_id_idx ON mfa_recovery_codes(user_id) WHERE used_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS mfa_challenges(
+                                    id serial primary key not null ,
+                                    user_id INTEGER REFERENCES users(id) NOT NULL ,
+                                    token_hash TEXT UNIQUE NOT NULL ,
+                                    device_name TEXT ,
+                                    attempts INTEGER DEFAULT 0 NOT NULL ,
+                                    expires_at TIMESTAMP WITH TIME ZONE NOT NULL ,
+                                    created_at TIMESTAMP WITH TIME ZONE DEFAULT now() NOT NULL ,
+                                    used_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS mfa_challenges_expires_at_idx ON mfa_challenges(expires_at);
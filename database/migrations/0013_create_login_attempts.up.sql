@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS login_attempts(
+                                    key TEXT PRIMARY KEY NOT NULL ,
+                                    failures INTEGER NOT NULL ,
+                                    last_failed_at TIMESTAMP WITH TIME ZONE NOT NULL ,
+                                    locked_until TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS login_attempts_last_failed_at_idx ON login_attempts(last_failed_at);
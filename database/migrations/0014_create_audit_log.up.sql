@@ -0,0 +1,48 @@
+CREATE TABLE IF NOT EXISTS audit_log(
+                                    id BIGSERIAL PRIMARY KEY NOT NULL ,
+                                    created_at TIMESTAMP WITH TIME ZONE DEFAULT now() NOT NULL ,
+                                    event TEXT NOT NULL ,
+                                    actor_id INTEGER ,
+                                    target_id INTEGER ,
+                                    ip TEXT NOT NULL DEFAULT '' ,
+                                    user_agent TEXT NOT NULL DEFAULT '' ,
+                                    changes JSONB NOT NULL DEFAULT '{}'
+);
+
+CREATE INDEX IF NOT EXISTS audit_log_created_at_idx ON audit_log(created_at);
+CREATE INDEX IF NOT EXISTS audit_log_event_created_at_idx ON audit_log(event, created_at);
+CREATE INDEX IF NOT EXISTS audit_log_actor_id_idx ON audit_log(actor_id) WHERE actor_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS audit_log_target_id_idx ON audit_log(target_id) WHERE target_id IS NOT NULL;
+
+-- actor_id and target_id have no foreign keys on purpose, the trail has to outlive the users it talks about
+
+-- the one exception is erasing a user, see helper.EraseUser. Its update has to come from a transaction that ran
+-- SET LOCAL audit.erasing = 'on', it can only blank out the ids, ip and user agent, and it can only null the values of
+-- changes, the entry keeps its event, time and field names.
+CREATE OR REPLACE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'UPDATE'
+        AND current_setting('audit.erasing', true) = 'on'
+        AND NEW.id = OLD.id
+        AND NEW.created_at = OLD.created_at
+        AND NEW.event = OLD.event
+        AND (NEW.actor_id IS NULL OR NEW.actor_id = OLD.actor_id)
+        AND (NEW.target_id IS NULL OR NEW.target_id = OLD.target_id)
+        AND NEW.ip IN ('', OLD.ip)
+        AND NEW.user_agent IN ('', OLD.user_agent)
+        AND NOT EXISTS (SELECT 1 FROM jsonb_each(NEW.changes) WHERE value <> 'null'::jsonb)
+        AND NOT EXISTS (SELECT 1 FROM jsonb_object_keys(NEW.changes) AS key WHERE NOT OLD.changes ? key)
+    THEN
+        RETURN NEW;
+    END IF;
+    RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_log_append_only
+    BEFORE UPDATE OR DELETE ON audit_log
+    FOR EACH ROW EXECUTE PROCEDURE audit_log_append_only();
+
+CREATE TRIGGER audit_log_no_truncate
+    BEFORE TRUNCATE ON audit_log
+    FOR EACH STATEMENT EXECUTE PROCEDURE audit_log_append_only();
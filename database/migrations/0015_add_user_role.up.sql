@@ -0,0 +1,5 @@
+CREATE TYPE role_type AS ENUM('user', 'moderator', 'admin');
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role role_type NOT NULL DEFAULT 'user';
+
+CREATE INDEX IF NOT EXISTS users_role_idx ON users(role) WHERE role <> 'user';
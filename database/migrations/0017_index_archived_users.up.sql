@@ -0,0 +1,6 @@
+CREATE INDEX IF NOT EXISTS users_archived_at_idx ON users(archived_at) WHERE archived_at IS NOT NULL;
+
+-- a deactivated account that cannot be purged is retried later with a growing delay, meanwhile it stays out of the
+-- purge batch so it cannot hold up the others
+ALTER TABLE users ADD COLUMN IF NOT EXISTS purge_attempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS purge_next_attempt_at TIMESTAMP WITH TIME ZONE;
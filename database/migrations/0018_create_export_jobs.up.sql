@@ -0,0 +1,18 @@
+CREATE TYPE export_status AS ENUM('pending', 'running', 'done', 'failed');
+
+CREATE TABLE IF NOT EXISTS export_jobs(
+                                    id serial primary key not null ,
+                                    user_id INTEGER REFERENCES users(id) NOT NULL ,
+                                    status export_status NOT NULL DEFAULT 'pending',
+                                    archive BYTEA ,
+                                    error TEXT ,
+                                    created_at TIMESTAMP WITH TIME ZONE DEFAULT now() NOT NULL ,
+                                    started_at TIMESTAMP WITH TIME ZONE ,
+                                    finished_at TIMESTAMP WITH TIME ZONE ,
+                                    expires_at TIMESTAMP WITH TIME ZONE
+);
+
+-- one export at a time per user, asking again while it runs returns the same job
+CREATE UNIQUE INDEX IF NOT EXISTS export_jobs_active_user_idx ON export_jobs(user_id) WHERE status IN ('pending', 'running');
+CREATE INDEX IF NOT EXISTS export_jobs_queue_idx ON export_jobs(created_at) WHERE status IN ('pending', 'running');
+CREATE INDEX IF NOT EXISTS export_jobs_expires_at_idx ON export_jobs(expires_at);
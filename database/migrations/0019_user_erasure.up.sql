@@ -0,0 +1,58 @@
+-- erasing a user deletes the users row, every row pointing at it goes with it. Friend requests and blocks are
+-- removed for both sides, a row missing one of its users means nothing to the other one.
+ALTER TABLE sessions DROP CONSTRAINT IF EXISTS sessions_user_id_fkey;
+ALTER TABLE sessions ADD CONSTRAINT sessions_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+
+ALTER TABLE friend_request DROP CONSTRAINT IF EXISTS friend_request_request_from_fkey;
+ALTER TABLE friend_request ADD CONSTRAINT friend_request_request_from_fkey FOREIGN KEY (request_from) REFERENCES users(id) ON DELETE CASCADE;
+ALTER TABLE friend_request DROP CONSTRAINT IF EXISTS friend_request_request_to_fkey;
+ALTER TABLE friend_request ADD CONSTRAINT friend_request_request_to_fkey FOREIGN KEY (request_to) REFERENCES users(id) ON DELETE CASCADE;
+
+ALTER TABLE user_blocks DROP CONSTRAINT IF EXISTS user_blocks_blocker_id_fkey;
+ALTER TABLE user_blocks ADD CONSTRAINT user_blocks_blocker_id_fkey FOREIGN KEY (blocker_id) REFERENCES users(id) ON DELETE CASCADE;
+ALTER TABLE user_blocks DROP CONSTRAINT IF EXISTS user_blocks_blocked_id_fkey;
+ALTER TABLE user_blocks ADD CONSTRAINT user_blocks_blocked_id_fkey FOREIGN KEY (blocked_id) REFERENCES users(id) ON DELETE CASCADE;
+
+ALTER TABLE password_resets DROP CONSTRAINT IF EXISTS password_resets_user_id_fkey;
+ALTER TABLE password_resets ADD CONSTRAINT password_resets_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+
+ALTER TABLE email_verifications DROP CONSTRAINT IF EXISTS email_verifications_user_id_fkey;
+ALTER TABLE email_verifications ADD CONSTRAINT email_verifications_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+
+ALTER TABLE user_mfa DROP CONSTRAINT IF EXISTS user_mfa_user_id_fkey;
+ALTER TABLE user_mfa ADD CONSTRAINT user_mfa_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+ALTER TABLE mfa_recovery_codes DROP CONSTRAINT IF EXISTS mfa_recovery_codes_user_id_fkey;
+ALTER TABLE mfa_recovery_codes ADD CONSTRAINT mfa_recovery_codes_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+ALTER TABLE mfa_challenges DROP CONSTRAINT IF EXISTS mfa_challenges_user_id_fkey;
+ALTER TABLE mfa_challenges ADD CONSTRAINT mfa_challenges_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+
+ALTER TABLE export_jobs DROP CONSTRAINT IF EXISTS export_jobs_user_id_fkey;
+ALTER TABLE export_jobs ADD CONSTRAINT export_jobs_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+
+-- the tombstone of an erased user. user_id has no foreign key, the user is gone, and the email is only kept as its
+-- HMAC-SHA256 under account.erasure_key, so an erasure can be confirmed for an address without storing the address
+-- and the hashes cannot be reversed with a dictionary of emails.
+CREATE TABLE IF NOT EXISTS erasures(
+                                    id BIGSERIAL PRIMARY KEY NOT NULL ,
+                                    user_id INTEGER UNIQUE NOT NULL ,
+                                    email_hash TEXT NOT NULL ,
+                                    requested_by INTEGER ,
+                                    reason TEXT NOT NULL ,
+                                    erased_at TIMESTAMP WITH TIME ZONE DEFAULT now() NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS erasures_email_hash_idx ON erasures(email_hash);
+
+CREATE OR REPLACE FUNCTION erasures_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'erasures is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER erasures_append_only
+    BEFORE UPDATE OR DELETE ON erasures
+    FOR EACH ROW EXECUTE PROCEDURE erasures_append_only();
+
+CREATE TRIGGER erasures_no_truncate
+    BEFORE TRUNCATE ON erasures
+    FOR EACH STATEMENT EXECUTE PROCEDURE erasures_append_only();
@@ -0,0 +1,11 @@
+-- emails are looked up lower case, an address registered with capitals could never log in. A legacy row whose lower
+-- case address clashes with another account is left alone for an admin to sort out.
+UPDATE users u
+SET    email = lower(u.email)
+WHERE  u.email <> lower(u.email)
+AND    NOT EXISTS(SELECT 1
+                  FROM   users other
+                  WHERE  lower(other.email) = lower(u.email)
+                  AND    other.id <> u.id);
+
+ALTER TABLE users ADD CONSTRAINT users_email_lower_case CHECK (email = lower(email)) NOT VALID;
@@ -0,0 +1,96 @@
+// Package export puts everything stored about a user in a zip of json files, what GET /user/export hands out
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"firebaseAuth/audit"
+	"firebaseAuth/database/helper"
+	"fmt"
+	"time"
+)
+
+// Manifest is export.json, the first file of every archive
+type Manifest struct {
+	UserID      int       `json:"userId"`
+	GeneratedAt time.Time `json:"generatedAt"`
+	Files       []string  `json:"files"`
+}
+
+// FileName is what the archive of userID is called when it is downloaded
+func FileName(userID int) string {
+	return fmt.Sprintf("export-%d-%s.zip", userID, time.Now().UTC().Format("20060102"))
+}
+
+// Build collects the user row minus the password hash, every session, friend request and block, the two-factor
+// setup without its secrets and the audit entries about the user, and zips them one json file each
+func Build(ctx context.Context, recorder *audit.Recorder, userID int) ([]byte, error) {
+	user, err := helper.GetExportUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	sessions, err := helper.GetAllSessions(userID)
+	if err != nil {
+		return nil, err
+	}
+	friendRequests, err := helper.GetExportFriendRequests(userID)
+	if err != nil {
+		return nil, err
+	}
+	blocks, err := helper.GetExportBlocks(userID)
+	if err != nil {
+		return nil, err
+	}
+	mfa, err := helper.GetExportMFA(userID)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := recorder.ForUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []struct {
+		name    string
+		content interface{}
+	}{
+		{"user.json", user},
+		{"sessions.json", sessions},
+		{"friend_requests.json", friendRequests},
+		{"blocks.json", blocks},
+		{"mfa.json", mfa},
+		{"audit_log.json", entries},
+	}
+
+	manifest := Manifest{UserID: userID, GeneratedAt: time.Now().UTC()}
+	for _, file := range files {
+		manifest.Files = append(manifest.Files, file.name)
+	}
+
+	var archive bytes.Buffer
+	zipWriter := zip.NewWriter(&archive)
+	if err := writeJSON(zipWriter, "export.json", manifest); err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		if err := writeJSON(zipWriter, file.name, file.content); err != nil {
+			return nil, err
+		}
+	}
+	if err := zipWriter.Close(); err != nil {
+		return nil, err
+	}
+	return archive.Bytes(), nil
+}
+
+func writeJSON(zipWriter *zip.Writer, name string, content interface{}) error {
+	fileWriter, err := zipWriter.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(fileWriter)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(content)
+}
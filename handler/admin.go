@@ -0,0 +1,376 @@
+package handler
+
+import (
+	"database/sql"
+	"firebaseAuth/apperror"
+	"firebaseAuth/audit"
+	"firebaseAuth/database/helper"
+	"firebaseAuth/lockout"
+	"firebaseAuth/models"
+	"firebaseAuth/provider"
+	"firebaseAuth/utilities"
+	"firebaseAuth/validation"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SetUserRole changes the role of the user in the path. Admins cannot change their own role, so there is always one
+// left who can undo a mistake.
+func (h *Handler) SetUserRole(w http.ResponseWriter, r *http.Request) {
+	var roleChange models.RoleChange
+
+	decoderErr := utilities.Decoder(r, &roleChange)
+	if decoderErr != nil {
+		logrus.Printf("SetUserRole: Decoder error:%v", decoderErr)
+		utilities.RespondError(w, r, errInvalidBody)
+		return
+	}
+
+	if err := validation.Struct(roleChange); err != nil {
+		logrus.Printf("SetUserRole: validation error:%v", err)
+		utilities.RespondError(w, r, err)
+		return
+	}
+
+	contextValues, ok := r.Context().Value(utilities.UserContextKey).(models.ContextValues)
+	if !ok {
+		logrus.Printf("SetUserRole:QueryParam for ID:%v", ok)
+		utilities.RespondError(w, r, errMissingContext)
+		return
+	}
+
+	userID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		logrus.Printf("SetUserRole: invalid user id:%v", err)
+		utilities.RespondError(w, r, errInvalidID)
+		return
+	}
+	if userID == contextValues.ID {
+		logrus.Printf("SetUserRole: user %d tried to change their own role", userID)
+		utilities.RespondError(w, r, errOwnRole)
+		return
+	}
+
+	previous, err := helper.SetRole(userID, roleChange.Role)
+	if err != nil {
+		logrus.Printf("SetUserRole: cannot set role of user %d:%v", userID, err)
+		if err == sql.ErrNoRows {
+			err = apperror.Wrap(err, apperror.CodeNotFound, "user not found")
+		}
+		utilities.RespondError(w, r, err)
+		return
+	}
+
+	h.recordAudit(r, audit.EventAdminRoleChanged, contextValues.ID, userID, map[string]audit.Change{"role": {From: previous, To: roleChange.Role}})
+
+	userOutboundData := make(map[string]interface{})
+
+	userOutboundData["id"] = userID
+	userOutboundData["role"] = roleChange.Role
+
+	err = utilities.Encoder(w, userOutboundData)
+	if err != nil {
+		logrus.Printf("SetUserRole: encoding error:%v", err)
+		return
+	}
+}
+
+// ClearLockout lifts the login lockout of the email, ip and/or userId query params before it runs out, userId being
+// the two-factor lockout of that user
+func (h *Handler) ClearLockout(w http.ResponseWriter, r *http.Request) {
+	contextValues, ok := r.Context().Value(utilities.UserContextKey).(models.ContextValues)
+	if !ok {
+		logrus.Printf("ClearLockout:QueryParam for ID:%v", ok)
+		utilities.RespondError(w, r, errMissingContext)
+		return
+	}
+
+	keys := make([]string, 0, 3)
+	if email := r.URL.Query().Get("email"); email != "" {
+		keys = append(keys, lockout.EmailKey(email))
+	}
+	if ip := r.URL.Query().Get("ip"); ip != "" {
+		keys = append(keys, lockout.IPKey(ip))
+	}
+	if value := r.URL.Query().Get("userId"); value != "" {
+		userID, err := strconv.Atoi(value)
+		if err != nil {
+			logrus.Printf("ClearLockout: invalid userId:%v", err)
+			utilities.RespondError(w, r, errInvalidID)
+			return
+		}
+		keys = append(keys, lockout.MFAKey(userID))
+	}
+	if len(keys) == 0 {
+		logrus.Printf("ClearLockout: neither email, ip nor userId given")
+		utilities.RespondError(w, r, errMissingLockoutKey)
+		return
+	}
+
+	for _, key := range keys {
+		if err := h.Lockout.Clear(r.Context(), key); err != nil {
+			logrus.Printf("ClearLockout: cannot clear %s:%v", key, err)
+			utilities.RespondError(w, r, err)
+			return
+		}
+		h.recordAudit(r, audit.EventAdminLockoutCleared, contextValues.ID, 0, map[string]string{"key": key})
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListUsers searches all users. Query params: q (part of the name or email), archived (false, true or all),
+// disabled (true or false), createdFrom and createdTo (RFC 3339), emailDomain, limit and page.
+func (h *Handler) ListUsers(w http.ResponseWriter, r *http.Request) {
+	filterCheck, err := h.filters(r)
+	if err != nil {
+		logrus.Printf("ListUsers: filterCheck error:%v", err)
+		utilities.RespondError(w, r, err)
+		return
+	}
+
+	filter, err := adminUserFilter(r)
+	if err != nil {
+		logrus.Printf("ListUsers: invalid filter:%v", err)
+		utilities.RespondError(w, r, errInvalidUserFilter)
+		return
+	}
+	filter.Limit = filterCheck.Limit
+	filter.Page = filterCheck.Page
+
+	users, err := helper.SearchUsers(filter)
+	if err != nil {
+		logrus.Printf("ListUsers: cannot search users:%v", err)
+		utilities.RespondError(w, r, err)
+		return
+	}
+
+	err = utilities.Encoder(w, users)
+	if err != nil {
+		logrus.Printf("ListUsers: encoding error:%v", err)
+		return
+	}
+}
+
+func adminUserFilter(r *http.Request) (models.AdminUserFilter, error) {
+	query := r.URL.Query()
+	filter := models.AdminUserFilter{
+		Query:       strings.TrimSpace(query.Get("q")),
+		Archived:    query.Get("archived"),
+		Disabled:    query.Get("disabled"),
+		EmailDomain: strings.TrimSpace(query.Get("emailDomain")),
+	}
+
+	switch filter.Archived {
+	case "", "false", "true", "all":
+	default:
+		return filter, fmt.Errorf("archived %q", filter.Archived)
+	}
+	switch filter.Disabled {
+	case "", "false", "true":
+	default:
+		return filter, fmt.Errorf("disabled %q", filter.Disabled)
+	}
+
+	var err error
+	if createdFrom := query.Get("createdFrom"); createdFrom != "" {
+		if filter.CreatedFrom, err = time.Parse(time.RFC3339, createdFrom); err != nil {
+			return filter, err
+		}
+	}
+	if createdTo := query.Get("createdTo"); createdTo != "" {
+		if filter.CreatedTo, err = time.Parse(time.RFC3339, createdTo); err != nil {
+			return filter, err
+		}
+	}
+	return filter, nil
+}
+
+// GetUserDetails returns the full profile of any user with the active sessions, friend counts and two-factor state
+func (h *Handler) GetUserDetails(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		logrus.Printf("GetUserDetails: invalid user id:%v", err)
+		utilities.RespondError(w, r, errInvalidID)
+		return
+	}
+
+	user, err := helper.GetAdminUser(userID)
+	if err != nil {
+		logrus.Printf("GetUserDetails: cannot get user %d:%v", userID, err)
+		if err == sql.ErrNoRows {
+			err = apperror.Wrap(err, apperror.CodeNotFound, "user not found")
+		}
+		utilities.RespondError(w, r, err)
+		return
+	}
+
+	sessions, err := helper.GetActiveSessions(userID, h.Session.IdleTimeout)
+	if err != nil {
+		logrus.Printf("GetUserDetails: cannot get sessions:%v", err)
+		utilities.RespondError(w, r, err)
+		return
+	}
+
+	friendCounts, err := helper.GetFriendCounts(userID)
+	if err != nil {
+		logrus.Printf("GetUserDetails: cannot count friends:%v", err)
+		utilities.RespondError(w, r, err)
+		return
+	}
+
+	mfaEnabled, err := helper.MFAEnabled(userID)
+	if err != nil {
+		logrus.Printf("GetUserDetails: cannot check two-factor authentication:%v", err)
+		utilities.RespondError(w, r, err)
+		return
+	}
+
+	userDetails := models.AdminUserDetails{
+		AdminUser:    user,
+		MFAEnabled:   mfaEnabled,
+		FriendCounts: friendCounts,
+		Sessions:     sessions,
+	}
+
+	err = utilities.Encoder(w, userDetails)
+	if err != nil {
+		logrus.Printf("GetUserDetails: encoding error:%v", err)
+		return
+	}
+}
+
+// DisableUser blocks the user in the path from logging in, in Postgres and Firebase, and logs them out everywhere
+func (h *Handler) DisableUser(w http.ResponseWriter, r *http.Request) {
+	h.setDisabled(w, r, true)
+}
+
+// EnableUser lifts DisableUser, the user has to log in again
+func (h *Handler) EnableUser(w http.ResponseWriter, r *http.Request) {
+	h.setDisabled(w, r, false)
+}
+
+func (h *Handler) setDisabled(w http.ResponseWriter, r *http.Request, disabled bool) {
+	contextValues, ok := r.Context().Value(utilities.UserContextKey).(models.ContextValues)
+	if !ok {
+		logrus.Printf("setDisabled:QueryParam for ID:%v", ok)
+		utilities.RespondError(w, r, errMissingContext)
+		return
+	}
+
+	userID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		logrus.Printf("setDisabled: invalid user id:%v", err)
+		utilities.RespondError(w, r, errInvalidID)
+		return
+	}
+	if userID == contextValues.ID {
+		logrus.Printf("setDisabled: user %d tried to disable or enable their own account", userID)
+		utilities.RespondError(w, r, errOwnAccount)
+		return
+	}
+
+	loggedOut, err := helper.SetDisabled(userID, disabled, func(uid string) error {
+		_, providerErr := h.IdentityProvider.UpdateUser(r.Context(), uid, provider.UserToUpdate{Disabled: &disabled})
+		return providerErr
+	})
+	if err != nil {
+		logrus.Printf("setDisabled: cannot change user %d:%v", userID, err)
+		if err == sql.ErrNoRows {
+			err = apperror.Wrap(err, apperror.CodeNotFound, "user not found")
+		}
+		utilities.RespondError(w, r, err)
+		return
+	}
+
+	event := audit.EventAdminUserEnabled
+	if disabled {
+		event = audit.EventAdminUserDisabled
+	}
+	h.recordAudit(r, event, contextValues.ID, userID, map[string]int64{"loggedOutSessions": loggedOut})
+
+	userOutboundData := make(map[string]interface{})
+
+	userOutboundData["id"] = userID
+	userOutboundData["disabled"] = disabled
+	userOutboundData["loggedOutSessions"] = loggedOut
+
+	err = utilities.Encoder(w, userOutboundData)
+	if err != nil {
+		logrus.Printf("setDisabled: encoding error:%v", err)
+		return
+	}
+}
+
+// ForceLogout expires every session of the user in the path
+func (h *Handler) ForceLogout(w http.ResponseWriter, r *http.Request) {
+	contextValues, ok := r.Context().Value(utilities.UserContextKey).(models.ContextValues)
+	if !ok {
+		logrus.Printf("ForceLogout:QueryParam for ID:%v", ok)
+		utilities.RespondError(w, r, errMissingContext)
+		return
+	}
+
+	userID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		logrus.Printf("ForceLogout: invalid user id:%v", err)
+		utilities.RespondError(w, r, errInvalidID)
+		return
+	}
+
+	loggedOut, err := helper.LogoutAllSessions(userID)
+	if err != nil {
+		logrus.Printf("ForceLogout: cannot expire sessions of %d:%v", userID, err)
+		utilities.RespondError(w, r, err)
+		return
+	}
+
+	h.recordAudit(r, audit.EventAdminSessionsRevoked, contextValues.ID, userID, map[string]int64{"loggedOutSessions": loggedOut})
+
+	userOutboundData := make(map[string]int64)
+
+	userOutboundData["loggedOutSessions"] = loggedOut
+
+	err = utilities.Encoder(w, userOutboundData)
+	if err != nil {
+		logrus.Printf("ForceLogout: encoding error:%v", err)
+		return
+	}
+}
+
+// TriggerPasswordReset emails the user in the path a password reset link, as if they had used ForgotPassword
+func (h *Handler) TriggerPasswordReset(w http.ResponseWriter, r *http.Request) {
+	contextValues, ok := r.Context().Value(utilities.UserContextKey).(models.ContextValues)
+	if !ok {
+		logrus.Printf("TriggerPasswordReset:QueryParam for ID:%v", ok)
+		utilities.RespondError(w, r, errMissingContext)
+		return
+	}
+
+	userID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		logrus.Printf("TriggerPasswordReset: invalid user id:%v", err)
+		utilities.RespondError(w, r, errInvalidID)
+		return
+	}
+
+	userIdentity, err := helper.FetchUserIdentity(userID)
+	if err == nil {
+		err = h.sendPasswordReset(r.Context(), userIdentity.Email)
+	}
+	if err != nil {
+		logrus.Printf("TriggerPasswordReset: cannot send password reset to %d:%v", userID, err)
+		if err == sql.ErrNoRows {
+			err = apperror.Wrap(err, apperror.CodeNotFound, "user not found")
+		}
+		utilities.RespondError(w, r, err)
+		return
+	}
+
+	h.recordAudit(r, audit.EventAdminPasswordResetSent, contextValues.ID, userID, nil)
+	w.WriteHeader(http.StatusAccepted)
+}
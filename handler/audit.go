@@ -0,0 +1,112 @@
+package handler
+
+import (
+	"firebaseAuth/audit"
+	"firebaseAuth/models"
+	"firebaseAuth/utilities"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GetAuditLog lists audit entries newest first. Query params: from and to (RFC 3339), event (comma separated),
+// actorId, targetId, limit and page.
+func (h *Handler) GetAuditLog(w http.ResponseWriter, r *http.Request) {
+	contextValues, ok := r.Context().Value(utilities.UserContextKey).(models.ContextValues)
+	if !ok {
+		logrus.Printf("GetAuditLog:QueryParam for ID:%v", ok)
+		utilities.RespondError(w, r, errMissingContext)
+		return
+	}
+
+	filterCheck, err := h.filters(r)
+	if err != nil {
+		logrus.Printf("GetAuditLog: filterCheck error:%v", err)
+		utilities.RespondError(w, r, err)
+		return
+	}
+
+	filter, err := auditFilter(r)
+	if err != nil {
+		logrus.Printf("GetAuditLog: invalid filter:%v", err)
+		utilities.RespondError(w, r, errInvalidAuditFilter)
+		return
+	}
+	filter.Limit = filterCheck.Limit
+	filter.Page = filterCheck.Page
+
+	entries, err := h.Audit.Query(r.Context(), filter)
+	if err != nil {
+		logrus.Printf("GetAuditLog: cannot get audit log:%v", err)
+		utilities.RespondError(w, r, err)
+		return
+	}
+
+	h.recordAudit(r, audit.EventAdminAuditViewed, contextValues.ID, 0, r.URL.Query())
+
+	err = utilities.Encoder(w, entries)
+	if err != nil {
+		logrus.Printf("GetAuditLog: encoding error:%v", err)
+		return
+	}
+}
+
+func auditFilter(r *http.Request) (audit.Filter, error) {
+	query := r.URL.Query()
+	filter := audit.Filter{}
+
+	var err error
+	if from := query.Get("from"); from != "" {
+		if filter.From, err = time.Parse(time.RFC3339, from); err != nil {
+			return filter, err
+		}
+	}
+	if to := query.Get("to"); to != "" {
+		if filter.To, err = time.Parse(time.RFC3339, to); err != nil {
+			return filter, err
+		}
+	}
+	if actorID := query.Get("actorId"); actorID != "" {
+		if filter.ActorID, err = strconv.Atoi(actorID); err != nil {
+			return filter, err
+		}
+	}
+	if targetID := query.Get("targetId"); targetID != "" {
+		if filter.TargetID, err = strconv.Atoi(targetID); err != nil {
+			return filter, err
+		}
+	}
+	for _, events := range query["event"] {
+		for _, event := range strings.Split(events, ",") {
+			if event = strings.TrimSpace(event); event != "" {
+				filter.Events = append(filter.Events, audit.Event(event))
+			}
+		}
+	}
+	return filter, nil
+}
+
+// recordAudit appends event to the audit log. actorID and targetID 0 mean none. A failure is only logged, the
+// request it describes has already happened.
+func (h *Handler) recordAudit(r *http.Request, event audit.Event, actorID, targetID int, changes interface{}) {
+	entry, err := audit.NewEntry(r, event, actorID, targetID, changes)
+	if err != nil {
+		logrus.Errorf("recordAudit: cannot describe %s:%v", event, err)
+		return
+	}
+	if err := h.Audit.Record(r.Context(), entry); err != nil {
+		logrus.Errorf("recordAudit: cannot record %s:%v", event, err)
+	}
+}
+
+// auditDiff is the changes of an update event, the fields of before and after that differ
+func auditDiff(before, after interface{}) interface{} {
+	diff, err := audit.Diff(before, after)
+	if err != nil {
+		logrus.Printf("auditDiff: cannot compare:%v", err)
+		return nil
+	}
+	return diff
+}
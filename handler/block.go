@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"database/sql"
+	"firebaseAuth/apperror"
+	"firebaseAuth/database/helper"
+	"firebaseAuth/models"
+	"firebaseAuth/utilities"
+	"github.com/go-chi/chi/v5"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"strconv"
+)
+
+func (h *Handler) BlockUser(w http.ResponseWriter, r *http.Request) {
+	contextValues, ok := r.Context().Value(utilities.UserContextKey).(models.ContextValues)
+	if !ok {
+		logrus.Printf("BlockUser:QueryParam for ID:%v", ok)
+		utilities.RespondError(w, r, errMissingContext)
+		return
+	}
+
+	blockedID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		logrus.Printf("BlockUser: invalid user id:%v", err)
+		utilities.RespondError(w, r, errInvalidID)
+		return
+	}
+
+	err = helper.BlockUser(contextValues.ID, blockedID)
+	if err != nil {
+		logrus.Printf("BlockUser: cannot block user:%v", err)
+		utilities.RespondError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) UnblockUser(w http.ResponseWriter, r *http.Request) {
+	contextValues, ok := r.Context().Value(utilities.UserContextKey).(models.ContextValues)
+	if !ok {
+		logrus.Printf("UnblockUser:QueryParam for ID:%v", ok)
+		utilities.RespondError(w, r, errMissingContext)
+		return
+	}
+
+	blockedID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		logrus.Printf("UnblockUser: invalid user id:%v", err)
+		utilities.RespondError(w, r, errInvalidID)
+		return
+	}
+
+	err = helper.UnblockUser(contextValues.ID, blockedID)
+	if err != nil {
+		logrus.Printf("UnblockUser: cannot unblock user %d of %d:%v", blockedID, contextValues.ID, err)
+		if err == sql.ErrNoRows {
+			err = apperror.Wrap(err, apperror.CodeNotFound, "user is not blocked")
+		}
+		utilities.RespondError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) GetBlockedUsers(w http.ResponseWriter, r *http.Request) {
+	contextValues, ok := r.Context().Value(utilities.UserContextKey).(models.ContextValues)
+	if !ok {
+		logrus.Printf("GetBlockedUsers:QueryParam for ID:%v", ok)
+		utilities.RespondError(w, r, errMissingContext)
+		return
+	}
+
+	filterCheck, err := h.filters(r)
+	if err != nil {
+		logrus.Printf("GetBlockedUsers: filterCheck error:%v", err)
+		utilities.RespondError(w, r, err)
+		return
+	}
+
+	blockedUsers, err := helper.GetBlockedUsers(filterCheck, contextValues.ID)
+	if err != nil {
+		logrus.Printf("GetBlockedUsers: cannot get blocked users:%v", err)
+		utilities.RespondError(w, r, err)
+		return
+	}
+
+	err = utilities.Encoder(w, blockedUsers)
+	if err != nil {
+		logrus.Printf("GetBlockedUsers: encoding error:%v", err)
+		return
+	}
+}
@@ -0,0 +1,195 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"firebaseAuth/apperror"
+	"firebaseAuth/audit"
+	"firebaseAuth/database/helper"
+	"firebaseAuth/lockout"
+	"firebaseAuth/models"
+	"firebaseAuth/provider"
+	"firebaseAuth/utilities"
+	"firebaseAuth/validation"
+	"github.com/go-chi/chi/v5"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"strconv"
+)
+
+// EraseAccount deletes the caller for good once they confirm their password. Unlike DELETE /user there is no grace
+// period, the answer is the tombstone of the account.
+func (h *Handler) EraseAccount(w http.ResponseWriter, r *http.Request) {
+	var confirmation models.PasswordConfirmation
+
+	decoderErr := utilities.Decoder(r, &confirmation)
+	if decoderErr != nil {
+		logrus.Printf("EraseAccount: Decoder error:%v", decoderErr)
+		utilities.RespondError(w, r, errInvalidBody)
+		return
+	}
+
+	if err := validation.Struct(confirmation); err != nil {
+		logrus.Printf("EraseAccount: validation error:%v", err)
+		utilities.RespondError(w, r, err)
+		return
+	}
+
+	contextValues, ok := r.Context().Value(utilities.UserContextKey).(models.ContextValues)
+	if !ok {
+		logrus.Printf("EraseAccount:QueryParam for ID:%v", ok)
+		utilities.RespondError(w, r, errMissingContext)
+		return
+	}
+
+	userIdentity, err := h.confirmPassword(contextValues.ID, confirmation.Password)
+	if err != nil {
+		logrus.Printf("EraseAccount: cannot confirm password:%v", err)
+		utilities.RespondError(w, r, err)
+		return
+	}
+
+	erasure, err := h.eraseUser(r, contextValues.ID, userIdentity.Email, contextValues.ID, models.ErasureUserRequest)
+	if err != nil {
+		logrus.Printf("EraseAccount: cannot erase:%v", err)
+		utilities.RespondError(w, r, err)
+		return
+	}
+
+	err = utilities.Encoder(w, erasure)
+	if err != nil {
+		logrus.Printf("EraseAccount: encoding error:%v", err)
+		return
+	}
+}
+
+// EraseUser deletes the user in the path for good, archived and disabled ones included. Admins erase their own
+// account through DELETE /user/erase.
+func (h *Handler) EraseUser(w http.ResponseWriter, r *http.Request) {
+	contextValues, ok := r.Context().Value(utilities.UserContextKey).(models.ContextValues)
+	if !ok {
+		logrus.Printf("EraseUser:QueryParam for ID:%v", ok)
+		utilities.RespondError(w, r, errMissingContext)
+		return
+	}
+
+	userID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		logrus.Printf("EraseUser: invalid user id:%v", err)
+		utilities.RespondError(w, r, errInvalidID)
+		return
+	}
+	if userID == contextValues.ID {
+		logrus.Printf("EraseUser: user %d tried to erase their own account", userID)
+		utilities.RespondError(w, r, errOwnErasure)
+		return
+	}
+
+	user, err := helper.GetAdminUser(userID)
+	if err != nil {
+		logrus.Printf("EraseUser: cannot get user %d:%v", userID, err)
+		if err == sql.ErrNoRows {
+			err = apperror.Wrap(err, apperror.CodeNotFound, "user not found")
+		}
+		utilities.RespondError(w, r, err)
+		return
+	}
+
+	erasure, err := h.eraseUser(r, userID, user.Email, contextValues.ID, models.ErasureAdminRequest)
+	if err != nil {
+		logrus.Printf("EraseUser: cannot erase user %d:%v", userID, err)
+		if err == sql.ErrNoRows {
+			err = apperror.Wrap(err, apperror.CodeNotFound, "user not found")
+		}
+		utilities.RespondError(w, r, err)
+		return
+	}
+
+	h.recordErasureAudit(r.Context(), audit.EventAdminUserErased, contextValues.ID, map[string]int64{"erasureId": erasure.ID})
+
+	err = utilities.Encoder(w, erasure)
+	if err != nil {
+		logrus.Printf("EraseUser: encoding error:%v", err)
+		return
+	}
+}
+
+// GetErasures looks up the tombstones of erased users by userId or email, the proof an account was erased
+func (h *Handler) GetErasures(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	userID := 0
+	if value := query.Get("userId"); value != "" {
+		var err error
+		userID, err = strconv.Atoi(value)
+		if err != nil {
+			logrus.Printf("GetErasures: invalid userId:%v", err)
+			utilities.RespondError(w, r, errInvalidID)
+			return
+		}
+	}
+
+	emailHash := ""
+	if email := query.Get("email"); email != "" {
+		emailHash = helper.EmailHash(h.ErasureKey, email)
+	}
+
+	if userID == 0 && emailHash == "" {
+		utilities.RespondError(w, r, errMissingErasureKey)
+		return
+	}
+
+	erasures, err := helper.GetErasures(userID, emailHash)
+	if err != nil {
+		logrus.Printf("GetErasures: cannot get erasures:%v", err)
+		utilities.RespondError(w, r, err)
+		return
+	}
+
+	err = utilities.Encoder(w, erasures)
+	if err != nil {
+		logrus.Printf("GetErasures: encoding error:%v", err)
+		return
+	}
+}
+
+// eraseUser erases userID in Postgres and the identity provider, a provider user that is already gone does not stop
+// it, then forgets the failed logins of its email and records the erasure
+func (h *Handler) eraseUser(r *http.Request, userID int, email string, requestedBy int, reason string) (models.Erasure, error) {
+	erasure, err := helper.EraseUser(userID, requestedBy, reason, h.ErasureKey, func(uid string) error {
+		providerErr := h.IdentityProvider.DeleteUser(r.Context(), uid)
+		if errors.Is(providerErr, provider.ErrUserNotFound) {
+			return nil
+		}
+		return providerErr
+	})
+	if err != nil {
+		return erasure, err
+	}
+
+	if err := h.Lockout.Clear(r.Context(), lockout.EmailKey(email)); err != nil {
+		logrus.Printf("eraseUser: cannot clear the lockout of %d:%v", userID, err)
+	}
+
+	actorID := requestedBy
+	if actorID == userID {
+		actorID = 0
+	}
+	h.recordErasureAudit(r.Context(), audit.EventAccountErased, actorID, map[string]interface{}{"reason": reason, "erasureId": erasure.ID})
+	return erasure, nil
+}
+
+// recordErasureAudit records an event about an erasure after helper.EraseUser scrubbed the erased user from the
+// log. It is written without the request, whose ip and user agent may be the erased user's, and names the erased
+// user only through the erasureId of its tombstone.
+func (h *Handler) recordErasureAudit(ctx context.Context, event audit.Event, actorID int, changes interface{}) {
+	entry, err := audit.NewEntry(nil, event, actorID, 0, changes)
+	if err != nil {
+		logrus.Errorf("recordErasureAudit: cannot describe %s:%v", event, err)
+		return
+	}
+	if err := h.Audit.Record(ctx, entry); err != nil {
+		logrus.Errorf("recordErasureAudit: cannot record %s:%v", event, err)
+	}
+}
@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"bytes"
+	"firebaseAuth/audit"
+	"firebaseAuth/config"
+	"firebaseAuth/database"
+	"firebaseAuth/lockout"
+	"firebaseAuth/models"
+	"firebaseAuth/provider"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestEraseUserAuditHasNoTraceOfTheUser(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := database.FirebaseDB
+	database.FirebaseDB = sqlx.NewDb(db, "postgres")
+	defer func() {
+		database.FirebaseDB = previous
+		db.Close()
+	}()
+
+	memoryProvider, err := provider.NewMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &Handler{
+		IdentityProvider: memoryProvider,
+		Lockout:          lockout.NewGuard(lockout.NewMemory(), config.Default().Lockout),
+		ErasureKey:       bytes.Repeat([]byte{3}, 32),
+		Audit:            audit.NewRecorder(),
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FOR UPDATE`).WithArgs(42).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "user_uid", "role"}).AddRow(42, "someone@example.com", "", models.RoleUser))
+	mock.ExpectQuery(`INSERT INTO erasures`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "email_hash", "requested_by", "reason", "erased_at"}).
+			AddRow(5, 42, "hash", 42, models.ErasureUserRequest, time.Now()))
+	mock.ExpectExec(`SET LOCAL audit.erasing`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`UPDATE audit_log`).WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectExec(`DELETE FROM users`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectExec(`INSERT INTO audit_log`).
+		WithArgs(audit.EventAccountErased, nil, nil, "", "", `{"erasureId":5,"reason":"user_request"}`).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	r := httptest.NewRequest(http.MethodDelete, "/user/erase", nil)
+	r.Header.Set("User-Agent", "erased-users-browser")
+	if _, err := h.eraseUser(r, 42, "someone@example.com", 42, models.ErasureUserRequest); err != nil {
+		t.Fatalf("eraseUser: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
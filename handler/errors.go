@@ -0,0 +1,26 @@
+package handler
+
+import "firebaseAuth/apperror"
+
+// errors the handlers answer with before a request reaches the helper layer
+var (
+	errInvalidBody              = apperror.New(apperror.CodeBadRequest, "request body is not valid json")
+	errInvalidID                = apperror.New(apperror.CodeBadRequest, "id in the path must be a number")
+	errInvalidAuditFilter       = apperror.New(apperror.CodeBadRequest, "from and to must be RFC 3339 times, actorId and targetId numbers")
+	errOwnAccount               = apperror.New(apperror.CodeForbidden, "admins cannot disable or enable their own account")
+	errInvalidUserFilter        = apperror.New(apperror.CodeBadRequest, "archived must be false, true or all, disabled true or false and createdFrom and createdTo RFC 3339 times")
+	errOwnErasure               = apperror.New(apperror.CodeForbidden, "admins erase their own account through DELETE /user/erase")
+	errMissingErasureKey        = apperror.New(apperror.CodeBadRequest, "userId or email query param is required")
+	errOwnRole                  = apperror.New(apperror.CodeForbidden, "admins cannot change their own role")
+	errMissingLockoutKey        = apperror.New(apperror.CodeBadRequest, "email, ip or userId query param is required")
+	errInvalidExportMode        = apperror.New(apperror.CodeBadRequest, "async must be true or false")
+	errExportNotReady           = apperror.New(apperror.CodeConflict, "export is not ready, check its status")
+	errInvalidFilters           = apperror.New(apperror.CodeBadRequest, "limit and page must be numbers")
+	errMissingContext           = apperror.New(apperror.CodeInternal, "internal server error")
+	errTooManyLoginAttempts     = apperror.New(apperror.CodeTooManyRequests, "too many failed logins, try again later")
+	errWrongCredentials         = apperror.New(apperror.CodeUnauthorized, "wrong email or password")
+	errWrongPassword            = apperror.New(apperror.CodeForbidden, "current password is incorrect")
+	errInvalidResetToken        = apperror.New(apperror.CodeBadRequest, "reset token is invalid or expired")
+	errInvalidVerificationToken = apperror.New(apperror.CodeBadRequest, "verification token is invalid or expired")
+	errInvalidMFAChallenge      = apperror.New(apperror.CodeUnauthorized, "two-factor challenge is invalid or expired, log in again")
+)
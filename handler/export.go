@@ -0,0 +1,169 @@
+package handler
+
+import (
+	"database/sql"
+	"firebaseAuth/apperror"
+	"firebaseAuth/audit"
+	"firebaseAuth/database/helper"
+	"firebaseAuth/export"
+	"firebaseAuth/models"
+	"firebaseAuth/utilities"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"strconv"
+)
+
+// ExportData hands the caller a zip of everything stored about them. Small accounts get it in the response, bigger
+// ones, or any with ?async=true, get a 202 with a job to poll at GET /user/export/jobs/{id}.
+func (h *Handler) ExportData(w http.ResponseWriter, r *http.Request) {
+	contextValues, ok := r.Context().Value(utilities.UserContextKey).(models.ContextValues)
+	if !ok {
+		logrus.Printf("ExportData:QueryParam for ID:%v", ok)
+		utilities.RespondError(w, r, errMissingContext)
+		return
+	}
+
+	async := false
+	if value := r.URL.Query().Get("async"); value != "" {
+		var err error
+		async, err = strconv.ParseBool(value)
+		if err != nil {
+			logrus.Printf("ExportData: invalid async:%v", err)
+			utilities.RespondError(w, r, errInvalidExportMode)
+			return
+		}
+	}
+
+	if !async {
+		rows, err := helper.CountExportRows(contextValues.ID)
+		if err != nil {
+			logrus.Printf("ExportData: cannot size export:%v", err)
+			utilities.RespondError(w, r, err)
+			return
+		}
+		async = rows > h.Export.SyncMaxRows
+	}
+
+	if !async {
+		archive, err := export.Build(r.Context(), h.Audit, contextValues.ID)
+		if err != nil {
+			logrus.Printf("ExportData: cannot build export:%v", err)
+			utilities.RespondError(w, r, err)
+			return
+		}
+		h.recordAudit(r, audit.EventAccountExported, contextValues.ID, contextValues.ID, map[string]string{"mode": "sync"})
+		writeArchive(w, contextValues.ID, archive)
+		return
+	}
+
+	job, err := helper.CreateExportJob(contextValues.ID)
+	if err != nil {
+		logrus.Printf("ExportData: cannot queue export:%v", err)
+		utilities.RespondError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Location", exportJobURL(job.ID))
+	w.WriteHeader(http.StatusAccepted)
+	err = utilities.Encoder(w, job)
+	if err != nil {
+		logrus.Printf("ExportData: encoding error:%v", err)
+		return
+	}
+}
+
+// GetExportJob reports how an asynchronous export of the caller is doing, with its download url once it is done
+func (h *Handler) GetExportJob(w http.ResponseWriter, r *http.Request) {
+	contextValues, ok := r.Context().Value(utilities.UserContextKey).(models.ContextValues)
+	if !ok {
+		logrus.Printf("GetExportJob:QueryParam for ID:%v", ok)
+		utilities.RespondError(w, r, errMissingContext)
+		return
+	}
+
+	jobID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		logrus.Printf("GetExportJob: invalid job id:%v", err)
+		utilities.RespondError(w, r, errInvalidID)
+		return
+	}
+
+	job, err := helper.GetExportJob(contextValues.ID, jobID)
+	if err != nil {
+		logrus.Printf("GetExportJob: cannot get export job:%v", err)
+		if err == sql.ErrNoRows {
+			err = apperror.Wrap(err, apperror.CodeNotFound, "no export job with this id")
+		}
+		utilities.RespondError(w, r, err)
+		return
+	}
+
+	if job.Status == models.ExportDone {
+		job.DownloadURL = exportJobURL(job.ID) + "/download"
+	}
+
+	err = utilities.Encoder(w, job)
+	if err != nil {
+		logrus.Printf("GetExportJob: encoding error:%v", err)
+		return
+	}
+}
+
+// DownloadExport serves the archive of a finished asynchronous export of the caller until it expires
+func (h *Handler) DownloadExport(w http.ResponseWriter, r *http.Request) {
+	contextValues, ok := r.Context().Value(utilities.UserContextKey).(models.ContextValues)
+	if !ok {
+		logrus.Printf("DownloadExport:QueryParam for ID:%v", ok)
+		utilities.RespondError(w, r, errMissingContext)
+		return
+	}
+
+	jobID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		logrus.Printf("DownloadExport: invalid job id:%v", err)
+		utilities.RespondError(w, r, errInvalidID)
+		return
+	}
+
+	job, err := helper.GetExportJob(contextValues.ID, jobID)
+	if err != nil {
+		logrus.Printf("DownloadExport: cannot get export job:%v", err)
+		if err == sql.ErrNoRows {
+			err = apperror.Wrap(err, apperror.CodeNotFound, "no export job with this id")
+		}
+		utilities.RespondError(w, r, err)
+		return
+	}
+	if job.Status != models.ExportDone {
+		utilities.RespondError(w, r, errExportNotReady)
+		return
+	}
+
+	archive, err := helper.GetExportArchive(contextValues.ID, jobID)
+	if err != nil {
+		logrus.Printf("DownloadExport: cannot get archive:%v", err)
+		if err == sql.ErrNoRows {
+			err = apperror.Wrap(err, apperror.CodeNotFound, "export expired")
+		}
+		utilities.RespondError(w, r, err)
+		return
+	}
+
+	h.recordAudit(r, audit.EventAccountExported, contextValues.ID, contextValues.ID, map[string]interface{}{"mode": "async", "jobId": jobID})
+	writeArchive(w, contextValues.ID, archive)
+}
+
+func writeArchive(w http.ResponseWriter, userID int, archive []byte) {
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", export.FileName(userID)))
+	w.Header().Set("Content-Length", strconv.Itoa(len(archive)))
+	if _, err := w.Write(archive); err != nil {
+		logrus.Printf("writeArchive: cannot write archive:%v", err)
+	}
+}
+
+func exportJobURL(jobID int) string {
+	return "/user/export/jobs/" + strconv.Itoa(jobID)
+}
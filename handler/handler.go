@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"context"
+	"firebaseAuth/audit"
+	"firebaseAuth/config"
+	"firebaseAuth/lockout"
+	"firebaseAuth/mailer"
+	"firebaseAuth/provider"
+	"firebaseAuth/secrets"
+	"sync"
+	"time"
+)
+
+// Handler carries the dependencies shared by the http handlers, it is built once in main
+type Handler struct {
+	IdentityProvider provider.IdentityProvider
+	Pagination       config.Pagination
+	Session          config.Session
+	Friends          config.Friends
+	Password         config.Password
+	Verification     config.Verification
+	MFA              config.MFA
+	SecretBox        *secrets.Box
+	Mailer           mailer.Mailer
+	Lockout          *lockout.Guard
+	Account          config.Account
+	ErasureKey       []byte
+	Export           config.Export
+	Audit            *audit.Recorder
+
+	// background tracks the work handlers leave running after they answered, see goBackground
+	background sync.WaitGroup
+}
+
+func NewHandler(cfg config.Config, identityProvider provider.IdentityProvider, mail mailer.Mailer, guard *lockout.Guard, recorder *audit.Recorder) *Handler {
+	// the keys were checked by config.Validate
+	key, _ := secrets.DecodeKey(cfg.MFA.SecretKey)
+	secretBox, _ := secrets.NewBox(key)
+	erasureKey, _ := secrets.DecodeKey(cfg.Account.ErasureKey)
+	return &Handler{
+		IdentityProvider: identityProvider,
+		Pagination:       cfg.Pagination,
+		Session:          cfg.Session,
+		Friends:          cfg.Friends,
+		Password:         cfg.Password,
+		Verification:     cfg.Verification,
+		MFA:              cfg.MFA,
+		SecretBox:        secretBox,
+		Mailer:           mail,
+		Lockout:          guard,
+		Account:          cfg.Account,
+		ErasureKey:       erasureKey,
+		Export:           cfg.Export,
+		Audit:            recorder,
+	}
+}
+
+// goBackground runs fn after the handler answered, under its own timeout since the request context ends with the
+// response. Server.Run waits for it with WaitBackground on shutdown so the work is not cut off halfway.
+func (h *Handler) goBackground(timeout time.Duration, fn func(ctx context.Context)) {
+	h.background.Add(1)
+	go func() {
+		defer h.background.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		fn(ctx)
+	}()
+}
+
+// WaitBackground blocks until the work started by goBackground is done
+func (h *Handler) WaitBackground() {
+	h.background.Wait()
+}
@@ -0,0 +1,251 @@
+package handler
+
+import (
+	"database/sql"
+	"firebaseAuth/audit"
+	"firebaseAuth/database/helper"
+	"firebaseAuth/models"
+	"firebaseAuth/totp"
+	"firebaseAuth/utilities"
+	"firebaseAuth/validation"
+	"github.com/sirupsen/logrus"
+	"net/http"
+)
+
+// EnrollTOTP starts two-factor enrollment and returns the secret to add to an authenticator app. Nothing changes
+// for the login until ConfirmTOTP succeeds.
+func (h *Handler) EnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	contextValues, ok := r.Context().Value(utilities.UserContextKey).(models.ContextValues)
+	if !ok {
+		logrus.Printf("EnrollTOTP:QueryParam for ID:%v", ok)
+		utilities.RespondError(w, r, errMissingContext)
+		return
+	}
+
+	userIdentity, err := helper.FetchUserIdentity(contextValues.ID)
+	if err != nil {
+		logrus.Printf("EnrollTOTP: cannot get user:%v", err)
+		utilities.RespondError(w, r, err)
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		logrus.Printf("EnrollTOTP: cannot generate secret:%v", err)
+		utilities.RespondError(w, r, err)
+		return
+	}
+
+	err = helper.StartTOTPEnrollment(contextValues.ID, secret, h.SecretBox)
+	if err != nil {
+		logrus.Printf("EnrollTOTP: cannot start enrollment:%v", err)
+		utilities.RespondError(w, r, err)
+		return
+	}
+
+	enrollment := models.TOTPEnrollment{
+		Secret: secret,
+		URI:    totp.URI(h.MFA.Issuer, userIdentity.Email, secret),
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	err = utilities.Encoder(w, enrollment)
+	if err != nil {
+		logrus.Printf("EnrollTOTP: encoding error:%v", err)
+		return
+	}
+}
+
+// ConfirmTOTP enables two-factor authentication with a first code from the app and returns the recovery codes
+func (h *Handler) ConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	var mfaCode models.MFACode
+
+	decoderErr := utilities.Decoder(r, &mfaCode)
+	if decoderErr != nil {
+		logrus.Printf("ConfirmTOTP: Decoder error:%v", decoderErr)
+		utilities.RespondError(w, r, errInvalidBody)
+		return
+	}
+
+	if err := validation.Struct(mfaCode); err != nil {
+		logrus.Printf("ConfirmTOTP: validation error:%v", err)
+		utilities.RespondError(w, r, err)
+		return
+	}
+
+	contextValues, ok := r.Context().Value(utilities.UserContextKey).(models.ContextValues)
+	if !ok {
+		logrus.Printf("ConfirmTOTP:QueryParam for ID:%v", ok)
+		utilities.RespondError(w, r, errMissingContext)
+		return
+	}
+
+	recoveryCodes, err := helper.ConfirmTOTP(contextValues.ID, mfaCode.Code, h.SecretBox)
+	if err != nil {
+		logrus.Printf("ConfirmTOTP: cannot confirm:%v", err)
+		utilities.RespondError(w, r, err)
+		return
+	}
+
+	h.recordAudit(r, audit.EventMFAEnabled, contextValues.ID, contextValues.ID, map[string]string{"method": "totp"})
+
+	userOutboundData := make(map[string][]string)
+
+	userOutboundData["recoveryCodes"] = recoveryCodes
+
+	err = utilities.Encoder(w, userOutboundData)
+	if err != nil {
+		logrus.Printf("ConfirmTOTP: encoding error:%v", err)
+		return
+	}
+}
+
+// DisableTOTP turns two-factor authentication off, it takes the password and a current TOTP code or one of the
+// recovery codes. Wrong codes count towards the two-factor lockout like they do at login.
+func (h *Handler) DisableTOTP(w http.ResponseWriter, r *http.Request) {
+	var mfaDisable models.MFADisable
+
+	decoderErr := utilities.Decoder(r, &mfaDisable)
+	if decoderErr != nil {
+		logrus.Printf("DisableTOTP: Decoder error:%v", decoderErr)
+		utilities.RespondError(w, r, errInvalidBody)
+		return
+	}
+
+	if err := validation.Struct(mfaDisable); err != nil {
+		logrus.Printf("DisableTOTP: validation error:%v", err)
+		utilities.RespondError(w, r, err)
+		return
+	}
+
+	contextValues, ok := r.Context().Value(utilities.UserContextKey).(models.ContextValues)
+	if !ok {
+		logrus.Printf("DisableTOTP:QueryParam for ID:%v", ok)
+		utilities.RespondError(w, r, errMissingContext)
+		return
+	}
+
+	if _, err := h.confirmPassword(contextValues.ID, mfaDisable.Password); err != nil {
+		logrus.Printf("DisableTOTP: cannot confirm password:%v", err)
+		utilities.RespondError(w, r, err)
+		return
+	}
+
+	clientIP := utilities.ClientIP(r)
+	if !h.checkMFALockout(w, r, contextValues.ID, clientIP) {
+		return
+	}
+
+	err := helper.DisableMFA(contextValues.ID, mfaDisable.Code, h.SecretBox)
+	if err != nil {
+		logrus.Printf("DisableTOTP: cannot disable:%v", err)
+		if err == helper.ErrInvalidMFACode {
+			h.mfaFailed(r, contextValues.ID, clientIP)
+		}
+		utilities.RespondError(w, r, err)
+		return
+	}
+
+	if err := h.Lockout.SucceedMFA(r.Context(), contextValues.ID); err != nil {
+		logrus.Printf("DisableTOTP: cannot reset wrong codes:%v", err)
+	}
+
+	h.recordAudit(r, audit.EventMFADisabled, contextValues.ID, contextValues.ID, map[string]string{"method": "totp"})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// LoginMFA is the second login step for users with two-factor authentication, it finishes what Login started
+func (h *Handler) LoginMFA(w http.ResponseWriter, r *http.Request) {
+	var mfaLogin models.MFALogin
+
+	decoderErr := utilities.Decoder(r, &mfaLogin)
+	if decoderErr != nil {
+		logrus.Printf("LoginMFA: Decoder error:%v", decoderErr)
+		utilities.RespondError(w, r, errInvalidBody)
+		return
+	}
+
+	if err := validation.Struct(mfaLogin); err != nil {
+		logrus.Printf("LoginMFA: validation error:%v", err)
+		utilities.RespondError(w, r, err)
+		return
+	}
+
+	// every new challenge comes with fresh attempts, the lockout of the user is what limits guessing overall
+	userID, err := helper.MFAChallengeUser(mfaLogin.MFAToken, h.MFA.MaxAttempts)
+	if err != nil {
+		logrus.Printf("LoginMFA: cannot get challenge:%v", err)
+		if err == sql.ErrNoRows {
+			err = errInvalidMFAChallenge
+		}
+		utilities.RespondError(w, r, err)
+		return
+	}
+
+	clientIP := utilities.ClientIP(r)
+	if !h.checkMFALockout(w, r, userID, clientIP) {
+		return
+	}
+
+	challenge, err := helper.ClaimMFAChallenge(mfaLogin.MFAToken, mfaLogin.Code, h.MFA.MaxAttempts, h.SecretBox)
+	if err != nil {
+		logrus.Printf("LoginMFA: cannot claim challenge:%v", err)
+		if err == helper.ErrInvalidMFACode {
+			h.recordAudit(r, audit.EventLoginFailed, 0, challenge.UserID, map[string]string{"reason": "wrong_mfa_code"})
+			h.mfaFailed(r, challenge.UserID, clientIP)
+		}
+		if err == sql.ErrNoRows {
+			err = errInvalidMFAChallenge
+		}
+		utilities.RespondError(w, r, err)
+		return
+	}
+
+	if err := h.Lockout.SucceedMFA(r.Context(), challenge.UserID); err != nil {
+		logrus.Printf("LoginMFA: cannot reset wrong codes:%v", err)
+	}
+
+	userIdentity, err := helper.FetchUserIdentity(challenge.UserID)
+	if err == sql.ErrNoRows {
+		// the password step accepts deactivated accounts in their grace period, this is where the login completes
+		err = h.reactivateAccount(r, challenge.UserID)
+		if err == nil {
+			userIdentity, err = helper.FetchUserIdentity(challenge.UserID)
+		}
+	}
+	if err != nil {
+		logrus.Printf("LoginMFA: cannot get user:%v", err)
+		utilities.RespondError(w, r, err)
+		return
+	}
+
+	h.startSession(w, r, userIdentity, challenge.DeviceName)
+}
+
+// checkMFALockout answers 429 and returns false while the two-factor step of userID, or ip, is locked out
+func (h *Handler) checkMFALockout(w http.ResponseWriter, r *http.Request, userID int, clientIP string) bool {
+	wait, err := h.Lockout.CheckMFA(r.Context(), userID, clientIP)
+	if err != nil {
+		logrus.Printf("checkMFALockout: cannot check lockout:%v", err)
+		utilities.RespondError(w, r, err)
+		return false
+	}
+	if wait > 0 {
+		logrus.Printf("checkMFALockout: two-factor of user %d from %s is locked out for %s", userID, clientIP, wait)
+		respondLockedOut(w, r, wait)
+		return false
+	}
+	return true
+}
+
+// mfaFailed counts a wrong two-factor code towards the lockout of the user and the client ip
+func (h *Handler) mfaFailed(r *http.Request, userID int, clientIP string) {
+	wait, err := h.Lockout.FailMFA(r.Context(), userID, clientIP)
+	if err != nil {
+		logrus.Printf("mfaFailed: cannot count wrong code:%v", err)
+		return
+	}
+	if wait > 0 {
+		logrus.Printf("mfaFailed: two-factor of user %d from %s has to wait %s", userID, clientIP, wait)
+	}
+}
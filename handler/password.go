@@ -0,0 +1,185 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"firebaseAuth/audit"
+	"firebaseAuth/database/helper"
+	"firebaseAuth/mailer"
+	"firebaseAuth/models"
+	"firebaseAuth/provider"
+	"firebaseAuth/utilities"
+	"firebaseAuth/validation"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// forgotPasswordTimeout bounds the work ForgotPassword leaves running after it answered
+const forgotPasswordTimeout = 30 * time.Second
+
+// ForgotPassword emails a password reset link. It answers the same whether or not the email is registered, so it
+// cannot be used to find out which addresses have an account.
+func (h *Handler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var forgotPassword models.EmailRequest
+
+	decoderErr := utilities.Decoder(r, &forgotPassword)
+	if decoderErr != nil {
+		logrus.Printf("ForgotPassword: Decoder error:%v", decoderErr)
+		utilities.RespondError(w, r, errInvalidBody)
+		return
+	}
+
+	if err := validation.Struct(forgotPassword); err != nil {
+		logrus.Printf("ForgotPassword: validation error:%v", err)
+		utilities.RespondError(w, r, err)
+		return
+	}
+
+	// the token and the mail are done after the answer, for every email, so the response time does not tell a
+	// registered address from an unknown one
+	email := forgotPassword.Email
+	h.goBackground(forgotPasswordTimeout, func(ctx context.Context) {
+		err := h.sendPasswordReset(ctx, email)
+		switch {
+		case err == sql.ErrNoRows:
+			logrus.Printf("ForgotPassword: no user with the requested email")
+		case err != nil:
+			logrus.Errorf("ForgotPassword: cannot send password reset:%v", err)
+		}
+	})
+
+	userOutboundData := make(map[string]string)
+
+	userOutboundData["message"] = "if the email belongs to an account, a reset link has been sent to it"
+
+	w.WriteHeader(http.StatusAccepted)
+	err := utilities.Encoder(w, userOutboundData)
+	if err != nil {
+		logrus.Printf("ForgotPassword: encoding error:%v", err)
+		return
+	}
+}
+
+// sendPasswordReset creates a reset token for the user with email and mails the link to it. sql.ErrNoRows means
+// there is no such user. A mail that cannot be sent is only logged, the token stays valid.
+func (h *Handler) sendPasswordReset(ctx context.Context, email string) error {
+	token, err := helper.CreatePasswordReset(email, h.Password.ResetTokenTTL)
+	if err != nil {
+		return err
+	}
+
+	message := mailer.Message{
+		To:      email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Someone asked to reset the password of your account.\n\n"+
+			"Open this link within %s to choose a new password:\n%s\n\n"+
+			"If it was not you, ignore this email and your password stays the same.\n",
+			h.Password.ResetTokenTTL, linkWithToken(h.Password.ResetURL, token)),
+	}
+	if err := h.Mailer.Send(ctx, message); err != nil {
+		logrus.Errorf("sendPasswordReset: cannot send reset email:%v", err)
+	}
+	return nil
+}
+
+// ResetPassword sets a new password with a token from ForgotPassword and logs the user out everywhere
+func (h *Handler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var passwordReset models.PasswordReset
+
+	decoderErr := utilities.Decoder(r, &passwordReset)
+	if decoderErr != nil {
+		logrus.Printf("ResetPassword: Decoder error:%v", decoderErr)
+		utilities.RespondError(w, r, errInvalidBody)
+		return
+	}
+
+	if err := validation.Struct(passwordReset); err != nil {
+		logrus.Printf("ResetPassword: validation error:%v", err)
+		utilities.RespondError(w, r, err)
+		return
+	}
+
+	userID, err := helper.ResetPassword(passwordReset.Token, passwordReset.Password, func(uid string) error {
+		_, providerErr := h.IdentityProvider.UpdateUser(r.Context(), uid, provider.UserToUpdate{Password: &passwordReset.Password})
+		return providerErr
+	})
+	if err != nil {
+		logrus.Printf("ResetPassword: cannot reset password:%v", err)
+		if err == sql.ErrNoRows {
+			err = errInvalidResetToken
+		}
+		utilities.RespondError(w, r, err)
+		return
+	}
+
+	h.recordAudit(r, audit.EventPasswordReset, 0, userID, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// linkWithToken adds token as the token query param of link, keeping any query the configured link already has
+func linkWithToken(link, token string) string {
+	parsed, err := url.Parse(link)
+	if err != nil {
+		return link + "?token=" + url.QueryEscape(token)
+	}
+	query := parsed.Query()
+	query.Set("token", token)
+	parsed.RawQuery = query.Encode()
+	return parsed.String()
+}
+
+// ChangePassword replaces the password of the logged-in user after checking the current one, like Login does
+func (h *Handler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	var passwordChange models.PasswordChange
+
+	decoderErr := utilities.Decoder(r, &passwordChange)
+	if decoderErr != nil {
+		logrus.Printf("ChangePassword: Decoder error:%v", decoderErr)
+		utilities.RespondError(w, r, errInvalidBody)
+		return
+	}
+
+	if err := validation.Struct(passwordChange); err != nil {
+		logrus.Printf("ChangePassword: validation error:%v", err)
+		utilities.RespondError(w, r, err)
+		return
+	}
+
+	contextValues, ok := r.Context().Value(utilities.UserContextKey).(models.ContextValues)
+	if !ok {
+		logrus.Printf("ChangePassword:QueryParam for ID:%v", ok)
+		utilities.RespondError(w, r, errMissingContext)
+		return
+	}
+
+	if _, err := h.confirmPassword(contextValues.ID, passwordChange.CurrentPassword); err != nil {
+		logrus.Printf("ChangePassword: cannot confirm password:%v", err)
+		utilities.RespondError(w, r, err)
+		return
+	}
+
+	loggedOut, err := helper.ChangePassword(contextValues.ID, passwordChange.NewPassword, contextValues.SessionID, passwordChange.LogoutOtherSessions, func(uid string) error {
+		_, providerErr := h.IdentityProvider.UpdateUser(r.Context(), uid, provider.UserToUpdate{Password: &passwordChange.NewPassword})
+		return providerErr
+	})
+	if err != nil {
+		logrus.Printf("ChangePassword: cannot change password:%v", err)
+		utilities.RespondError(w, r, err)
+		return
+	}
+
+	h.recordAudit(r, audit.EventPasswordChanged, contextValues.ID, contextValues.ID, map[string]int64{"loggedOutSessions": loggedOut})
+
+	userOutboundData := make(map[string]int64)
+
+	userOutboundData["loggedOutSessions"] = loggedOut
+
+	err = utilities.Encoder(w, userOutboundData)
+	if err != nil {
+		logrus.Printf("ChangePassword: encoding error:%v", err)
+		return
+	}
+}
@@ -0,0 +1,139 @@
+package handler
+
+import (
+	"context"
+	"firebaseAuth/audit"
+	"firebaseAuth/database/helper"
+	"firebaseAuth/models"
+	"firebaseAuth/provider"
+	"firebaseAuth/utilities"
+	"firebaseAuth/validation"
+	"github.com/sirupsen/logrus"
+	"net/http"
+)
+
+// UpdateProfile applies a partial update to the profile of the logged-in user and returns the updated profile
+func (h *Handler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
+	var profileUpdate models.ProfileUpdate
+
+	decoderErr := utilities.Decoder(r, &profileUpdate)
+	if decoderErr != nil {
+		logrus.Printf("UpdateProfile: Decoder error:%v", decoderErr)
+		utilities.RespondError(w, r, errInvalidBody)
+		return
+	}
+
+	if err := validation.Struct(profileUpdate); err != nil {
+		logrus.Printf("UpdateProfile: validation error:%v", err)
+		utilities.RespondError(w, r, err)
+		return
+	}
+
+	contextValues, ok := r.Context().Value(utilities.UserContextKey).(models.ContextValues)
+	if !ok {
+		logrus.Printf("UpdateProfile:QueryParam for ID:%v", ok)
+		utilities.RespondError(w, r, errMissingContext)
+		return
+	}
+
+	previous, profile, err := h.syncedUpdate(r.Context(), func(sync helper.SyncProfile) (models.Profile, error) {
+		return helper.UpdateProfile(profileUpdate, contextValues.ID, sync)
+	})
+	if err != nil {
+		logrus.Printf("UpdateProfile: cannot update profile:%v", err)
+		utilities.RespondError(w, r, err)
+		return
+	}
+
+	h.recordAudit(r, audit.EventProfileUpdated, contextValues.ID, contextValues.ID, auditDiff(previous, profile))
+
+	err = utilities.Encoder(w, profile)
+	if err != nil {
+		logrus.Printf("UpdateProfile: encoding error:%v", err)
+		return
+	}
+}
+
+// ChangeEmail moves the logged-in user to a new email after checking the current password, in Postgres and Firebase
+func (h *Handler) ChangeEmail(w http.ResponseWriter, r *http.Request) {
+	var emailChange models.EmailChange
+
+	decoderErr := utilities.Decoder(r, &emailChange)
+	if decoderErr != nil {
+		logrus.Printf("ChangeEmail: Decoder error:%v", decoderErr)
+		utilities.RespondError(w, r, errInvalidBody)
+		return
+	}
+
+	if err := validation.Struct(emailChange); err != nil {
+		logrus.Printf("ChangeEmail: validation error:%v", err)
+		utilities.RespondError(w, r, err)
+		return
+	}
+
+	contextValues, ok := r.Context().Value(utilities.UserContextKey).(models.ContextValues)
+	if !ok {
+		logrus.Printf("ChangeEmail:QueryParam for ID:%v", ok)
+		utilities.RespondError(w, r, errMissingContext)
+		return
+	}
+
+	if _, err := h.confirmPassword(contextValues.ID, emailChange.Password); err != nil {
+		logrus.Printf("ChangeEmail: cannot confirm password:%v", err)
+		utilities.RespondError(w, r, err)
+		return
+	}
+
+	previous, profile, err := h.syncedUpdate(r.Context(), func(sync helper.SyncProfile) (models.Profile, error) {
+		return helper.UpdateEmail(contextValues.ID, emailChange.Email, sync)
+	})
+	if err != nil {
+		logrus.Printf("ChangeEmail: cannot change email:%v", err)
+		utilities.RespondError(w, r, err)
+		return
+	}
+
+	h.recordAudit(r, audit.EventEmailChanged, contextValues.ID, contextValues.ID, auditDiff(previous, profile))
+
+	if !profile.EmailVerified {
+		if err := h.sendVerification(r.Context(), profile.ID); err != nil {
+			logrus.Errorf("ChangeEmail: cannot send verification email:%v", err)
+		}
+	}
+
+	err = utilities.Encoder(w, profile)
+	if err != nil {
+		logrus.Printf("ChangeEmail: encoding error:%v", err)
+		return
+	}
+}
+
+// syncedUpdate runs a local profile update that mirrors the change to the identity provider inside its transaction.
+// A provider failure rolls the local change back. When the provider took the change but the commit failed, the
+// provider is put back to the previous values; if even that fails the drift is left for cmd/reconcile.
+// It returns the profile from before and after the update.
+func (h *Handler) syncedUpdate(ctx context.Context, update func(sync helper.SyncProfile) (models.Profile, error)) (models.Profile, models.Profile, error) {
+	var previous, synced provider.UserRecord
+	var previousProfile models.Profile
+	pushed := false
+
+	profile, err := update(func(before, after models.Profile) error {
+		previousProfile = before
+		changes, changed := provider.Changes(provider.FromProfile(before), provider.FromProfile(after))
+		if !changed {
+			return nil
+		}
+		if _, err := h.IdentityProvider.UpdateUser(ctx, after.UID, changes); err != nil {
+			return err
+		}
+		previous, synced, pushed = provider.FromProfile(before), provider.FromProfile(after), true
+		return nil
+	})
+	if err != nil && pushed {
+		revert, _ := provider.Changes(synced, previous)
+		if _, revertErr := h.IdentityProvider.UpdateUser(ctx, previous.UID, revert); revertErr != nil {
+			logrus.Errorf("syncedUpdate: cannot revert identity provider user %s:%v", previous.UID, revertErr)
+		}
+	}
+	return previousProfile, profile, err
+}
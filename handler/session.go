@@ -0,0 +1,158 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"firebaseAuth/apperror"
+	"firebaseAuth/audit"
+	"firebaseAuth/database/helper"
+	"firebaseAuth/models"
+	"firebaseAuth/utilities"
+	"firebaseAuth/validation"
+	"github.com/go-chi/chi/v5"
+	"github.com/sirupsen/logrus"
+	"net/http"
+)
+
+func (h *Handler) GetSessions(w http.ResponseWriter, r *http.Request) {
+	contextValues, ok := r.Context().Value(utilities.UserContextKey).(models.ContextValues)
+	if !ok {
+		logrus.Printf("GetSessions:QueryParam for ID:%v", ok)
+		utilities.RespondError(w, r, errMissingContext)
+		return
+	}
+
+	sessions, err := helper.GetActiveSessions(contextValues.ID, h.Session.IdleTimeout)
+	if err != nil {
+		logrus.Printf("GetSessions: cannot get sessions:%v", err)
+		utilities.RespondError(w, r, err)
+		return
+	}
+
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == contextValues.SessionID
+	}
+
+	err = utilities.Encoder(w, sessions)
+	if err != nil {
+		logrus.Printf("GetSessions: encoding error:%v", err)
+		return
+	}
+}
+
+func (h *Handler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	contextValues, ok := r.Context().Value(utilities.UserContextKey).(models.ContextValues)
+	if !ok {
+		logrus.Printf("RevokeSession:QueryParam for ID:%v", ok)
+		utilities.RespondError(w, r, errMissingContext)
+		return
+	}
+
+	sessionID := chi.URLParam(r, "sessionId")
+
+	err := helper.Logout(contextValues.ID, sessionID)
+	if err != nil {
+		logrus.Printf("RevokeSession: cannot revoke session %s:%v", sessionID, err)
+		if err == sql.ErrNoRows {
+			err = apperror.Wrap(err, apperror.CodeNotFound, "no active session with this id")
+		}
+		utilities.RespondError(w, r, err)
+		return
+	}
+
+	h.recordAudit(r, audit.EventLogout, contextValues.ID, contextValues.ID, map[string]string{"sessionId": sessionID})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) LogoutOtherSessions(w http.ResponseWriter, r *http.Request) {
+	contextValues, ok := r.Context().Value(utilities.UserContextKey).(models.ContextValues)
+	if !ok {
+		logrus.Printf("LogoutOtherSessions:QueryParam for ID:%v", ok)
+		utilities.RespondError(w, r, errMissingContext)
+		return
+	}
+
+	revoked, err := helper.LogoutOtherSessions(contextValues.ID, contextValues.SessionID)
+	if err != nil {
+		logrus.Printf("LogoutOtherSessions: cannot revoke sessions:%v", err)
+		utilities.RespondError(w, r, err)
+		return
+	}
+
+	h.recordAudit(r, audit.EventLogout, contextValues.ID, contextValues.ID, map[string]interface{}{"keptSessionId": contextValues.SessionID, "revoked": revoked})
+
+	userOutboundData := make(map[string]int64)
+
+	userOutboundData["revoked"] = revoked
+
+	err = utilities.Encoder(w, userOutboundData)
+	if err != nil {
+		logrus.Printf("LogoutOtherSessions: encoding error:%v", err)
+		return
+	}
+}
+
+// RefreshToken trades a refresh token for a new custom token and a new refresh token of the same session
+func (h *Handler) RefreshToken(w http.ResponseWriter, r *http.Request) {
+	var refreshTokenRequest models.RefreshTokenRequest
+
+	decoderErr := utilities.Decoder(r, &refreshTokenRequest)
+	if decoderErr != nil {
+		logrus.Printf("RefreshToken: Decoder error:%v", decoderErr)
+		utilities.RespondError(w, r, errInvalidBody)
+		return
+	}
+	if err := validation.Struct(refreshTokenRequest); err != nil {
+		logrus.Printf("RefreshToken: validation error:%v", err)
+		utilities.RespondError(w, r, err)
+		return
+	}
+
+	refreshed, err := helper.RotateRefreshToken(refreshTokenRequest.RefreshToken, h.Session.IdleTimeout)
+	if err != nil {
+		logrus.Printf("RefreshToken: cannot rotate refresh token:%v", err)
+		if err == sql.ErrNoRows {
+			err = apperror.Wrap(err, apperror.CodeUnauthorized, "invalid or expired refresh token")
+		}
+		utilities.RespondError(w, r, err)
+		return
+	}
+
+	userIdentity, err := helper.FetchUserIdentity(refreshed.UserID)
+	if err != nil {
+		logrus.Printf("RefreshToken: cannot get user:%v", err)
+		utilities.RespondError(w, r, err)
+		return
+	}
+
+	customToken, err := h.customToken(r.Context(), userIdentity, refreshed.SessionID)
+	if err != nil {
+		logrus.Printf("RefreshToken: error setting custom claims:%v", err)
+		utilities.RespondError(w, r, err)
+		return
+	}
+
+	userOutboundData := make(map[string]interface{})
+
+	userOutboundData["token"] = customToken
+	userOutboundData["refreshToken"] = refreshed.RefreshToken
+
+	err = utilities.Encoder(w, userOutboundData)
+	if err != nil {
+		logrus.Printf("RefreshToken: encoding error:%v", err)
+		return
+	}
+}
+
+// customToken mints the Firebase custom token of a session, the sid claim is what middleware.Auth checks. The roles
+// are mirrored for clients and security rules, middleware.Auth reads them from Postgres so a change applies at once.
+func (h *Handler) customToken(ctx context.Context, userIdentity models.UserIdentity, sessionID string) (string, error) {
+	claims := map[string]interface{}{
+		"id":    userIdentity.ID,
+		"email": userIdentity.Email,
+		"sid":   sessionID,
+		"role":  userIdentity.Role,
+		"roles": models.ImpliedRoles(userIdentity.Role),
+	}
+	return h.IdentityProvider.CustomTokenWithClaims(ctx, userIdentity.UID, claims)
+}
@@ -1,105 +1,243 @@
 package handler
 
 import (
-	"context"
 	"database/sql"
-	firebase "firebase.google.com/go"
-	"firebase.google.com/go/auth"
+	"firebaseAuth/apperror"
+	"firebaseAuth/audit"
+	"firebaseAuth/config"
 	"firebaseAuth/database/helper"
 	"firebaseAuth/models"
+	"firebaseAuth/provider"
 	"firebaseAuth/utilities"
+	"firebaseAuth/validation"
+	"github.com/go-chi/chi/v5"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/crypto/bcrypt"
-	"google.golang.org/api/option"
-	"log"
+	"math"
 	"net/http"
-	"os"
 	"strconv"
 	"strings"
+	"time"
 )
 
-func Login(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
 	var userDetails models.UsersLoginDetails
 
 	decoderErr := utilities.Decoder(r, &userDetails)
 	if decoderErr != nil {
-		w.WriteHeader(http.StatusBadRequest)
 		logrus.Printf("Decoder error:%v", decoderErr)
+		utilities.RespondError(w, r, errInvalidBody)
+		return
+	}
+
+	if err := validation.Struct(userDetails); err != nil {
+		logrus.Printf("Login: validation error:%v", err)
+		utilities.RespondError(w, r, err)
 		return
 	}
 
 	userDetails.Email = strings.ToLower(userDetails.Email)
+	clientIP := utilities.ClientIP(r)
+
+	wait, err := h.Lockout.Check(r.Context(), userDetails.Email, clientIP)
+	if err != nil {
+		logrus.Printf("Login: cannot check lockout:%v", err)
+		utilities.RespondError(w, r, err)
+		return
+	}
+	if wait > 0 {
+		logrus.Printf("Login: %s from %s is locked out for %s", userDetails.Email, clientIP, wait)
+		h.recordAudit(r, audit.EventLoginFailed, 0, 0, loginFailure(userDetails.Email, "locked_out"))
+		respondLockedOut(w, r, wait)
+		return
+	}
 
 	userCredentials, fetchErr := helper.FetchPasswordAndID(userDetails.Email)
+	// a deactivated account in its grace period can log in too, it is reactivated once the login is complete
+	deactivated := false
+	if fetchErr == sql.ErrNoRows {
+		userCredentials, fetchErr = helper.FetchDeactivatedCredentials(userDetails.Email, h.Account.DeletionGrace)
+		deactivated = fetchErr == nil
+	}
 	if fetchErr != nil {
+		logrus.Printf("FetchPasswordAndId: not able to get password or id:%v", fetchErr)
 		if fetchErr == sql.ErrNoRows {
-			w.WriteHeader(http.StatusBadRequest)
-			_, err := w.Write([]byte("ERROR: Wrong details"))
-			if err != nil {
-				return
-			}
-
-			logrus.Printf("FetchPasswordAndId: not able to get password or id:%v", fetchErr)
+			h.loginFailed(r, userDetails.Email, clientIP, 0, "unknown_email")
+			utilities.RespondError(w, r, errWrongCredentials)
 			return
 		}
-		w.WriteHeader(http.StatusInternalServerError)
+		utilities.RespondError(w, r, fetchErr)
 		return
 	}
 
 	if PasswordErr := bcrypt.CompareHashAndPassword([]byte(userCredentials.Password), []byte(userDetails.Password)); PasswordErr != nil {
-		w.WriteHeader(http.StatusUnauthorized)
 		logrus.Printf("password misMatch")
-		_, err := w.Write([]byte("ERROR: Wrong password"))
+		h.loginFailed(r, userDetails.Email, clientIP, userCredentials.ID, "wrong_password")
+		utilities.RespondError(w, r, errWrongCredentials)
+		return
+	}
+
+	if err := h.Lockout.Succeed(r.Context(), userDetails.Email); err != nil {
+		logrus.Printf("Login: cannot reset failed logins:%v", err)
+	}
+
+	if userCredentials.Disabled {
+		logrus.Printf("Login: user %d is disabled", userCredentials.ID)
+		h.recordAudit(r, audit.EventLoginFailed, 0, userCredentials.ID, loginFailure(userDetails.Email, "account_disabled"))
+		utilities.RespondError(w, r, helper.ErrAccountDisabled)
+		return
+	}
+
+	if h.Verification.Policy == config.VerificationPolicyBlockLogin && !userCredentials.EmailVerified {
+		logrus.Printf("Login: email of user %d is not verified", userCredentials.ID)
+		h.recordAudit(r, audit.EventLoginFailed, 0, userCredentials.ID, loginFailure(userDetails.Email, "email_not_verified"))
+		utilities.RespondError(w, r, helper.ErrEmailNotVerified)
+		return
+	}
+
+	mfaEnabled, err := helper.MFAEnabled(userCredentials.ID)
+	if err != nil {
+		logrus.Printf("Login: cannot check two-factor authentication:%v", err)
+		utilities.RespondError(w, r, err)
+		return
+	}
+	if mfaEnabled {
+		mfaToken, err := helper.CreateMFAChallenge(userCredentials.ID, userDetails.DeviceName, h.MFA.ChallengeTTL)
 		if err != nil {
+			logrus.Printf("Login: cannot create two-factor challenge:%v", err)
+			utilities.RespondError(w, r, err)
 			return
 		}
+
+		userOutboundData := make(map[string]interface{})
+
+		userOutboundData["mfaRequired"] = true
+		userOutboundData["mfaToken"] = mfaToken
+
+		err = utilities.Encoder(w, userOutboundData)
+		if err != nil {
+			logrus.Printf("Login: encoding error:%v", err)
+		}
 		return
 	}
 
-	opt := option.WithCredentialsJSON([]byte(os.Getenv("firebase_key")))
-	app, err := firebase.NewApp(context.Background(), nil, opt)
+	if deactivated {
+		if err := h.reactivateAccount(r, userCredentials.ID); err != nil {
+			logrus.Printf("Login: cannot reactivate user %d:%v", userCredentials.ID, err)
+			utilities.RespondError(w, r, err)
+			return
+		}
+	}
+
+	userIdentity, err := helper.FetchUserIdentity(userCredentials.ID)
 	if err != nil {
-		logrus.Printf("Login:cannot create firebase application object:%v", err)
+		logrus.Printf("FetchUserIdentity: cannot get user identity:%v", err)
+		utilities.RespondError(w, r, err)
 		return
 	}
-	client, err := app.Auth(context.Background())
+
+	h.startSession(w, r, userIdentity, userDetails.DeviceName)
+}
+
+// confirmPassword checks password against the active user and returns the user, errWrongPassword when it does
+// not match
+func (h *Handler) confirmPassword(userID int, password string) (models.UserIdentity, error) {
+	userIdentity, err := helper.FetchUserIdentity(userID)
 	if err != nil {
-		logrus.Printf("Login:cannot create client client:%v", err)
-		return
+		return userIdentity, err
 	}
 
-	uid, err := helper.FetchUID(userDetails.Email)
+	userCredentials, err := helper.FetchPasswordAndID(userIdentity.Email)
 	if err != nil {
-		logrus.Printf("FetchUID: cannot get user uid:%v", err)
-		return
+		return userIdentity, err
 	}
 
-	claims := map[string]interface{}{
-		"id":    userCredentials.ID,
-		"email": userDetails.Email,
+	if PasswordErr := bcrypt.CompareHashAndPassword([]byte(userCredentials.Password), []byte(password)); PasswordErr != nil {
+		return userIdentity, errWrongPassword
 	}
+	return userIdentity, nil
+}
 
-	customToken, err := client.CustomTokenWithClaims(context.Background(), uid, claims)
+// reactivateAccount brings back a deactivated account within its grace period, once the login is complete
+func (h *Handler) reactivateAccount(r *http.Request, userID int) error {
+	enabled := false
+	err := helper.ReactivateAccount(userID, h.Account.DeletionGrace, func(uid string) error {
+		_, providerErr := h.IdentityProvider.UpdateUser(r.Context(), uid, provider.UserToUpdate{Disabled: &enabled})
+		return providerErr
+	})
 	if err != nil {
-		log.Fatalf("error setting custom claims %v\n", err)
+		return err
+	}
+	h.recordAudit(r, audit.EventAccountReactivated, userID, userID, nil)
+	return nil
+}
+
+// loginFailed records a wrong email or password and counts it towards the lockout of the email and the client ip.
+// userID is the user the email belongs to, 0 when there is none.
+func (h *Handler) loginFailed(r *http.Request, email, clientIP string, userID int, reason string) {
+	h.recordAudit(r, audit.EventLoginFailed, 0, userID, loginFailure(email, reason))
+
+	wait, err := h.Lockout.Fail(r.Context(), email, clientIP)
+	if err != nil {
+		logrus.Printf("Login: cannot count failed login:%v", err)
 		return
 	}
+	if wait > 0 {
+		logrus.Printf("Login: %s from %s has to wait %s before the next attempt", email, clientIP, wait)
+	}
+}
 
-	//token, err := client.CustomToken(context.Background(), uid)
-	//if err != nil {
-	//	log.Fatalf("error minting custom token: %v\n", err)
-	//	return
-	//}
+func loginFailure(email, reason string) map[string]string {
+	return map[string]string{"email": email, "reason": reason}
+}
 
-	err = helper.CreateSession(userCredentials.ID)
+// respondLockedOut answers 429 with the Retry-After header in whole seconds, rounded up
+func respondLockedOut(w http.ResponseWriter, r *http.Request, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	utilities.RespondError(w, r, errTooManyLoginAttempts)
+}
+
+// startSession is the end of every successful login: it creates the session and answers with its custom token
+// and first refresh token
+func (h *Handler) startSession(w http.ResponseWriter, r *http.Request, userIdentity models.UserIdentity, deviceName string) {
+	sessionDetails := models.SessionDetails{
+		DeviceName: deviceName,
+		IPAddress:  utilities.ClientIP(r),
+		UserAgent:  r.UserAgent(),
+	}
+	sessionID, err := helper.CreateSession(userIdentity.ID, sessionDetails, h.Session.TTL)
 	if err != nil {
 		logrus.Printf("Login: CreateSession: cannot create session:%v", err)
+		utilities.RespondError(w, r, err)
+		return
+	}
+
+	customToken, err := h.customToken(r.Context(), userIdentity, sessionID)
+	if err != nil {
+		logrus.Printf("Login: error setting custom claims:%v", err)
+		if logoutErr := helper.Logout(userIdentity.ID, sessionID); logoutErr != nil {
+			logrus.Printf("Login: cannot expire unused session:%v", logoutErr)
+		}
+		utilities.RespondError(w, r, err)
 		return
 	}
 
+	refreshToken, err := helper.CreateRefreshToken(sessionID)
+	if err != nil {
+		logrus.Printf("Login: CreateRefreshToken: cannot create refresh token:%v", err)
+		if logoutErr := helper.Logout(userIdentity.ID, sessionID); logoutErr != nil {
+			logrus.Printf("Login: cannot expire unused session:%v", logoutErr)
+		}
+		utilities.RespondError(w, r, err)
+		return
+	}
+
+	h.recordAudit(r, audit.EventLoginSucceeded, userIdentity.ID, userIdentity.ID, map[string]string{"sessionId": sessionID, "deviceName": deviceName})
+
 	userOutboundData := make(map[string]interface{})
 
 	userOutboundData["token"] = customToken
+	userOutboundData["refreshToken"] = refreshToken
 
 	err = utilities.Encoder(w, userOutboundData)
 	if err != nil {
@@ -108,38 +246,36 @@ func Login(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func Register(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) Register(w http.ResponseWriter, r *http.Request) {
 	var userDetails models.UserDetails
 
 	decoderErr := utilities.Decoder(r, &userDetails)
 	if decoderErr != nil {
-		w.WriteHeader(http.StatusBadRequest)
 		logrus.Printf("Register: Decoder error:%v", decoderErr)
+		utilities.RespondError(w, r, errInvalidBody)
 		return
 	}
+	// emails are stored lower case, Login and the password reset look them up that way
+	userDetails.Email = strings.ToLower(strings.TrimSpace(userDetails.Email))
 
-	opt := option.WithCredentialsJSON([]byte(os.Getenv("firebase_key")))
-	app, err := firebase.NewApp(context.Background(), nil, opt)
-	if err != nil {
-		logrus.Printf("Register:cannot create firebase application object:%v", err)
-		return
-	}
-	client, err := app.Auth(context.Background())
-	if err != nil {
-		logrus.Printf("Register:cannot create client client:%v", err)
+	if err := validation.Struct(userDetails); err != nil {
+		logrus.Printf("Register: validation error:%v", err)
+		utilities.RespondError(w, r, err)
 		return
 	}
 
-	params := (&auth.UserToCreate{}).
-		Email(userDetails.Email).
-		EmailVerified(true).
-		PhoneNumber(userDetails.Phone).
-		Password(userDetails.Password).
-		DisplayName(userDetails.Name).
-		Disabled(false)
-	u, err := client.CreateUser(context.Background(), params)
+	params := provider.UserToCreate{
+		Email:         userDetails.Email,
+		EmailVerified: false,
+		PhoneNumber:   userDetails.Phone,
+		Password:      userDetails.Password,
+		DisplayName:   userDetails.Name,
+		Disabled:      false,
+	}
+	u, err := h.IdentityProvider.CreateUser(r.Context(), params)
 	if err != nil {
-		log.Fatalf("Register:error creating user at firebase: %v\n", err)
+		logrus.Printf("Register:error creating user at firebase:%v", err)
+		utilities.RespondError(w, r, err)
 		return
 	}
 
@@ -147,16 +283,20 @@ func Register(w http.ResponseWriter, r *http.Request) {
 
 	userID, err := helper.Register(userDetails)
 	if err != nil {
-		err := client.DeleteUser(context.Background(), u.UID)
-		if err != nil {
-			logrus.Errorf("Register: cannot delete firebase user from firebase:%v", err)
-			return
-		}
-		w.WriteHeader(http.StatusInternalServerError)
 		logrus.Printf("Register: cannot register user:%v", err)
+		if deleteErr := h.IdentityProvider.DeleteUser(r.Context(), u.UID); deleteErr != nil {
+			logrus.Errorf("Register: cannot delete firebase user from firebase:%v", deleteErr)
+		}
+		utilities.RespondError(w, r, err)
 		return
 	}
 
+	h.recordAudit(r, audit.EventRegister, userID, userID, map[string]string{"email": userDetails.Email, "name": userDetails.Name})
+
+	if err := h.sendVerification(r.Context(), userID); err != nil {
+		logrus.Errorf("Register: cannot send verification email:%v", err)
+	}
+
 	userOutboundData := make(map[string]int)
 
 	userOutboundData["successfully registered with id:"] = userID
@@ -168,7 +308,7 @@ func Register(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func filters(r *http.Request) (models.FiltersCheck, error) {
+func (h *Handler) filters(r *http.Request) (models.FiltersCheck, error) {
 	filtersCheck := models.FiltersCheck{}
 
 	var limit int
@@ -176,12 +316,17 @@ func filters(r *http.Request) (models.FiltersCheck, error) {
 	var page int
 	strLimit := r.URL.Query().Get("limit")
 	if strLimit == "" {
-		limit = 10
+		limit = h.Pagination.DefaultLimit
 	} else {
 		limit, err = strconv.Atoi(strLimit)
 		if err != nil {
 			logrus.Printf("Limit: cannot get limit:%v", err)
-			return filtersCheck, err
+			return filtersCheck, errInvalidFilters
+		}
+		if limit <= 0 {
+			limit = h.Pagination.DefaultLimit
+		} else if limit > h.Pagination.MaxLimit {
+			limit = h.Pagination.MaxLimit
 		}
 	}
 
@@ -192,7 +337,7 @@ func filters(r *http.Request) (models.FiltersCheck, error) {
 		page, err = strconv.Atoi(strPage)
 		if err != nil {
 			logrus.Printf("Page: cannot get page:%v", err)
-			return filtersCheck, err
+			return filtersCheck, errInvalidFilters
 		}
 	}
 
@@ -202,49 +347,96 @@ func filters(r *http.Request) (models.FiltersCheck, error) {
 	return filtersCheck, nil
 }
 
-func SendFriendRequest(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) SendFriendRequest(w http.ResponseWriter, r *http.Request) {
 	var friendRequest models.FriendRequest
 
 	decoderErr := utilities.Decoder(r, &friendRequest)
 
 	if decoderErr != nil {
-		w.WriteHeader(http.StatusBadRequest)
 		logrus.Printf("SendFriendRequest: Decoder error:%v", decoderErr)
+		utilities.RespondError(w, r, errInvalidBody)
+		return
+	}
+
+	if err := validation.Struct(friendRequest); err != nil {
+		logrus.Printf("SendFriendRequest: validation error:%v", err)
+		utilities.RespondError(w, r, err)
 		return
 	}
 
 	contextValues, ok := r.Context().Value(utilities.UserContextKey).(models.ContextValues)
 	if !ok {
-		w.WriteHeader(http.StatusInternalServerError)
 		logrus.Printf("SendFriendRequest:QueryParam for ID:%v", ok)
+		utilities.RespondError(w, r, errMissingContext)
 		return
 	}
-	err := helper.SendFriendRequest(friendRequest, contextValues.ID)
+	status, err := helper.SendFriendRequest(friendRequest, contextValues.ID, h.Friends.RequestCooldown)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
 		logrus.Printf("SendFriendRequest: cannot send request to user:%v", err)
+		utilities.RespondError(w, r, err)
+		return
+	}
+
+	h.recordAudit(r, audit.EventFriendRequestSent, contextValues.ID, friendRequest.RequestTo, map[string]string{"status": status})
+
+	userOutboundData := make(map[string]string)
+
+	userOutboundData["status"] = status
+
+	w.WriteHeader(http.StatusCreated)
+	err = utilities.Encoder(w, userOutboundData)
+	if err != nil {
+		logrus.Printf("SendFriendRequest: encoding error:%v", err)
+		return
+	}
+}
+
+func (h *Handler) CancelFriendRequest(w http.ResponseWriter, r *http.Request) {
+	contextValues, ok := r.Context().Value(utilities.UserContextKey).(models.ContextValues)
+	if !ok {
+		logrus.Printf("CancelFriendRequest:QueryParam for ID:%v", ok)
+		utilities.RespondError(w, r, errMissingContext)
+		return
+	}
+
+	requestID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		logrus.Printf("CancelFriendRequest: invalid request id:%v", err)
+		utilities.RespondError(w, r, errInvalidID)
+		return
+	}
+
+	err = helper.CancelFriendRequest(requestID, contextValues.ID)
+	if err != nil {
+		logrus.Printf("CancelFriendRequest: cannot cancel request %d of %d:%v", requestID, contextValues.ID, err)
+		if err == sql.ErrNoRows {
+			err = apperror.Wrap(err, apperror.CodeNotFound, "no pending friend request with this id")
+		}
+		utilities.RespondError(w, r, err)
 		return
 	}
+	w.WriteHeader(http.StatusNoContent)
 }
 
-func SeeFriendRequests(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) SeeFriendRequests(w http.ResponseWriter, r *http.Request) {
 	contextValues, ok := r.Context().Value(utilities.UserContextKey).(models.ContextValues)
 	if !ok {
-		w.WriteHeader(http.StatusInternalServerError)
 		logrus.Printf("SeeFriendRequests:QueryParam for ID:%v", ok)
+		utilities.RespondError(w, r, errMissingContext)
 		return
 	}
 
-	filterCheck, err := filters(r)
+	filterCheck, err := h.filters(r)
 	if err != nil {
 		logrus.Printf("SeeFriendRequests: filterCheck error:%v", err)
+		utilities.RespondError(w, r, err)
 		return
 	}
 
 	allRequests, err := helper.SeeFriendRequests(filterCheck, contextValues.ID)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
 		logrus.Printf("SeeFriendRequests: cannot get all requests:%v", err)
+		utilities.RespondError(w, r, err)
 		return
 	}
 
@@ -255,54 +447,70 @@ func SeeFriendRequests(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func UpdateFriendRequestStatus(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) UpdateFriendRequestStatus(w http.ResponseWriter, r *http.Request) {
 	var allRequests models.AllRequests
 
 	decoderErr := utilities.Decoder(r, &allRequests)
 	if decoderErr != nil {
-		w.WriteHeader(http.StatusBadRequest)
 		logrus.Printf("UpdateFriendRequestStatus: Decoder error:%v", decoderErr)
+		utilities.RespondError(w, r, errInvalidBody)
+		return
+	}
+
+	if err := validation.Struct(allRequests); err != nil {
+		logrus.Printf("UpdateFriendRequestStatus: validation error:%v", err)
+		utilities.RespondError(w, r, err)
 		return
 	}
 
 	contextValues, ok := r.Context().Value(utilities.UserContextKey).(models.ContextValues)
 	if !ok {
-		w.WriteHeader(http.StatusInternalServerError)
 		logrus.Printf("UpdateFriendRequestStatus:QueryParam for ID:%v", ok)
+		utilities.RespondError(w, r, errMissingContext)
 		return
 	}
 
 	err := helper.UpdateFriendRequest(allRequests, contextValues.ID)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		logrus.Printf("UpdateFriendRequestStatus: cannot accept request:%v", err)
+		logrus.Printf("UpdateFriendRequestStatus: cannot update request from %d:%v", allRequests.RequestFrom, err)
+		if err == sql.ErrNoRows {
+			err = apperror.Wrap(err, apperror.CodeNotFound, "no pending friend request from this user")
+		}
+		utilities.RespondError(w, r, err)
 		return
 	}
 
+	event := audit.EventFriendRequestRejected
+	if allRequests.Status == utilities.Accepted {
+		event = audit.EventFriendRequestAccepted
+	}
+	h.recordAudit(r, event, contextValues.ID, allRequests.RequestFrom, map[string]string{"status": allRequests.Status})
+
 	_, err = w.Write([]byte("request updated successfully"))
 	if err != nil {
 		return
 	}
 }
 
-func GetFriendList(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) GetFriendList(w http.ResponseWriter, r *http.Request) {
 	contextValues, ok := r.Context().Value(utilities.UserContextKey).(models.ContextValues)
 	if !ok {
-		w.WriteHeader(http.StatusInternalServerError)
 		logrus.Printf("GetFriendList:QueryParam for ID:%v", ok)
+		utilities.RespondError(w, r, errMissingContext)
 		return
 	}
 
-	filterCheck, err := filters(r)
+	filterCheck, err := h.filters(r)
 	if err != nil {
 		logrus.Printf("GetFriendList: filterCheck error:%v", err)
+		utilities.RespondError(w, r, err)
 		return
 	}
 
 	friendsList, err := helper.GetFriendList(filterCheck, contextValues.ID)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
 		logrus.Printf("GetFriendList: cannot get list of friends:%v", err)
+		utilities.RespondError(w, r, err)
 		return
 	}
 
@@ -313,54 +521,52 @@ func GetFriendList(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func UpdateUserInfo(w http.ResponseWriter, r *http.Request) {
-	var userDetails models.UserDetails
-
-	decoderErr := utilities.Decoder(r, &userDetails)
-	if decoderErr != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		logrus.Printf("UpdateUserInfo: Decoder error:%v", decoderErr)
-		return
-	}
-
+func (h *Handler) Unfriend(w http.ResponseWriter, r *http.Request) {
 	contextValues, ok := r.Context().Value(utilities.UserContextKey).(models.ContextValues)
 	if !ok {
-		w.WriteHeader(http.StatusInternalServerError)
-		logrus.Printf("UpdateUserInfo:QueryParam for ID:%v", ok)
+		logrus.Printf("Unfriend:QueryParam for ID:%v", ok)
+		utilities.RespondError(w, r, errMissingContext)
 		return
 	}
 
-	err := helper.UpdateUserInfo(userDetails, contextValues.ID)
+	friendID, err := strconv.Atoi(chi.URLParam(r, "id"))
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		logrus.Printf("UpdateUserInfo: cannot update user:%v", err)
+		logrus.Printf("Unfriend: invalid friend id:%v", err)
+		utilities.RespondError(w, r, errInvalidID)
 		return
 	}
 
-	_, err = w.Write([]byte("user Updated successfully"))
+	err = helper.Unfriend(contextValues.ID, friendID)
 	if err != nil {
+		logrus.Printf("Unfriend: cannot remove friend %d of %d:%v", friendID, contextValues.ID, err)
+		if err == sql.ErrNoRows {
+			err = apperror.Wrap(err, apperror.CodeNotFound, "user is not a friend")
+		}
+		utilities.RespondError(w, r, err)
 		return
 	}
+	w.WriteHeader(http.StatusNoContent)
 }
 
-func GetUsers(w http.ResponseWriter, r *http.Request) {
-	filterCheck, err := filters(r)
+func (h *Handler) GetUsers(w http.ResponseWriter, r *http.Request) {
+	filterCheck, err := h.filters(r)
 	if err != nil {
 		logrus.Printf("GetUsers: filterCheck error:%v", err)
+		utilities.RespondError(w, r, err)
 		return
 	}
 
 	contextValues, ok := r.Context().Value(utilities.UserContextKey).(models.ContextValues)
 	if !ok {
-		w.WriteHeader(http.StatusInternalServerError)
 		logrus.Printf("GetUsers:QueryParam for ID:%v", ok)
+		utilities.RespondError(w, r, errMissingContext)
 		return
 	}
 
 	userDetails, err := helper.GetUsers(filterCheck, contextValues.ID)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
 		logrus.Printf("GetUsers: cannot get users:%v", err)
+		utilities.RespondError(w, r, err)
 		return
 	}
 
@@ -371,20 +577,78 @@ func GetUsers(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func Logout(w http.ResponseWriter, r *http.Request) {
+// DeactivateAccount deletes the account of the logged-in user after checking the password. It is archived, disabled
+// in Firebase and logged out everywhere, and purged for good unless the user logs in again within the grace period.
+func (h *Handler) DeactivateAccount(w http.ResponseWriter, r *http.Request) {
+	var confirmation models.PasswordConfirmation
+
+	decoderErr := utilities.Decoder(r, &confirmation)
+	if decoderErr != nil {
+		logrus.Printf("DeactivateAccount: Decoder error:%v", decoderErr)
+		utilities.RespondError(w, r, errInvalidBody)
+		return
+	}
+
+	if err := validation.Struct(confirmation); err != nil {
+		logrus.Printf("DeactivateAccount: validation error:%v", err)
+		utilities.RespondError(w, r, err)
+		return
+	}
+
+	contextValues, ok := r.Context().Value(utilities.UserContextKey).(models.ContextValues)
+	if !ok {
+		logrus.Printf("DeactivateAccount:QueryParam for ID:%v", ok)
+		utilities.RespondError(w, r, errMissingContext)
+		return
+	}
+
+	if _, err := h.confirmPassword(contextValues.ID, confirmation.Password); err != nil {
+		logrus.Printf("DeactivateAccount: cannot confirm password:%v", err)
+		utilities.RespondError(w, r, err)
+		return
+	}
+
+	disabled := true
+	archivedAt, err := helper.DeactivateAccount(contextValues.ID, func(uid string) error {
+		_, providerErr := h.IdentityProvider.UpdateUser(r.Context(), uid, provider.UserToUpdate{Disabled: &disabled})
+		return providerErr
+	})
+	if err != nil {
+		logrus.Printf("DeactivateAccount: cannot deactivate:%v", err)
+		utilities.RespondError(w, r, err)
+		return
+	}
+
+	h.recordAudit(r, audit.EventAccountDeactivated, contextValues.ID, contextValues.ID, nil)
+
+	userOutboundData := make(map[string]time.Time)
+
+	userOutboundData["deactivatedAt"] = archivedAt
+	userOutboundData["reactivateBefore"] = archivedAt.Add(h.Account.DeletionGrace)
+
+	err = utilities.Encoder(w, userOutboundData)
+	if err != nil {
+		logrus.Printf("DeactivateAccount: encoding error:%v", err)
+		return
+	}
+}
+
+func (h *Handler) Logout(w http.ResponseWriter, r *http.Request) {
 	contextValues, ok := r.Context().Value(utilities.UserContextKey).(models.ContextValues)
 	if !ok {
-		w.WriteHeader(http.StatusInternalServerError)
 		logrus.Printf("Logout:QueryParam for ID:%v", ok)
+		utilities.RespondError(w, r, errMissingContext)
 		return
 	}
 
-	err := helper.Logout(contextValues.ID)
+	err := helper.Logout(contextValues.ID, contextValues.SessionID)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
 		logrus.Printf("Logout:unable to logout:%v", err)
+		utilities.RespondError(w, r, err)
 		return
 	}
+
+	h.recordAudit(r, audit.EventLogout, contextValues.ID, contextValues.ID, map[string]string{"sessionId": contextValues.SessionID})
 }
 
 //if fetchErr == sql.ErrNoRows {
@@ -0,0 +1,116 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"firebaseAuth/database/helper"
+	"firebaseAuth/mailer"
+	"firebaseAuth/models"
+	"firebaseAuth/provider"
+	"firebaseAuth/utilities"
+	"firebaseAuth/validation"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// resendVerificationTimeout bounds the work ResendVerification leaves running after it answered
+const resendVerificationTimeout = 30 * time.Second
+
+// VerifyEmail is where the emailed verification link points to
+func (h *Handler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		utilities.RespondError(w, r, errInvalidVerificationToken)
+		return
+	}
+
+	verified := true
+	err := helper.VerifyEmail(token, func(uid string) error {
+		_, providerErr := h.IdentityProvider.UpdateUser(r.Context(), uid, provider.UserToUpdate{EmailVerified: &verified})
+		return providerErr
+	})
+	if err != nil {
+		logrus.Printf("VerifyEmail: cannot verify email:%v", err)
+		if err == sql.ErrNoRows {
+			err = errInvalidVerificationToken
+		}
+		utilities.RespondError(w, r, err)
+		return
+	}
+
+	userOutboundData := make(map[string]string)
+
+	userOutboundData["message"] = "email verified"
+
+	err = utilities.Encoder(w, userOutboundData)
+	if err != nil {
+		logrus.Printf("VerifyEmail: encoding error:%v", err)
+		return
+	}
+}
+
+// ResendVerification emails a new verification link. Like ForgotPassword it answers the same for any email, it
+// does not need a login so it also works when the verification policy blocks login.
+func (h *Handler) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	var emailRequest models.EmailRequest
+
+	decoderErr := utilities.Decoder(r, &emailRequest)
+	if decoderErr != nil {
+		logrus.Printf("ResendVerification: Decoder error:%v", decoderErr)
+		utilities.RespondError(w, r, errInvalidBody)
+		return
+	}
+
+	if err := validation.Struct(emailRequest); err != nil {
+		logrus.Printf("ResendVerification: validation error:%v", err)
+		utilities.RespondError(w, r, err)
+		return
+	}
+
+	// done after the answer for every email, like ForgotPassword, so the response time gives nothing away
+	email := strings.ToLower(strings.TrimSpace(emailRequest.Email))
+	h.goBackground(resendVerificationTimeout, func(ctx context.Context) {
+		userCredentials, err := helper.FetchPasswordAndID(email)
+		switch {
+		case err == sql.ErrNoRows:
+			logrus.Printf("ResendVerification: no user with the requested email")
+		case err != nil:
+			logrus.Errorf("ResendVerification: cannot get user:%v", err)
+		case !userCredentials.EmailVerified:
+			if err := h.sendVerification(ctx, userCredentials.ID); err != nil {
+				logrus.Errorf("ResendVerification: cannot send verification email:%v", err)
+			}
+		}
+	})
+
+	userOutboundData := make(map[string]string)
+
+	userOutboundData["message"] = "if the email belongs to an unverified account, a verification link has been sent to it"
+
+	w.WriteHeader(http.StatusAccepted)
+	err := utilities.Encoder(w, userOutboundData)
+	if err != nil {
+		logrus.Printf("ResendVerification: encoding error:%v", err)
+		return
+	}
+}
+
+// sendVerification issues a verification token for the current email of the user and mails the link to it
+func (h *Handler) sendVerification(ctx context.Context, userID int) error {
+	token, email, err := helper.CreateEmailVerification(userID, h.Verification.TokenTTL)
+	if err != nil {
+		return err
+	}
+
+	message := mailer.Message{
+		To:      email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Open this link within %s to confirm this is your email address:\n%s\n\n"+
+			"If you did not create an account, ignore this email.\n",
+			h.Verification.TokenTTL, linkWithToken(h.Verification.URL, token)),
+	}
+	return h.Mailer.Send(ctx, message)
+}
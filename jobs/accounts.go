@@ -0,0 +1,73 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"firebaseAuth/audit"
+	"firebaseAuth/config"
+	"firebaseAuth/database/helper"
+	"firebaseAuth/models"
+	"firebaseAuth/provider"
+	"firebaseAuth/secrets"
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+const (
+	purgeBatchSize     = 100
+	maxPurgeRetryDelay = 24 * time.Hour
+)
+
+// PurgeDeactivatedAccounts erases, every PurgeInterval until ctx is cancelled, the accounts deactivated longer than
+// DeletionGrace ago, the identity provider user and every local row, and leaves their tombstone. A user that fails
+// is retried later, after a delay that doubles with every failure, the provider user being gone already does not
+// stop the local erasure.
+func PurgeDeactivatedAccounts(ctx context.Context, identityProvider provider.IdentityProvider, recorder *audit.Recorder, accountConfig config.Account) {
+	// the key was checked by config.Validate
+	erasureKey, _ := secrets.DecodeKey(accountConfig.ErasureKey)
+
+	Every(ctx, accountConfig.PurgeInterval, "PurgeDeactivatedAccounts", func(ctx context.Context) error {
+		users, err := helper.ExpiredDeactivations(accountConfig.DeletionGrace, purgeBatchSize)
+		if err != nil {
+			return err
+		}
+
+		purged := 0
+		for _, user := range users {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			erasure, err := helper.EraseUser(user.ID, 0, models.ErasureDeletionGraceExpired, erasureKey, func(uid string) error {
+				providerErr := identityProvider.DeleteUser(ctx, uid)
+				if errors.Is(providerErr, provider.ErrUserNotFound) {
+					return nil
+				}
+				return providerErr
+			})
+			if err != nil {
+				logrus.Printf("PurgeDeactivatedAccounts: cannot purge user %d, retrying later:%v", user.ID, err)
+				// a failed purge would otherwise stay first in the batch and be retried on every run
+				if deferErr := helper.DeferPurge(user.ID, accountConfig.PurgeInterval, maxPurgeRetryDelay); deferErr != nil {
+					return deferErr
+				}
+				continue
+			}
+			purged++
+
+			// the purged user is named only through its tombstone, EraseUser has just scrubbed them from the log
+			entry, err := audit.NewEntry(nil, audit.EventAccountPurged, 0, 0,
+				map[string]interface{}{"reason": erasure.Reason, "erasureId": erasure.ID})
+			if err == nil {
+				err = recorder.Record(ctx, entry)
+			}
+			if err != nil {
+				logrus.Printf("PurgeDeactivatedAccounts: cannot record the purge of %d:%v", user.ID, err)
+			}
+		}
+		if purged > 0 {
+			logrus.Printf("PurgeDeactivatedAccounts: purged %d accounts", purged)
+		}
+		return nil
+	})
+}
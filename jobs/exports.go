@@ -0,0 +1,52 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"firebaseAuth/audit"
+	"firebaseAuth/config"
+	"firebaseAuth/database/helper"
+	"firebaseAuth/export"
+	"github.com/sirupsen/logrus"
+)
+
+// BuildExports works through the queued GET /user/export jobs every PollInterval until ctx is cancelled and
+// deletes the expired ones. Workers on several instances share the queue, each job is claimed by one of them.
+func BuildExports(ctx context.Context, recorder *audit.Recorder, exportConfig config.Export) {
+	Every(ctx, exportConfig.PollInterval, "BuildExports", func(ctx context.Context) error {
+		deleted, err := helper.DeleteExpiredExports()
+		if err != nil {
+			return err
+		}
+		if deleted > 0 {
+			logrus.Printf("BuildExports: deleted %d expired exports", deleted)
+		}
+
+		for ctx.Err() == nil {
+			job, err := helper.ClaimExportJob(exportConfig.StaleAfter)
+			if err == sql.ErrNoRows {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+
+			archive, err := export.Build(ctx, recorder, job.UserID)
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				// shutting down, the job goes stale and another run picks it up again
+				return ctxErr
+			}
+			if err != nil {
+				logrus.Printf("BuildExports: cannot build export job %d:%v", job.ID, err)
+				if err := helper.FailExportJob(job.ID, err.Error(), exportConfig.TTL); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := helper.FinishExportJob(job.ID, archive, exportConfig.TTL); err != nil {
+				return err
+			}
+		}
+		return ctx.Err()
+	})
+}
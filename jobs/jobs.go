@@ -0,0 +1,25 @@
+package jobs
+
+import (
+	"context"
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+// Every runs fn once per interval until ctx is cancelled, a failing run is logged and retried on the next tick
+func Every(ctx context.Context, interval time.Duration, name string, fn func(ctx context.Context) error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			logrus.Printf("%s: stopped", name)
+			return
+		case <-ticker.C:
+			if err := fn(ctx); err != nil {
+				logrus.Printf("%s: run failed:%v", name, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package jobs
+
+import (
+	"context"
+	"firebaseAuth/lockout"
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+// PurgeLoginAttempts drops failed login counters that no longer lock anything, once per interval until ctx is cancelled
+func PurgeLoginAttempts(ctx context.Context, guard *lockout.Guard, interval time.Duration) {
+	Every(ctx, interval, "PurgeLoginAttempts", func(ctx context.Context) error {
+		purged, err := guard.Purge(ctx)
+		if err != nil {
+			return err
+		}
+		if purged > 0 {
+			logrus.Printf("PurgeLoginAttempts: deleted %d login counters", purged)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,95 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"firebaseAuth/database/helper"
+	"firebaseAuth/provider"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"strings"
+)
+
+const reconcilePageSize = 500
+
+// ReconcileReport counts what ReconcileUsers found
+type ReconcileReport struct {
+	Checked  int
+	Drifted  int
+	Repaired int
+	Missing  int
+	Failed   int
+}
+
+// ReconcileUsers compares every active local user with its identity provider record. Postgres is the source of
+// truth: with repair set, drifted provider records are updated to match it. Users missing from the provider are
+// only reported, they cannot be recreated without their password.
+func ReconcileUsers(ctx context.Context, identityProvider provider.IdentityProvider, repair bool) (ReconcileReport, error) {
+	var report ReconcileReport
+
+	afterID := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+
+		profiles, err := helper.GetProfiles(afterID, reconcilePageSize)
+		if err != nil {
+			return report, err
+		}
+		if len(profiles) == 0 {
+			return report, nil
+		}
+
+		for _, profile := range profiles {
+			afterID = profile.ID
+			report.Checked++
+
+			record, err := identityProvider.GetUser(ctx, profile.UID)
+			if err != nil {
+				if errors.Is(err, provider.ErrUserNotFound) {
+					report.Missing++
+					logrus.Printf("ReconcileUsers: user %d (%s) does not exist in the identity provider", profile.ID, profile.UID)
+					continue
+				}
+				report.Failed++
+				logrus.Printf("ReconcileUsers: cannot get user %d:%v", profile.ID, err)
+				continue
+			}
+
+			changes, changed := provider.Changes(record, provider.FromProfile(profile))
+			if !changed {
+				continue
+			}
+			report.Drifted++
+			logrus.Printf("ReconcileUsers: user %d drifted: %s", profile.ID, describeChanges(record, changes))
+			if !repair {
+				continue
+			}
+
+			if _, err := identityProvider.UpdateUser(ctx, profile.UID, changes); err != nil {
+				report.Failed++
+				logrus.Printf("ReconcileUsers: cannot repair user %d:%v", profile.ID, err)
+				continue
+			}
+			report.Repaired++
+		}
+	}
+}
+
+func describeChanges(record provider.UserRecord, changes provider.UserToUpdate) string {
+	descriptions := make([]string, 0, 4)
+	if changes.Email != nil {
+		descriptions = append(descriptions, fmt.Sprintf("email %q -> %q", record.Email, *changes.Email))
+	}
+	if changes.EmailVerified != nil {
+		descriptions = append(descriptions, fmt.Sprintf("emailVerified %t -> %t", record.EmailVerified, *changes.EmailVerified))
+	}
+	if changes.DisplayName != nil {
+		descriptions = append(descriptions, fmt.Sprintf("displayName %q -> %q", record.DisplayName, *changes.DisplayName))
+	}
+	if changes.PhoneNumber != nil {
+		descriptions = append(descriptions, fmt.Sprintf("phoneNumber %q -> %q", record.PhoneNumber, *changes.PhoneNumber))
+	}
+	return strings.Join(descriptions, ", ")
+}
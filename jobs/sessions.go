@@ -0,0 +1,41 @@
+package jobs
+
+import (
+	"context"
+	"firebaseAuth/config"
+	"firebaseAuth/database/helper"
+	"github.com/sirupsen/logrus"
+)
+
+// ReapSessions marks idle sessions as expired and deletes the ones, and the two-factor login challenges, past the
+// retention window, until ctx is cancelled
+func ReapSessions(ctx context.Context, sessionConfig config.Session) {
+	Every(ctx, sessionConfig.ReapInterval, "ReapSessions", func(ctx context.Context) error {
+		if sessionConfig.IdleTimeout > 0 {
+			expired, err := helper.ExpireIdleSessions(sessionConfig.IdleTimeout)
+			if err != nil {
+				return err
+			}
+			if expired > 0 {
+				logrus.Printf("ReapSessions: expired %d idle sessions", expired)
+			}
+		}
+
+		purged, err := helper.PurgeExpiredSessions(sessionConfig.Retention)
+		if err != nil {
+			return err
+		}
+		if purged > 0 {
+			logrus.Printf("ReapSessions: deleted %d expired sessions", purged)
+		}
+
+		purged, err = helper.PurgeMFAChallenges(sessionConfig.Retention)
+		if err != nil {
+			return err
+		}
+		if purged > 0 {
+			logrus.Printf("ReapSessions: deleted %d expired two-factor challenges", purged)
+		}
+		return nil
+	})
+}
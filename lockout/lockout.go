@@ -0,0 +1,161 @@
+package lockout
+
+import (
+	"context"
+	"firebaseAuth/config"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Entry is what a Store knows about one key
+type Entry struct {
+	Failures    int
+	LockedUntil time.Time
+}
+
+// Store keeps the failed login counters by key, "email:<email>", "mfa:<user id>" or "ip:<ip>". Every method is safe for concurrent use.
+type Store interface {
+	Get(ctx context.Context, key string) (Entry, error)
+	// Fail counts a failure for key, starting over at 1 when the previous one is older than window, and locks the
+	// key for lockFor(failures) unless it is already locked for longer
+	Fail(ctx context.Context, key string, window time.Duration, lockFor func(failures int) time.Duration) (Entry, error)
+	Clear(ctx context.Context, key string) error
+	// Purge forgets keys whose last failure is older than olderThan and whose lock has run out
+	Purge(ctx context.Context, olderThan time.Duration) (int64, error)
+}
+
+func NewStore(policy config.Lockout) (Store, error) {
+	switch policy.Store {
+	case config.LockoutStorePostgres:
+		return NewPostgres(), nil
+	case config.LockoutStoreMemory:
+		return NewMemory(), nil
+	}
+	return nil, fmt.Errorf("lockout: unknown store %q", policy.Store)
+}
+
+func EmailKey(email string) string {
+	return "email:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func IPKey(ip string) string {
+	return "ip:" + ip
+}
+
+// MFAKey counts the wrong two-factor codes of a user. It is kept apart from the email key, which the correct
+// password resets, so starting a new challenge does not wipe the count.
+func MFAKey(userID int) string {
+	return "mfa:" + strconv.Itoa(userID)
+}
+
+// Guard applies the lockout policy to logins
+type Guard struct {
+	store  Store
+	policy config.Lockout
+}
+
+func NewGuard(store Store, policy config.Lockout) *Guard {
+	return &Guard{store: store, policy: policy}
+}
+
+// Check returns how long a login for email from ip has to wait, 0 means it may go ahead
+func (g *Guard) Check(ctx context.Context, email, ip string) (time.Duration, error) {
+	return g.wait(ctx, EmailKey(email), IPKey(ip))
+}
+
+// Fail records a failed login and returns how long the next attempt has to wait
+func (g *Guard) Fail(ctx context.Context, email, ip string) (time.Duration, error) {
+	return g.fail(ctx, EmailKey(email), ip)
+}
+
+// CheckMFA is Check for the two-factor step of userID
+func (g *Guard) CheckMFA(ctx context.Context, userID int, ip string) (time.Duration, error) {
+	return g.wait(ctx, MFAKey(userID), IPKey(ip))
+}
+
+// FailMFA records a wrong two-factor code, it backs off and locks like a wrong password does
+func (g *Guard) FailMFA(ctx context.Context, userID int, ip string) (time.Duration, error) {
+	return g.fail(ctx, MFAKey(userID), ip)
+}
+
+// SucceedMFA resets the two-factor counter of userID after a correct code
+func (g *Guard) SucceedMFA(ctx context.Context, userID int) error {
+	return g.store.Clear(ctx, MFAKey(userID))
+}
+
+func (g *Guard) wait(ctx context.Context, keys ...string) (time.Duration, error) {
+	var wait time.Duration
+	for _, key := range keys {
+		entry, err := g.store.Get(ctx, key)
+		if err != nil {
+			return 0, err
+		}
+		if remaining := time.Until(entry.LockedUntil); remaining > wait {
+			wait = remaining
+		}
+	}
+	return wait, nil
+}
+
+// fail counts a failure for the account key, with the email back-off, and for ip
+func (g *Guard) fail(ctx context.Context, accountKey, ip string) (time.Duration, error) {
+	accountEntry, err := g.store.Fail(ctx, accountKey, g.policy.Window, g.emailLock)
+	if err != nil {
+		return 0, err
+	}
+	ipEntry, err := g.store.Fail(ctx, IPKey(ip), g.policy.Window, g.ipLock)
+	if err != nil {
+		return 0, err
+	}
+
+	wait := time.Until(accountEntry.LockedUntil)
+	if ipWait := time.Until(ipEntry.LockedUntil); ipWait > wait {
+		wait = ipWait
+	}
+	if wait < 0 {
+		return 0, nil
+	}
+	return wait, nil
+}
+
+// Succeed resets the counter of email after a successful login. The ip counter is left alone, one account the
+// attacker controls must not wipe the failures of all the others tried from the same ip.
+func (g *Guard) Succeed(ctx context.Context, email string) error {
+	return g.store.Clear(ctx, EmailKey(email))
+}
+
+// Clear lifts the lockout of a key, it is how an admin unlocks an email or an ip
+func (g *Guard) Clear(ctx context.Context, key string) error {
+	return g.store.Clear(ctx, key)
+}
+
+// Purge drops counters that no longer matter
+func (g *Guard) Purge(ctx context.Context) (int64, error) {
+	return g.store.Purge(ctx, g.policy.Window)
+}
+
+func (g *Guard) emailLock(failures int) time.Duration {
+	if failures >= g.policy.Threshold {
+		return g.policy.Duration
+	}
+	if failures < g.policy.BackoffAfter {
+		return 0
+	}
+	delay := g.policy.BaseDelay
+	for i := g.policy.BackoffAfter; i < failures && delay < g.policy.Duration; i++ {
+		delay *= 2
+	}
+	if delay > g.policy.Duration {
+		return g.policy.Duration
+	}
+	return delay
+}
+
+func (g *Guard) ipLock(failures int) time.Duration {
+	if failures >= g.policy.IPThreshold {
+		return g.policy.Duration
+	}
+	return 0
+}
@@ -0,0 +1,198 @@
+package lockout
+
+import (
+	"context"
+	"firebaseAuth/config"
+	"fmt"
+	"testing"
+	"time"
+)
+
+var testPolicy = config.Lockout{
+	Store:        config.LockoutStoreMemory,
+	Window:       time.Hour,
+	BackoffAfter: 3,
+	BaseDelay:    time.Second,
+	Threshold:    7,
+	Duration:     time.Minute,
+	IPThreshold:  10,
+}
+
+func TestEmailLock(t *testing.T) {
+	guard := NewGuard(NewMemory(), testPolicy)
+
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{1, 0},
+		{2, 0},
+		{3, time.Second},
+		{4, 2 * time.Second},
+		{5, 4 * time.Second},
+		{6, 8 * time.Second},
+		{7, time.Minute},
+		{20, time.Minute},
+	}
+	for _, test := range tests {
+		if got := guard.emailLock(test.failures); got != test.want {
+			t.Errorf("emailLock(%d) = %s, want %s", test.failures, got, test.want)
+		}
+	}
+}
+
+func TestEmailLockCappedAtDuration(t *testing.T) {
+	policy := testPolicy
+	policy.Threshold = 100
+	guard := NewGuard(NewMemory(), policy)
+
+	if got := guard.emailLock(50); got != policy.Duration {
+		t.Errorf("emailLock(50) = %s, want the lock duration %s", got, policy.Duration)
+	}
+}
+
+func TestIPLock(t *testing.T) {
+	guard := NewGuard(NewMemory(), testPolicy)
+
+	if got := guard.ipLock(testPolicy.IPThreshold - 1); got != 0 {
+		t.Errorf("ipLock below the threshold = %s, want 0", got)
+	}
+	if got := guard.ipLock(testPolicy.IPThreshold); got != testPolicy.Duration {
+		t.Errorf("ipLock at the threshold = %s, want %s", got, testPolicy.Duration)
+	}
+}
+
+func TestGuardBackoff(t *testing.T) {
+	ctx := context.Background()
+	guard := NewGuard(NewMemory(), testPolicy)
+	const email, ip = "Someone@Example.com", "192.0.2.1"
+
+	for i := 1; i < testPolicy.BackoffAfter; i++ {
+		wait, err := guard.Fail(ctx, email, ip)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if wait != 0 {
+			t.Fatalf("failure %d waits %s, want no back-off yet", i, wait)
+		}
+	}
+
+	wait, err := guard.Fail(ctx, email, ip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wait <= 0 || wait > testPolicy.BaseDelay {
+		t.Errorf("failure %d waits %s, want up to %s", testPolicy.BackoffAfter, wait, testPolicy.BaseDelay)
+	}
+
+	// keys are case insensitive and the ip has a counter of its own
+	if wait, _ := guard.Check(ctx, "someone@example.com", "192.0.2.2"); wait <= 0 {
+		t.Error("Check of the same email from another ip is not locked")
+	}
+	if wait, _ := guard.Check(ctx, "other@example.com", ip); wait != 0 {
+		t.Errorf("Check of another email from the same ip waits %s, want 0", wait)
+	}
+
+	if err := guard.Succeed(ctx, email); err != nil {
+		t.Fatal(err)
+	}
+	if wait, _ := guard.Check(ctx, email, ip); wait != 0 {
+		t.Errorf("Check after Succeed waits %s, want 0", wait)
+	}
+}
+
+func TestGuardMFAKeptApart(t *testing.T) {
+	ctx := context.Background()
+	guard := NewGuard(NewMemory(), testPolicy)
+	const userID, email, ip = 7, "someone@example.com", "192.0.2.1"
+
+	for i := 0; i < testPolicy.Threshold; i++ {
+		if _, err := guard.FailMFA(ctx, userID, ip); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a correct password must not reset the wrong codes
+	if err := guard.Succeed(ctx, email); err != nil {
+		t.Fatal(err)
+	}
+	wait, err := guard.CheckMFA(ctx, userID, "192.0.2.2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wait <= testPolicy.Duration-time.Second {
+		t.Errorf("CheckMFA waits %s, want about %s", wait, testPolicy.Duration)
+	}
+
+	if err := guard.SucceedMFA(ctx, userID); err != nil {
+		t.Fatal(err)
+	}
+	if wait, _ := guard.CheckMFA(ctx, userID, "192.0.2.2"); wait != 0 {
+		t.Errorf("CheckMFA after SucceedMFA waits %s, want 0", wait)
+	}
+}
+
+func TestGuardIPThreshold(t *testing.T) {
+	ctx := context.Background()
+	guard := NewGuard(NewMemory(), testPolicy)
+	const ip = "192.0.2.1"
+
+	// one failure per email stays below the email back-off, the ip gets locked all the same
+	for i := 0; i < testPolicy.IPThreshold; i++ {
+		if _, err := guard.Fail(ctx, fmt.Sprintf("user%d@example.com", i), ip); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if wait, _ := guard.Check(ctx, "new@example.com", ip); wait <= 0 {
+		t.Error("Check from an ip past its threshold is not locked")
+	}
+}
+
+func TestMemoryStoreWindow(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemory()
+	noLock := func(int) time.Duration { return 0 }
+
+	store.Fail(ctx, "key", time.Hour, noLock)
+	entry, _ := store.Fail(ctx, "key", time.Hour, noLock)
+	if entry.Failures != 2 {
+		t.Errorf("failures within the window = %d, want 2", entry.Failures)
+	}
+
+	// with no window the previous failure is always too old
+	time.Sleep(time.Millisecond)
+	entry, _ = store.Fail(ctx, "key", 0, noLock)
+	if entry.Failures != 1 {
+		t.Errorf("failures after the window = %d, want 1", entry.Failures)
+	}
+}
+
+func TestMemoryStoreKeepsLongerLock(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemory()
+
+	long, _ := store.Fail(ctx, "key", time.Hour, func(int) time.Duration { return time.Hour })
+	short, _ := store.Fail(ctx, "key", time.Hour, func(int) time.Duration { return time.Second })
+	if !short.LockedUntil.Equal(long.LockedUntil) {
+		t.Errorf("a shorter lock moved LockedUntil from %s to %s", long.LockedUntil, short.LockedUntil)
+	}
+}
+
+func TestMemoryStorePurge(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemory()
+
+	store.Fail(ctx, "unlocked", time.Hour, func(int) time.Duration { return 0 })
+	store.Fail(ctx, "locked", time.Hour, func(int) time.Duration { return time.Hour })
+
+	time.Sleep(time.Millisecond)
+	purged, err := store.Purge(ctx, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if purged != 1 {
+		t.Errorf("Purge = %d, want 1", purged)
+	}
+	if entry, _ := store.Get(ctx, "locked"); entry.Failures != 1 {
+		t.Error("Purge dropped a key that is still locked")
+	}
+}
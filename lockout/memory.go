@@ -0,0 +1,78 @@
+package lockout
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type memoryEntry struct {
+	failures     int
+	lastFailedAt time.Time
+	lockedUntil  time.Time
+}
+
+// MemoryStore keeps the counters in the process, they are lost on restart and not shared between instances
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]*memoryEntry
+}
+
+func NewMemory() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]*memoryEntry)}
+}
+
+func (m *MemoryStore) Get(ctx context.Context, key string) (Entry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.entries[key]
+	if !ok {
+		return Entry{}, nil
+	}
+	return Entry{Failures: entry.failures, LockedUntil: entry.lockedUntil}, nil
+}
+
+func (m *MemoryStore) Fail(ctx context.Context, key string, window time.Duration, lockFor func(failures int) time.Duration) (Entry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	entry, ok := m.entries[key]
+	if !ok {
+		entry = &memoryEntry{}
+		m.entries[key] = entry
+	}
+	if now.Sub(entry.lastFailedAt) > window {
+		entry.failures = 0
+	}
+	entry.failures++
+	entry.lastFailedAt = now
+	if lockedUntil := now.Add(lockFor(entry.failures)); lockedUntil.After(entry.lockedUntil) {
+		entry.lockedUntil = lockedUntil
+	}
+	return Entry{Failures: entry.failures, LockedUntil: entry.lockedUntil}, nil
+}
+
+func (m *MemoryStore) Clear(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.entries, key)
+	return nil
+}
+
+func (m *MemoryStore) Purge(ctx context.Context, olderThan time.Duration) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	var purged int64
+	for key, entry := range m.entries {
+		if now.Sub(entry.lastFailedAt) > olderThan && now.After(entry.lockedUntil) {
+			delete(m.entries, key)
+			purged++
+		}
+	}
+	return purged, nil
+}
@@ -0,0 +1,99 @@
+package lockout
+
+import (
+	"context"
+	"database/sql"
+	"firebaseAuth/database"
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+// PostgresStore keeps the counters in the login_attempts table, shared by every instance of the service
+type PostgresStore struct{}
+
+func NewPostgres() *PostgresStore {
+	return &PostgresStore{}
+}
+
+func (p *PostgresStore) Get(ctx context.Context, key string) (Entry, error) {
+	// language=SQL
+	SQL := `SELECT failures,
+                   locked_until
+            FROM   login_attempts
+            WHERE  key = $1`
+
+	var row struct {
+		Failures    int          `db:"failures"`
+		LockedUntil sql.NullTime `db:"locked_until"`
+	}
+
+	err := database.FirebaseDB.GetContext(ctx, &row, SQL, key)
+	if err == sql.ErrNoRows {
+		return Entry{}, nil
+	}
+	if err != nil {
+		logrus.Printf("lockout Get: cannot get login attempts:%v", err)
+		return Entry{}, err
+	}
+	return Entry{Failures: row.Failures, LockedUntil: row.LockedUntil.Time}, nil
+}
+
+func (p *PostgresStore) Fail(ctx context.Context, key string, window time.Duration, lockFor func(failures int) time.Duration) (Entry, error) {
+	// language=SQL
+	SQL := `INSERT INTO login_attempts(key, failures, last_failed_at)
+            VALUES ($1, 1, now())
+            ON CONFLICT (key) DO UPDATE
+            SET    failures       = CASE WHEN login_attempts.last_failed_at < now() - make_interval(secs => $2::float8)
+                                         THEN 1
+                                         ELSE login_attempts.failures + 1 END,
+                   last_failed_at = now()
+            RETURNING failures`
+
+	var entry Entry
+	txErr := database.Tx(func(tx *sqlx.Tx) error {
+		err := tx.GetContext(ctx, &entry.Failures, SQL, key, window.Seconds())
+		if err != nil {
+			return err
+		}
+
+		// language=SQL
+		lockSQL := `UPDATE login_attempts
+                    SET    locked_until = GREATEST(locked_until, now() + make_interval(secs => $2::float8))
+                    WHERE  key = $1
+                    RETURNING locked_until`
+		return tx.GetContext(ctx, &entry.LockedUntil, lockSQL, key, lockFor(entry.Failures).Seconds())
+	})
+	if txErr != nil {
+		logrus.Printf("lockout Fail: cannot count failed login:%v", txErr)
+		return entry, txErr
+	}
+	return entry, nil
+}
+
+func (p *PostgresStore) Clear(ctx context.Context, key string) error {
+	// language=SQL
+	SQL := `DELETE FROM login_attempts
+            WHERE  key = $1`
+
+	_, err := database.FirebaseDB.ExecContext(ctx, SQL, key)
+	if err != nil {
+		logrus.Printf("lockout Clear: cannot clear login attempts:%v", err)
+		return err
+	}
+	return nil
+}
+
+func (p *PostgresStore) Purge(ctx context.Context, olderThan time.Duration) (int64, error) {
+	// language=SQL
+	SQL := `DELETE FROM login_attempts
+            WHERE  last_failed_at < now() - make_interval(secs => $1::float8)
+            AND    (locked_until IS NULL OR locked_until < now())`
+
+	result, err := database.FirebaseDB.ExecContext(ctx, SQL, olderThan.Seconds())
+	if err != nil {
+		logrus.Printf("lockout Purge: cannot delete old login attempts:%v", err)
+		return 0, err
+	}
+	return result.RowsAffected()
+}
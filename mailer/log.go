@@ -0,0 +1,40 @@
+package mailer
+
+import (
+	"context"
+	"github.com/sirupsen/logrus"
+	"os"
+	"sync"
+)
+
+type logMailer struct {
+	mu   sync.Mutex
+	from string
+	path string
+}
+
+// NewLog is the mailer for local development, it appends every message to the file at path or logs it when path
+// is empty, so reset and verification links can be copied from there
+func NewLog(from, path string) Mailer {
+	return &logMailer{from: from, path: path}
+}
+
+func (l *logMailer) Send(ctx context.Context, message Message) error {
+	if l.path == "" {
+		logrus.Printf("mail to %s: %s\n%s", message.To, message.Subject, message.Body)
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	file, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(compose(l.from, message), "\r\n\r\n"...)); err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
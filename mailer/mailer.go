@@ -0,0 +1,28 @@
+package mailer
+
+import (
+	"context"
+	"firebaseAuth/config"
+	"fmt"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers transactional email, handlers get one built from config.Mail at startup
+type Mailer interface {
+	Send(ctx context.Context, message Message) error
+}
+
+func New(mailConfig config.Mail) (Mailer, error) {
+	switch mailConfig.Driver {
+	case config.MailDriverSMTP:
+		return NewSMTP(mailConfig.SMTPHost, mailConfig.SMTPPort, mailConfig.SMTPUser, mailConfig.SMTPPassword, mailConfig.From), nil
+	case config.MailDriverLog:
+		return NewLog(mailConfig.From, mailConfig.LogFile), nil
+	}
+	return nil, fmt.Errorf("mailer: unknown driver %q", mailConfig.Driver)
+}
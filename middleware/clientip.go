@@ -0,0 +1,19 @@
+package middleware
+
+import (
+	"context"
+	"firebaseAuth/utilities"
+	"net"
+	"net/http"
+)
+
+// ClientIP resolves the client address once per request, see utilities.ResolveClientIP, and stores it for
+// utilities.ClientIP. It has to run before anything that keys on the client, the rate limits and the login lockout.
+func ClientIP(trusted []*net.IPNet) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), utilities.ClientIPContextKey, utilities.ResolveClientIP(r, trusted))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
@@ -3,71 +3,78 @@ package middleware
 import (
 	"context"
 	"database/sql"
-	firebase "firebase.google.com/go"
+	"errors"
+	"firebaseAuth/apperror"
+	"firebaseAuth/config"
 	"firebaseAuth/database/helper"
 	"firebaseAuth/models"
+	"firebaseAuth/provider"
 	"firebaseAuth/utilities"
 	"github.com/sirupsen/logrus"
-	"google.golang.org/api/option"
 	"net/http"
-	"os"
 )
 
-func Auth(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		firebaseToken := r.Header.Get("token")
-		opt := option.WithCredentialsJSON([]byte(os.Getenv("firebase_key")))
-		app, err := firebase.NewApp(context.Background(), nil, opt)
-		if err != nil {
-			logrus.Printf("FirebaseLogin:cannot create firebase application object:%v", err)
-			return
-		}
-		client, err := app.Auth(context.Background())
-		if err != nil {
-			logrus.Printf("FirebaseLogin:cannot create client:%v", err)
-		}
+var errNoSession = apperror.New(apperror.CodeUnauthorized, "token carries no session")
 
-		//header := r.Header.Get(echo.HeaderAuthorization)
-		token, err := client.VerifyIDToken(context.Background(), firebaseToken)
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			logrus.Printf("Auth: cannot virfy token:%v", err)
-			return
-		}
+// Auth verifies the ID token, checks the session named in its sid claim and keeps that session alive
+func Auth(identityProvider provider.IdentityProvider, sessionConfig config.Session) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			firebaseToken := r.Header.Get("token")
 
-		userDetails, err := client.GetUser(context.Background(), token.UID)
-		if err != nil {
-			logrus.Printf("firebaseToken: cannot get user details:%v", err)
-			return
-		}
+			token, err := identityProvider.VerifyIDToken(r.Context(), firebaseToken)
+			if err != nil {
+				logrus.Printf("Auth: cannot virfy token:%v", err)
+				utilities.RespondError(w, r, err)
+				return
+			}
 
-		userIDAndPassword, err := helper.FetchPasswordAndID(userDetails.Email)
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			logrus.Printf("FetchPasswordAndID: cannot get user id:%v", err)
-			return
-		}
+			userDetails, err := identityProvider.GetUser(r.Context(), token.UID)
+			if err != nil {
+				logrus.Printf("firebaseToken: cannot get user details:%v", err)
+				if errors.Is(err, provider.ErrUserNotFound) {
+					err = apperror.Wrap(err, apperror.CodeUnauthorized, "user no longer exists")
+				}
+				utilities.RespondError(w, r, err)
+				return
+			}
 
-		_, err = helper.CheckSession(userIDAndPassword.ID)
-		if err != nil {
-			if err == sql.ErrNoRows {
-				w.WriteHeader(http.StatusUnauthorized)
-				_, EncoderErr := w.Write([]byte("ERROR: session expired"))
-				if EncoderErr != nil {
-					return
+			userIDAndPassword, err := helper.FetchPasswordAndID(userDetails.Email)
+			if err != nil {
+				logrus.Printf("FetchPasswordAndID: cannot get user id:%v", err)
+				if err == sql.ErrNoRows {
+					err = apperror.Wrap(err, apperror.CodeUnauthorized, "user no longer exists")
 				}
-				logrus.Printf("session expired:%v", err)
-				//w.WriteHeader(http.StatusUnauthorized)
+				utilities.RespondError(w, r, err)
+				return
+			}
+
+			if userIDAndPassword.Disabled {
+				logrus.Printf("Auth: user %d is disabled", userIDAndPassword.ID)
+				utilities.RespondError(w, r, helper.ErrAccountDisabled)
+				return
+			}
+
+			sessionID, _ := token.Claims["sid"].(string)
+			if sessionID == "" {
+				logrus.Printf("Auth: token carries no session id")
+				utilities.RespondError(w, r, errNoSession)
 				return
-			} else {
-				w.WriteHeader(http.StatusInternalServerError)
+			}
+
+			err = helper.TouchSession(userIDAndPassword.ID, sessionID, sessionConfig.IdleTimeout)
+			if err != nil {
 				logrus.Printf("CheckSession: unable to check session:%v", err)
+				if err == sql.ErrNoRows {
+					err = apperror.Wrap(err, apperror.CodeUnauthorized, "session expired")
+				}
+				utilities.RespondError(w, r, err)
 				return
 			}
-		}
 
-		value := models.ContextValues{ID: userIDAndPassword.ID}
-		ctx := context.WithValue(r.Context(), utilities.UserContextKey, value)
-		next.ServeHTTP(w, r.WithContext(ctx))
-	})
+			value := models.ContextValues{ID: userIDAndPassword.ID, Email: userDetails.Email, Roles: models.ImpliedRoles(userIDAndPassword.Role), SessionID: sessionID, EmailVerified: userIDAndPassword.EmailVerified}
+			ctx := context.WithValue(r.Context(), utilities.UserContextKey, value)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
 }
@@ -0,0 +1,122 @@
+package middleware
+
+import (
+	"firebaseAuth/apperror"
+	"firebaseAuth/config"
+	"firebaseAuth/models"
+	"firebaseAuth/utilities"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var errRateLimited = apperror.New(apperror.CodeTooManyRequests, "too many requests, slow down")
+
+// RateLimiter keeps one token bucket per key in memory, so every server process counts on its own
+type RateLimiter struct {
+	policy config.RateLimitPolicy
+	// refill is how many tokens a bucket gains per second
+	refill float64
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+func NewRateLimiter(policy config.RateLimitPolicy) *RateLimiter {
+	limiter := &RateLimiter{policy: policy, buckets: make(map[string]*bucket), lastSweep: time.Now()}
+	if policy.Requests > 0 {
+		limiter.refill = float64(policy.Requests) / policy.Per.Seconds()
+	}
+	return limiter
+}
+
+// take spends one token of key. It returns whether the request may go ahead, the whole tokens left, how long until
+// the bucket is full again and, when the request is refused, how long until the next token.
+func (l *RateLimiter) take(key string, now time.Time) (allowed bool, remaining int, reset, retryAfter time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now)
+
+	capacity := float64(l.policy.Burst)
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: capacity, updated: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(capacity, b.tokens+now.Sub(b.updated).Seconds()*l.refill)
+	b.updated = now
+
+	if b.tokens >= 1 {
+		allowed = true
+		b.tokens--
+	} else {
+		retryAfter = secondsToDuration((1 - b.tokens) / l.refill)
+	}
+	reset = secondsToDuration((capacity - b.tokens) / l.refill)
+	return allowed, int(b.tokens), reset, retryAfter
+}
+
+// sweep forgets the buckets that have refilled completely, they behave the same as a new one. It runs at most once
+// per policy period so the map stays as small as the number of recently active keys.
+func (l *RateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < l.policy.Per {
+		return
+	}
+	l.lastSweep = now
+	capacity := float64(l.policy.Burst)
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.updated).Seconds()*l.refill >= capacity {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// RateLimit refuses requests with 429 once the client has spent its bucket. The client is the user from
+// utilities.UserContextKey when Auth ran before it, otherwise the client ip. Every response carries the
+// RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset headers, refused ones also Retry-After.
+func RateLimit(limiter *RateLimiter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if limiter.policy.Requests == 0 {
+			return next
+		}
+		policyHeader := fmt.Sprintf("%d;w=%d", limiter.policy.Requests, int(limiter.policy.Per.Seconds()))
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := "ip:" + utilities.ClientIP(r)
+			if contextValues, ok := r.Context().Value(utilities.UserContextKey).(models.ContextValues); ok {
+				key = "user:" + strconv.Itoa(contextValues.ID)
+			}
+
+			allowed, remaining, reset, retryAfter := limiter.take(key, time.Now())
+			w.Header().Set("RateLimit-Policy", policyHeader)
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(limiter.policy.Burst))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(remaining))
+			w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(reset)))
+			if !allowed {
+				logrus.Printf("RateLimit: %s is over its limit", key)
+				w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(retryAfter)))
+				utilities.RespondError(w, r, errRateLimited)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
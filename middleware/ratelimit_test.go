@@ -0,0 +1,120 @@
+package middleware
+
+import (
+	"firebaseAuth/config"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterRefill(t *testing.T) {
+	// one token a second, three at once
+	limiter := NewRateLimiter(config.RateLimitPolicy{Requests: 60, Per: time.Minute, Burst: 3})
+	start := time.Unix(1000, 0)
+
+	tests := []struct {
+		name           string
+		key            string
+		after          time.Duration
+		wantAllowed    bool
+		wantRemaining  int
+		wantRetryAfter time.Duration
+	}{
+		{"first request", "a", 0, true, 2, 0},
+		{"second request", "a", 0, true, 1, 0},
+		{"third request empties the bucket", "a", 0, true, 0, 0},
+		{"burst spent", "a", 0, false, 0, time.Second},
+		{"half a token refilled", "a", 500 * time.Millisecond, false, 0, 500 * time.Millisecond},
+		{"one token refilled", "a", time.Second, true, 0, 0},
+		{"other keys have their own bucket", "b", time.Second, true, 2, 0},
+		{"refill stops at the burst", "a", time.Hour, true, 2, 0},
+	}
+	for _, test := range tests {
+		allowed, remaining, _, retryAfter := limiter.take(test.key, start.Add(test.after))
+		if allowed != test.wantAllowed || remaining != test.wantRemaining || retryAfter != test.wantRetryAfter {
+			t.Errorf("%s: take = (%v, %d, %s), want (%v, %d, %s)", test.name, allowed, remaining, retryAfter,
+				test.wantAllowed, test.wantRemaining, test.wantRetryAfter)
+		}
+	}
+}
+
+func TestRateLimiterReset(t *testing.T) {
+	limiter := NewRateLimiter(config.RateLimitPolicy{Requests: 60, Per: time.Minute, Burst: 3})
+	now := time.Unix(1000, 0)
+
+	_, _, reset, _ := limiter.take("a", now)
+	if reset != time.Second {
+		t.Errorf("reset after one request = %s, want 1s", reset)
+	}
+	limiter.take("a", now)
+	_, _, reset, _ = limiter.take("a", now)
+	if reset != 3*time.Second {
+		t.Errorf("reset of an empty bucket = %s, want 3s", reset)
+	}
+}
+
+func TestRateLimiterSweep(t *testing.T) {
+	limiter := NewRateLimiter(config.RateLimitPolicy{Requests: 60, Per: time.Minute, Burst: 3})
+	now := time.Now()
+
+	limiter.take("a", now)
+	limiter.take("b", now.Add(59*time.Second+500*time.Millisecond))
+	limiter.take("c", now.Add(time.Minute))
+	// a has refilled by now, b has not
+	if _, ok := limiter.buckets["a"]; ok {
+		t.Error("full bucket a was not swept")
+	}
+	if _, ok := limiter.buckets["b"]; !ok {
+		t.Error("bucket b was swept before it refilled")
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	handler := RateLimit(NewRateLimiter(config.RateLimitPolicy{Requests: 1, Per: time.Hour, Burst: 1}))(next)
+
+	request := func(remoteAddr string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	first := request("192.0.2.1:1234")
+	if first.Code != http.StatusNoContent {
+		t.Fatalf("first request status = %d, want %d", first.Code, http.StatusNoContent)
+	}
+	if got := first.Header().Get("RateLimit-Policy"); got != "1;w=3600" {
+		t.Errorf("RateLimit-Policy = %q, want 1;w=3600", got)
+	}
+	if got := first.Header().Get("RateLimit-Remaining"); got != "0" {
+		t.Errorf("RateLimit-Remaining = %q, want 0", got)
+	}
+
+	second := request("192.0.2.1:5678")
+	if second.Code != http.StatusTooManyRequests {
+		t.Fatalf("second request status = %d, want %d", second.Code, http.StatusTooManyRequests)
+	}
+	if got := second.Header().Get("Retry-After"); got != "3600" {
+		t.Errorf("Retry-After = %q, want 3600", got)
+	}
+
+	if other := request("192.0.2.2:1234"); other.Code != http.StatusNoContent {
+		t.Errorf("request from another ip status = %d, want %d", other.Code, http.StatusNoContent)
+	}
+}
+
+func TestRateLimitDisabled(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	handler := RateLimit(NewRateLimiter(config.RateLimitPolicy{}))(next)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if got := w.Header().Get("RateLimit-Limit"); got != "" {
+		t.Errorf("disabled limiter set RateLimit-Limit %q", got)
+	}
+}
@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"firebaseAuth/apperror"
+	"firebaseAuth/models"
+	"firebaseAuth/utilities"
+	"github.com/sirupsen/logrus"
+	"net/http"
+)
+
+// RequireRole lets only users who have role through, admins also pass a moderator check. It runs after Auth.
+func RequireRole(role string) func(http.Handler) http.Handler {
+	errMissingRole := apperror.New(apperror.CodeForbidden, "requires the "+role+" role")
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			contextValues, ok := r.Context().Value(utilities.UserContextKey).(models.ContextValues)
+			if !ok || !hasRole(contextValues.Roles, role) {
+				logrus.Printf("RequireRole: user %d does not have the %s role", contextValues.ID, role)
+				utilities.RespondError(w, r, errMissingRole)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func hasRole(roles []string, role string) bool {
+	for _, r := range roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
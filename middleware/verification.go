@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"firebaseAuth/config"
+	"firebaseAuth/database/helper"
+	"firebaseAuth/models"
+	"firebaseAuth/utilities"
+	"github.com/sirupsen/logrus"
+	"net/http"
+)
+
+// RequireVerifiedEmail keeps users whose email is not verified out of the routes behind it, unless the
+// verification policy is off. It runs after Auth.
+func RequireVerifiedEmail(policy string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if policy == config.VerificationPolicyOff {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			contextValues, ok := r.Context().Value(utilities.UserContextKey).(models.ContextValues)
+			if !ok || !contextValues.EmailVerified {
+				logrus.Printf("RequireVerifiedEmail: user %d has not verified the email", contextValues.ID)
+				utilities.RespondError(w, r, helper.ErrEmailNotVerified)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
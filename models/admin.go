@@ -0,0 +1,47 @@
+package models
+
+import "time"
+
+// AdminUserFilter narrows the admin user search, zero values do not filter. Archived is "false" (the default),
+// "true" or "all", Disabled is "", "true" or "false".
+type AdminUserFilter struct {
+	Query       string
+	Archived    string
+	Disabled    string
+	CreatedFrom time.Time
+	CreatedTo   time.Time
+	EmailDomain string
+	Limit       int
+	Page        int
+}
+
+// AdminUser is a user as admins see it, archived and disabled ones included
+type AdminUser struct {
+	ID            int        `json:"id" db:"id"`
+	Name          string     `json:"name" db:"name"`
+	Email         string     `json:"email" db:"email"`
+	Phone         string     `json:"phone" db:"phone_no"`
+	Age           int        `json:"age" db:"age"`
+	Gender        string     `json:"gender" db:"gender"`
+	Role          string     `json:"role" db:"role"`
+	EmailVerified bool       `json:"emailVerified" db:"email_verified"`
+	CreatedAt     time.Time  `json:"createdAt" db:"created_at"`
+	DisabledAt    *time.Time `json:"disabledAt" db:"disabled_at"`
+	ArchivedAt    *time.Time `json:"archivedAt" db:"archived_at"`
+	UID           string     `json:"-" db:"user_uid"`
+}
+
+type FriendCounts struct {
+	Friends         int `json:"friends" db:"friends"`
+	PendingSent     int `json:"pendingSent" db:"pending_sent"`
+	PendingReceived int `json:"pendingReceived" db:"pending_received"`
+	Blocked         int `json:"blocked" db:"blocked"`
+}
+
+// AdminUserDetails is the full picture of one user for GET /admin/users/{id}
+type AdminUserDetails struct {
+	AdminUser
+	MFAEnabled   bool         `json:"mfaEnabled"`
+	FriendCounts FriendCounts `json:"friendCounts"`
+	Sessions     []Session    `json:"sessions"`
+}
@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// why a user was erased, stored in erasures.reason
+const (
+	ErasureUserRequest          = "user_request"
+	ErasureAdminRequest         = "admin_request"
+	ErasureDeletionGraceExpired = "deletion_grace_expired"
+)
+
+// Erasure is the tombstone left behind by an erased user. RequestedBy is the user who asked for it, nil when the
+// deletion grace of a deactivated account ran out.
+type Erasure struct {
+	ID          int64     `json:"id" db:"id"`
+	UserID      int       `json:"userId" db:"user_id"`
+	EmailHash   string    `json:"emailHash" db:"email_hash"`
+	RequestedBy *int      `json:"requestedBy" db:"requested_by"`
+	Reason      string    `json:"reason" db:"reason"`
+	ErasedAt    time.Time `json:"erasedAt" db:"erased_at"`
+}
@@ -0,0 +1,70 @@
+package models
+
+import "time"
+
+const (
+	ExportPending = "pending"
+	ExportRunning = "running"
+	ExportDone    = "done"
+	ExportFailed  = "failed"
+)
+
+// ExportUser is the users row of the caller as it is stored, minus the password hash
+type ExportUser struct {
+	ID              int        `json:"id" db:"id"`
+	Name            *string    `json:"name" db:"name"`
+	Email           string     `json:"email" db:"email"`
+	Phone           *string    `json:"phone" db:"phone_no"`
+	Age             *int       `json:"age" db:"age"`
+	Gender          *string    `json:"gender" db:"gender"`
+	Role            string     `json:"role" db:"role"`
+	UID             *string    `json:"firebaseUid" db:"user_uid"`
+	EmailVerifiedAt *time.Time `json:"emailVerifiedAt" db:"email_verified_at"`
+	CreatedAt       time.Time  `json:"createdAt" db:"created_at"`
+	UpdatedAt       time.Time  `json:"updatedAt" db:"updated_at"`
+	DisabledAt      *time.Time `json:"disabledAt" db:"disabled_at"`
+	ArchivedAt      *time.Time `json:"archivedAt" db:"archived_at"`
+}
+
+// ExportFriendRequest is one friend_request row the caller sent or received
+type ExportFriendRequest struct {
+	ID          int        `json:"id" db:"id"`
+	RequestFrom int        `json:"requestFrom" db:"request_from"`
+	RequestTo   int        `json:"requestTo" db:"request_to"`
+	Status      string     `json:"status" db:"status"`
+	CreatedAt   time.Time  `json:"createdAt" db:"created_at"`
+	UpdatedAt   time.Time  `json:"updatedAt" db:"updated_at"`
+	ArchivedAt  *time.Time `json:"archivedAt" db:"archived_at"`
+}
+
+// ExportBlock is one user_blocks row the caller made or is the subject of
+type ExportBlock struct {
+	ID         int        `json:"id" db:"id"`
+	BlockerID  int        `json:"blockerId" db:"blocker_id"`
+	BlockedID  int        `json:"blockedId" db:"blocked_id"`
+	CreatedAt  time.Time  `json:"createdAt" db:"created_at"`
+	ArchivedAt *time.Time `json:"archivedAt" db:"archived_at"`
+}
+
+// ExportMFA says whether two-factor login is set up, the secret and the recovery code hashes are left out
+type ExportMFA struct {
+	Enrolled            bool       `json:"enrolled" db:"enrolled"`
+	ConfirmedAt         *time.Time `json:"confirmedAt" db:"confirmed_at"`
+	RecoveryCodesUnused int        `json:"recoveryCodesUnused" db:"recovery_codes_unused"`
+	RecoveryCodesUsed   int        `json:"recoveryCodesUsed" db:"recovery_codes_used"`
+}
+
+// ExportJob is an asynchronous GET /user/export, the archive itself is only loaded for the download. Error is
+// what went wrong for the logs, clients only see the failed status.
+type ExportJob struct {
+	ID         int        `json:"id" db:"id"`
+	UserID     int        `json:"-" db:"user_id"`
+	Status     string     `json:"status" db:"status"`
+	Error      *string    `json:"-" db:"error"`
+	CreatedAt  time.Time  `json:"createdAt" db:"created_at"`
+	StartedAt  *time.Time `json:"startedAt" db:"started_at"`
+	FinishedAt *time.Time `json:"finishedAt" db:"finished_at"`
+	ExpiresAt  *time.Time `json:"expiresAt" db:"expires_at"`
+	// DownloadURL is set once the job is done
+	DownloadURL string `json:"downloadUrl,omitempty" db:"-"`
+}
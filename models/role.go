@@ -0,0 +1,28 @@
+package models
+
+// roles from least to most rights, every role has the rights of the ones before it
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+var roleOrder = []string{RoleUser, RoleModerator, RoleAdmin}
+
+// ImpliedRoles returns role and every role below it, e.g. admin, moderator and user for an admin
+func ImpliedRoles(role string) []string {
+	for i := range roleOrder {
+		if roleOrder[i] == role {
+			roles := make([]string, 0, i+1)
+			for j := i; j >= 0; j-- {
+				roles = append(roles, roleOrder[j])
+			}
+			return roles
+		}
+	}
+	return []string{RoleUser}
+}
+
+type RoleChange struct {
+	Role string `json:"role" validate:"required,oneof=user moderator admin"`
+}
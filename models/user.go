@@ -1,16 +1,23 @@
 package models
 
-import "github.com/dgrijalva/jwt-go"
+import (
+	"github.com/dgrijalva/jwt-go"
+	"time"
+)
 
 type UsersLoginDetails struct {
-	Email    string `json:"email" db:"email"`
-	Password string `json:"password" db:"password"`
+	Email      string `json:"email" db:"email" validate:"required,email"`
+	Password   string `json:"password" db:"password" validate:"required"`
+	DeviceName string `json:"deviceName" validate:"max=100"`
 	//FirebaseToken string `json:"firebaseToken"`
 }
 
 type UserCredentials struct {
-	ID       int    `json:"id"`
-	Password string `json:"password"`
+	ID            int    `json:"id" db:"id"`
+	Password      string `json:"password" db:"password"`
+	EmailVerified bool   `json:"emailVerified" db:"email_verified"`
+	Disabled      bool   `json:"disabled" db:"disabled"`
+	Role          string `json:"role" db:"role"`
 }
 
 type UserEmailPassword struct {
@@ -25,29 +32,150 @@ type Claims struct {
 
 type UserDetails struct {
 	ID       int    `json:"id" db:"id"`
-	Name     string `json:"name" db:"name"`
-	Email    string `json:"email" db:"email"`
-	Password string `json:"password" db:"password"`
-	Phone    string `json:"phone" db:"phone"`
-	Age      int    `json:"age" db:"age"`
-	Gender   string `json:"gender" db:"gender"`
+	Name     string `json:"name" db:"name" validate:"required,max=100"`
+	Email    string `json:"email" db:"email" validate:"required,email"`
+	Password string `json:"password,omitempty" db:"password" validate:"required,password"`
+	Phone    string `json:"phone" db:"phone" validate:"omitempty,e164"`
+	Age      int    `json:"age" db:"age" validate:"omitempty,min=13,max=120"`
+	Gender   string `json:"gender" db:"gender" validate:"omitempty,oneof=male female other"`
 	UID      string `json:"UID" db:"user_uid"`
 	Status   string `json:"status" db:"status"`
 }
 
+// Profile is the user as the user sees themselves
+type Profile struct {
+	ID            int    `json:"id" db:"id"`
+	Name          string `json:"name" db:"name"`
+	Email         string `json:"email" db:"email"`
+	Phone         string `json:"phone" db:"phone_no"`
+	Age           int    `json:"age" db:"age"`
+	Gender        string `json:"gender" db:"gender"`
+	EmailVerified bool   `json:"emailVerified" db:"email_verified"`
+	UID           string `json:"-" db:"user_uid"`
+}
+
+// ProfileUpdate is the body of PATCH /user, fields missing from the request stay nil and are left untouched.
+// Email and password have their own endpoints, sending them here is a validation error.
+type ProfileUpdate struct {
+	Name     *string `json:"name" validate:"omitempty,min=1,max=100"`
+	Phone    *string `json:"phone" validate:"omitempty,e164"`
+	Age      *int    `json:"age" validate:"omitempty,min=13,max=120"`
+	Gender   *string `json:"gender" validate:"omitempty,oneof=male female other"`
+	Email    *string `json:"email" validate:"isdefault"`
+	Password *string `json:"password" validate:"isdefault"`
+}
+
+type EmailChange struct {
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required"`
+}
+
+// PasswordConfirmation is the body of the endpoints that only need the current password, e.g. DELETE /user
+type PasswordConfirmation struct {
+	Password string `json:"password" validate:"required"`
+}
+
+// EmailRequest is the body of the endpoints that only take an email, forgot password and resend verification
+type EmailRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type PasswordReset struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required,password"`
+}
+
+type PasswordChange struct {
+	CurrentPassword     string `json:"currentPassword" validate:"required"`
+	NewPassword         string `json:"newPassword" validate:"required,password,nefield=CurrentPassword"`
+	LogoutOtherSessions bool   `json:"logoutOtherSessions"`
+}
+
+type MFACode struct {
+	Code string `json:"code" validate:"required"`
+}
+
+// MFADisable is the body of DELETE /user/mfa/totp, a stolen session alone cannot turn two-factor off
+type MFADisable struct {
+	Password string `json:"password" validate:"required"`
+	Code     string `json:"code" validate:"required"`
+}
+
+// MFALogin is the second login step, MFAToken is what Login answered with and Code a TOTP or recovery code
+type MFALogin struct {
+	MFAToken string `json:"mfaToken" validate:"required"`
+	Code     string `json:"code" validate:"required"`
+}
+
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauthUri"`
+}
+
+type MFAChallenge struct {
+	UserID     int
+	DeviceName string
+}
+
+// ErrorResponse is the body of every error the api returns
+type ErrorResponse struct {
+	Code      string      `json:"code"`
+	Message   string      `json:"message"`
+	Details   interface{} `json:"details,omitempty"`
+	RequestID string      `json:"request_id,omitempty"`
+}
+
 type ContextValues struct {
-	ID int `json:"id"`
+	ID            int      `json:"id"`
+	Email         string   `json:"email"`
+	Roles         []string `json:"roles"`
+	SessionID     string   `json:"sessionId"`
+	EmailVerified bool     `json:"emailVerified"`
+}
+
+type SessionDetails struct {
+	DeviceName string
+	IPAddress  string
+	UserAgent  string
+}
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refreshToken" validate:"required"`
+}
+
+type RefreshedSession struct {
+	UserID       int
+	SessionID    string
+	RefreshToken string
+}
+
+type UserIdentity struct {
+	ID    int    `db:"id"`
+	Email string `db:"email"`
+	UID   string `db:"user_uid"`
+	Role  string `db:"role"`
+}
+
+type Session struct {
+	ID         string    `json:"id" db:"session_uid"`
+	DeviceName string    `json:"deviceName" db:"device_name"`
+	IPAddress  string    `json:"ipAddress" db:"ip_address"`
+	UserAgent  string    `json:"userAgent" db:"user_agent"`
+	CreatedAt  time.Time `json:"createdAt" db:"created_at"`
+	LastUsedAt time.Time `json:"lastUsedAt" db:"updated_at"`
+	ExpiresAt  time.Time `json:"expiresAt" db:"expires_at"`
+	Current    bool      `json:"current" db:"-"`
 }
 
 type FriendRequest struct {
-	RequestTo int    `json:"requestTo"`
+	RequestTo int    `json:"requestTo" validate:"required,gt=0"`
 	Status    string `json:"status"`
 }
 
 type AllRequests struct {
 	ID          int    `json:"id" db:"id"`
-	RequestFrom int    `json:"requestFrom" db:"request_from"`
-	Status      string `json:"status" db:"status"`
+	RequestFrom int    `json:"requestFrom" db:"request_from" validate:"required,gt=0"`
+	Status      string `json:"status" db:"status" validate:"required,oneof=accepted rejected"`
 }
 
 type RequestList struct {
@@ -61,6 +189,12 @@ type FriendList struct {
 	Name   string `json:"name" db:"user_name"`
 }
 
+type BlockedUser struct {
+	UserID    int       `json:"userId" db:"user_id"`
+	Name      string    `json:"name" db:"user_name"`
+	BlockedAt time.Time `json:"blockedAt" db:"blocked_at"`
+}
+
 type FiltersCheck struct {
 	Limit int
 	Page  int
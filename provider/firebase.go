@@ -0,0 +1,129 @@
+package provider
+
+import (
+	"context"
+	firebase "firebase.google.com/go"
+	"firebase.google.com/go/auth"
+	"fmt"
+	"google.golang.org/api/option"
+)
+
+type firebaseProvider struct {
+	client *auth.Client
+}
+
+// NewFirebase creates the Firebase Auth client from the service account json once
+func NewFirebase(ctx context.Context, credentialsJSON string) (IdentityProvider, error) {
+	opt := option.WithCredentialsJSON([]byte(credentialsJSON))
+	app, err := firebase.NewApp(ctx, nil, opt)
+	if err != nil {
+		return nil, err
+	}
+	client, err := app.Auth(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &firebaseProvider{client: client}, nil
+}
+
+func (f *firebaseProvider) CreateUser(ctx context.Context, user UserToCreate) (UserRecord, error) {
+	params := (&auth.UserToCreate{}).
+		Email(user.Email).
+		EmailVerified(user.EmailVerified).
+		Password(user.Password).
+		Disabled(user.Disabled)
+	if user.PhoneNumber != "" {
+		params = params.PhoneNumber(user.PhoneNumber)
+	}
+	if user.DisplayName != "" {
+		params = params.DisplayName(user.DisplayName)
+	}
+	record, err := f.client.CreateUser(ctx, params)
+	if err != nil {
+		return UserRecord{}, firebaseError(err)
+	}
+	return toUserRecord(record), nil
+}
+
+func (f *firebaseProvider) DeleteUser(ctx context.Context, uid string) error {
+	return firebaseError(f.client.DeleteUser(ctx, uid))
+}
+
+func (f *firebaseProvider) GetUser(ctx context.Context, uid string) (UserRecord, error) {
+	record, err := f.client.GetUser(ctx, uid)
+	if err != nil {
+		return UserRecord{}, firebaseError(err)
+	}
+	return toUserRecord(record), nil
+}
+
+func (f *firebaseProvider) UpdateUser(ctx context.Context, uid string, user UserToUpdate) (UserRecord, error) {
+	params := &auth.UserToUpdate{}
+	if user.Email != nil {
+		params = params.Email(*user.Email)
+	}
+	if user.EmailVerified != nil {
+		params = params.EmailVerified(*user.EmailVerified)
+	}
+	if user.PhoneNumber != nil {
+		// an empty phone number removes it from the Firebase user
+		params = params.PhoneNumber(*user.PhoneNumber)
+	}
+	if user.Password != nil {
+		params = params.Password(*user.Password)
+	}
+	if user.DisplayName != nil {
+		params = params.DisplayName(*user.DisplayName)
+	}
+	if user.Disabled != nil {
+		params = params.Disabled(*user.Disabled)
+	}
+	record, err := f.client.UpdateUser(ctx, uid, params)
+	if err != nil {
+		return UserRecord{}, firebaseError(err)
+	}
+	return toUserRecord(record), nil
+}
+
+func (f *firebaseProvider) VerifyIDToken(ctx context.Context, idToken string) (Token, error) {
+	token, err := f.client.VerifyIDToken(ctx, idToken)
+	if err != nil {
+		return Token{}, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	return Token{UID: token.UID, Claims: token.Claims}, nil
+}
+
+func (f *firebaseProvider) CustomTokenWithClaims(ctx context.Context, uid string, claims map[string]interface{}) (string, error) {
+	return f.client.CustomTokenWithClaims(ctx, uid, claims)
+}
+
+// firebaseError wraps the Firebase error codes the service reacts to into the provider errors
+func firebaseError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case auth.IsUserNotFound(err):
+		return fmt.Errorf("%w: %v", ErrUserNotFound, err)
+	case auth.IsEmailAlreadyExists(err):
+		return fmt.Errorf("%w: %v", ErrEmailAlreadyExists, err)
+	case auth.IsPhoneNumberAlreadyExists(err):
+		return fmt.Errorf("%w: %v", ErrPhoneAlreadyExists, err)
+	case auth.IsInvalidEmail(err):
+		return fmt.Errorf("%w: %v", ErrInvalidEmail, err)
+	}
+	return err
+}
+
+func toUserRecord(record *auth.UserRecord) UserRecord {
+	userRecord := UserRecord{
+		Disabled:      record.Disabled,
+		EmailVerified: record.EmailVerified,
+	}
+	if record.UserInfo != nil {
+		userRecord.UID = record.UID
+		userRecord.Email = record.Email
+		userRecord.PhoneNumber = record.PhoneNumber
+		userRecord.DisplayName = record.DisplayName
+	}
+	return userRecord
+}
@@ -0,0 +1,282 @@
+package provider
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/hex"
+	"firebaseAuth/apperror"
+	"firebaseAuth/utilities"
+	"fmt"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	memoryProjectID       = "firebase-auth-local"
+	memoryServiceAccount  = "local@firebase-auth-local.iam.gserviceaccount.com"
+	customTokenAudience   = "https://identitytoolkit.googleapis.com/google.identity.identitytoolkit.v1.IdentityToolkit"
+	idTokenIssuerPrefix   = "https://securetoken.google.com/"
+	customTokenExpiration = time.Hour
+	idTokenExpiration     = time.Hour
+)
+
+// reservedClaims are the claims a custom token cannot carry, same as Firebase
+var reservedClaims = []string{
+	"acr", "amr", "at_hash", "aud", "auth_time", "azp", "cnf", "c_hash",
+	"exp", "firebase", "iat", "iss", "jti", "nbf", "nonce", "sub",
+}
+
+// MemoryProvider is an in-process stand-in for Firebase Auth. Custom and ID tokens are real RS256 JWTs signed with
+// a key generated at start-up, so the register -> login -> authenticated route flow can run without credentials.
+type MemoryProvider struct {
+	mu         sync.RWMutex
+	users      map[string]UserRecord
+	privateKey *rsa.PrivateKey
+}
+
+func NewMemory() (*MemoryProvider, error) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	return &MemoryProvider{
+		users:      make(map[string]UserRecord),
+		privateKey: privateKey,
+	}, nil
+}
+
+func (m *MemoryProvider) CreateUser(ctx context.Context, user UserToCreate) (UserRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	email := strings.ToLower(user.Email)
+	for _, existing := range m.users {
+		if email != "" && existing.Email == email {
+			return UserRecord{}, ErrEmailAlreadyExists
+		}
+		if user.PhoneNumber != "" && existing.PhoneNumber == user.PhoneNumber {
+			return UserRecord{}, ErrPhoneAlreadyExists
+		}
+	}
+
+	uid, err := newUID()
+	if err != nil {
+		return UserRecord{}, err
+	}
+
+	record := UserRecord{
+		UID:           uid,
+		Email:         email,
+		EmailVerified: user.EmailVerified,
+		PhoneNumber:   user.PhoneNumber,
+		DisplayName:   user.DisplayName,
+		Disabled:      user.Disabled,
+	}
+	m.users[uid] = record
+	return record, nil
+}
+
+func (m *MemoryProvider) DeleteUser(ctx context.Context, uid string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[uid]; !ok {
+		return ErrUserNotFound
+	}
+	delete(m.users, uid)
+	return nil
+}
+
+func (m *MemoryProvider) GetUser(ctx context.Context, uid string) (UserRecord, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	user, ok := m.users[uid]
+	if !ok {
+		return UserRecord{}, ErrUserNotFound
+	}
+	return user, nil
+}
+
+func (m *MemoryProvider) UpdateUser(ctx context.Context, uid string, user UserToUpdate) (UserRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	record, ok := m.users[uid]
+	if !ok {
+		return UserRecord{}, ErrUserNotFound
+	}
+
+	if user.Email != nil {
+		email := strings.ToLower(*user.Email)
+		for otherUID, existing := range m.users {
+			if otherUID != uid && email != "" && existing.Email == email {
+				return UserRecord{}, ErrEmailAlreadyExists
+			}
+		}
+		record.Email = email
+	}
+	if user.PhoneNumber != nil {
+		for otherUID, existing := range m.users {
+			if otherUID != uid && *user.PhoneNumber != "" && existing.PhoneNumber == *user.PhoneNumber {
+				return UserRecord{}, ErrPhoneAlreadyExists
+			}
+		}
+		record.PhoneNumber = *user.PhoneNumber
+	}
+	if user.EmailVerified != nil {
+		record.EmailVerified = *user.EmailVerified
+	}
+	if user.DisplayName != nil {
+		record.DisplayName = *user.DisplayName
+	}
+	if user.Disabled != nil {
+		record.Disabled = *user.Disabled
+	}
+
+	m.users[uid] = record
+	return record, nil
+}
+
+// CustomTokenWithClaims mints a custom token shaped like the ones the Firebase Admin SDK signs
+func (m *MemoryProvider) CustomTokenWithClaims(ctx context.Context, uid string, claims map[string]interface{}) (string, error) {
+	for _, reserved := range reservedClaims {
+		if _, ok := claims[reserved]; ok {
+			return "", fmt.Errorf("provider: developer claim %q is reserved", reserved)
+		}
+	}
+
+	now := time.Now()
+	tokenClaims := jwt.MapClaims{
+		"iss": memoryServiceAccount,
+		"sub": memoryServiceAccount,
+		"aud": customTokenAudience,
+		"uid": uid,
+		"iat": now.Unix(),
+		"exp": now.Add(customTokenExpiration).Unix(),
+	}
+	if len(claims) > 0 {
+		tokenClaims["claims"] = claims
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodRS256, tokenClaims).SignedString(m.privateKey)
+}
+
+// SignInWithCustomToken plays the part of the Identity Toolkit exchange the client SDK performs after login,
+// it turns a custom token into an ID token that VerifyIDToken accepts.
+func (m *MemoryProvider) SignInWithCustomToken(ctx context.Context, customToken string) (string, error) {
+	claims, err := m.parse(customToken)
+	if err != nil {
+		return "", err
+	}
+	if claims["aud"] != customTokenAudience {
+		return "", ErrInvalidToken
+	}
+
+	uid, _ := claims["uid"].(string)
+	m.mu.RLock()
+	user, ok := m.users[uid]
+	m.mu.RUnlock()
+	if !ok {
+		return "", ErrUserNotFound
+	}
+	if user.Disabled {
+		return "", ErrInvalidToken
+	}
+
+	now := time.Now()
+	idTokenClaims := jwt.MapClaims{}
+	if developerClaims, ok := claims["claims"].(map[string]interface{}); ok {
+		for key, value := range developerClaims {
+			idTokenClaims[key] = value
+		}
+	}
+	idTokenClaims["iss"] = idTokenIssuerPrefix + memoryProjectID
+	idTokenClaims["aud"] = memoryProjectID
+	idTokenClaims["sub"] = uid
+	idTokenClaims["user_id"] = uid
+	idTokenClaims["auth_time"] = now.Unix()
+	idTokenClaims["iat"] = now.Unix()
+	idTokenClaims["exp"] = now.Add(idTokenExpiration).Unix()
+	idTokenClaims["email"] = user.Email
+	idTokenClaims["email_verified"] = user.EmailVerified
+	idTokenClaims["firebase"] = map[string]interface{}{"sign_in_provider": "custom"}
+	return jwt.NewWithClaims(jwt.SigningMethodRS256, idTokenClaims).SignedString(m.privateKey)
+}
+
+func (m *MemoryProvider) VerifyIDToken(ctx context.Context, idToken string) (Token, error) {
+	claims, err := m.parse(idToken)
+	if err != nil {
+		return Token{}, err
+	}
+	if claims["aud"] != memoryProjectID || claims["iss"] != idTokenIssuerPrefix+memoryProjectID {
+		return Token{}, ErrInvalidToken
+	}
+
+	uid, _ := claims["sub"].(string)
+	m.mu.RLock()
+	user, ok := m.users[uid]
+	m.mu.RUnlock()
+	if !ok || user.Disabled {
+		return Token{}, ErrInvalidToken
+	}
+
+	return Token{UID: uid, Claims: claims}, nil
+}
+
+// SignInWithCustomTokenHandler exposes SignInWithCustomToken over http with the request and response bodies of
+// the Identity Toolkit accounts:signInWithCustomToken endpoint, so a client can be pointed at it locally.
+func (m *MemoryProvider) SignInWithCustomTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Token string `json:"token"`
+	}
+	decoderErr := utilities.Decoder(r, &body)
+	if decoderErr != nil {
+		logrus.Printf("SignInWithCustomTokenHandler: Decoder error:%v", decoderErr)
+		utilities.RespondError(w, r, apperror.Wrap(decoderErr, apperror.CodeBadRequest, "request body is not valid json"))
+		return
+	}
+
+	idToken, err := m.SignInWithCustomToken(r.Context(), body.Token)
+	if err != nil {
+		logrus.Printf("SignInWithCustomTokenHandler: cannot exchange custom token:%v", err)
+		utilities.RespondError(w, r, err)
+		return
+	}
+
+	userOutboundData := map[string]interface{}{
+		"idToken":   idToken,
+		"expiresIn": fmt.Sprintf("%d", int(idTokenExpiration.Seconds())),
+	}
+	err = utilities.Encoder(w, userOutboundData)
+	if err != nil {
+		logrus.Printf("SignInWithCustomTokenHandler: encoding error:%v", err)
+		return
+	}
+}
+
+func (m *MemoryProvider) parse(tokenString string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, ErrInvalidToken
+		}
+		return &m.privateKey.PublicKey, nil
+	})
+	if err != nil || !token.Valid {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
+
+func newUID() (string, error) {
+	bytes := make([]byte, 14)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(bytes), nil
+}
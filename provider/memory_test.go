@@ -0,0 +1,127 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func newTestMemory(t *testing.T) *MemoryProvider {
+	t.Helper()
+	memory, err := NewMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return memory
+}
+
+func TestMemoryCreateUser(t *testing.T) {
+	ctx := context.Background()
+	memory := newTestMemory(t)
+
+	user, err := memory.CreateUser(ctx, UserToCreate{Email: "Someone@Example.com", PhoneNumber: "+15555550100", DisplayName: "Someone"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.UID == "" || user.Email != "someone@example.com" {
+		t.Errorf("CreateUser = %+v, want a uid and the lower case email", user)
+	}
+
+	tests := []struct {
+		name    string
+		user    UserToCreate
+		wantErr error
+	}{
+		{"same email in another case", UserToCreate{Email: "SOMEONE@example.com"}, ErrEmailAlreadyExists},
+		{"same phone number", UserToCreate{Email: "other@example.com", PhoneNumber: "+15555550100"}, ErrPhoneAlreadyExists},
+	}
+	for _, test := range tests {
+		if _, err := memory.CreateUser(ctx, test.user); !errors.Is(err, test.wantErr) {
+			t.Errorf("%s: CreateUser error = %v, want %v", test.name, err, test.wantErr)
+		}
+	}
+}
+
+func TestMemoryUpdateAndDeleteUser(t *testing.T) {
+	ctx := context.Background()
+	memory := newTestMemory(t)
+
+	first, _ := memory.CreateUser(ctx, UserToCreate{Email: "first@example.com"})
+	second, _ := memory.CreateUser(ctx, UserToCreate{Email: "second@example.com"})
+
+	taken := "FIRST@example.com"
+	if _, err := memory.UpdateUser(ctx, second.UID, UserToUpdate{Email: &taken}); !errors.Is(err, ErrEmailAlreadyExists) {
+		t.Errorf("UpdateUser to a taken email error = %v, want %v", err, ErrEmailAlreadyExists)
+	}
+
+	name, verified := "Second", true
+	updated, err := memory.UpdateUser(ctx, second.UID, UserToUpdate{DisplayName: &name, EmailVerified: &verified})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.DisplayName != name || !updated.EmailVerified || updated.Email != "second@example.com" {
+		t.Errorf("UpdateUser = %+v, want only the name and verification changed", updated)
+	}
+
+	if err := memory.DeleteUser(ctx, first.UID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := memory.GetUser(ctx, first.UID); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("GetUser of a deleted user error = %v, want %v", err, ErrUserNotFound)
+	}
+	if err := memory.DeleteUser(ctx, first.UID); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("second DeleteUser error = %v, want %v", err, ErrUserNotFound)
+	}
+}
+
+func TestMemoryTokens(t *testing.T) {
+	ctx := context.Background()
+	memory := newTestMemory(t)
+	user, _ := memory.CreateUser(ctx, UserToCreate{Email: "someone@example.com"})
+
+	customToken, err := memory.CustomTokenWithClaims(ctx, user.UID, map[string]interface{}{"sid": "session"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a custom token is not an ID token
+	if _, err := memory.VerifyIDToken(ctx, customToken); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("VerifyIDToken of a custom token error = %v, want %v", err, ErrInvalidToken)
+	}
+
+	idToken, err := memory.SignInWithCustomToken(ctx, customToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := memory.VerifyIDToken(ctx, idToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.UID != user.UID || token.Claims["sid"] != "session" || token.Claims["email"] != user.Email {
+		t.Errorf("VerifyIDToken = %+v, want the uid, email and developer claims", token)
+	}
+
+	// a token signed by another instance, like one from a restarted server, is refused
+	other := newTestMemory(t)
+	if _, err := other.VerifyIDToken(ctx, idToken); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("VerifyIDToken with another key error = %v, want %v", err, ErrInvalidToken)
+	}
+
+	disabled := true
+	if _, err := memory.UpdateUser(ctx, user.UID, UserToUpdate{Disabled: &disabled}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := memory.VerifyIDToken(ctx, idToken); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("VerifyIDToken of a disabled user error = %v, want %v", err, ErrInvalidToken)
+	}
+	if _, err := memory.SignInWithCustomToken(ctx, customToken); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("SignInWithCustomToken of a disabled user error = %v, want %v", err, ErrInvalidToken)
+	}
+}
+
+func TestMemoryReservedClaims(t *testing.T) {
+	memory := newTestMemory(t)
+	if _, err := memory.CustomTokenWithClaims(context.Background(), "uid", map[string]interface{}{"sub": "admin"}); err == nil {
+		t.Error("CustomTokenWithClaims accepted the reserved claim sub")
+	}
+}
@@ -0,0 +1,60 @@
+package provider
+
+import (
+	"context"
+	"firebaseAuth/apperror"
+)
+
+// errors every IdentityProvider reports, wrapped around the backend specific cause when there is one
+var (
+	ErrUserNotFound       = apperror.New(apperror.CodeNotFound, "user not found")
+	ErrEmailAlreadyExists = apperror.New(apperror.CodeConflict, "email already in use")
+	ErrPhoneAlreadyExists = apperror.New(apperror.CodeConflict, "phone number already in use")
+	ErrInvalidEmail       = apperror.New(apperror.CodeValidation, "invalid email")
+	ErrInvalidToken       = apperror.New(apperror.CodeUnauthorized, "invalid or expired token")
+)
+
+// IdentityProvider is the subset of an identity backend (Firebase Auth today) the service depends on.
+// It is built once at startup and handed to the handlers and the middleware.
+type IdentityProvider interface {
+	CreateUser(ctx context.Context, user UserToCreate) (UserRecord, error)
+	DeleteUser(ctx context.Context, uid string) error
+	GetUser(ctx context.Context, uid string) (UserRecord, error)
+	UpdateUser(ctx context.Context, uid string, user UserToUpdate) (UserRecord, error)
+	VerifyIDToken(ctx context.Context, idToken string) (Token, error)
+	CustomTokenWithClaims(ctx context.Context, uid string, claims map[string]interface{}) (string, error)
+}
+
+type UserToCreate struct {
+	Email         string
+	EmailVerified bool
+	PhoneNumber   string
+	Password      string
+	DisplayName   string
+	Disabled      bool
+}
+
+// UserToUpdate holds the fields to change, nil fields are left as they are
+type UserToUpdate struct {
+	Email         *string
+	EmailVerified *bool
+	PhoneNumber   *string
+	Password      *string
+	DisplayName   *string
+	Disabled      *bool
+}
+
+type UserRecord struct {
+	UID           string
+	Email         string
+	EmailVerified bool
+	PhoneNumber   string
+	DisplayName   string
+	Disabled      bool
+}
+
+// Token is a verified ID token, Claims holds every claim including the custom ones minted at login.
+type Token struct {
+	UID    string
+	Claims map[string]interface{}
+}
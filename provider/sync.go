@@ -0,0 +1,45 @@
+package provider
+
+import (
+	"firebaseAuth/models"
+	"strings"
+)
+
+// FromProfile is the provider side of a local profile, only the fields the service keeps in both stores
+func FromProfile(profile models.Profile) UserRecord {
+	return UserRecord{
+		UID:           profile.UID,
+		Email:         profile.Email,
+		EmailVerified: profile.EmailVerified,
+		PhoneNumber:   profile.Phone,
+		DisplayName:   profile.Name,
+	}
+}
+
+// Changes returns the update that turns current into want for email, its verification, display name and phone number, and whether
+// there is anything to update at all
+func Changes(current, want UserRecord) (UserToUpdate, bool) {
+	var update UserToUpdate
+	changed := false
+	if !strings.EqualFold(current.Email, want.Email) {
+		email := want.Email
+		update.Email = &email
+		changed = true
+	}
+	if current.EmailVerified != want.EmailVerified {
+		emailVerified := want.EmailVerified
+		update.EmailVerified = &emailVerified
+		changed = true
+	}
+	if current.DisplayName != want.DisplayName {
+		displayName := want.DisplayName
+		update.DisplayName = &displayName
+		changed = true
+	}
+	if current.PhoneNumber != want.PhoneNumber {
+		phoneNumber := want.PhoneNumber
+		update.PhoneNumber = &phoneNumber
+		changed = true
+	}
+	return update, changed
+}
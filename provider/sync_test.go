@@ -0,0 +1,89 @@
+package provider
+
+import "testing"
+
+func TestChanges(t *testing.T) {
+	current := UserRecord{
+		UID:           "uid",
+		Email:         "someone@example.com",
+		EmailVerified: true,
+		PhoneNumber:   "+15555550100",
+		DisplayName:   "Someone",
+	}
+
+	tests := []struct {
+		name        string
+		want        func(r UserRecord) UserRecord
+		wantChanged bool
+		check       func(t *testing.T, update UserToUpdate)
+	}{
+		{
+			name:        "nothing changed",
+			want:        func(r UserRecord) UserRecord { return r },
+			wantChanged: false,
+		},
+		{
+			name:        "email case is not a change",
+			want:        func(r UserRecord) UserRecord { r.Email = "Someone@Example.COM"; return r },
+			wantChanged: false,
+		},
+		{
+			name:        "fields the sync does not own are ignored",
+			want:        func(r UserRecord) UserRecord { r.UID = "other"; r.Disabled = true; return r },
+			wantChanged: false,
+		},
+		{
+			name:        "email",
+			want:        func(r UserRecord) UserRecord { r.Email = "new@example.com"; return r },
+			wantChanged: true,
+			check: func(t *testing.T, update UserToUpdate) {
+				if update.Email == nil || *update.Email != "new@example.com" {
+					t.Errorf("Email = %v, want new@example.com", update.Email)
+				}
+				if update.EmailVerified != nil || update.DisplayName != nil || update.PhoneNumber != nil {
+					t.Error("fields that did not change are in the update")
+				}
+			},
+		},
+		{
+			name:        "email verification revoked",
+			want:        func(r UserRecord) UserRecord { r.EmailVerified = false; return r },
+			wantChanged: true,
+			check: func(t *testing.T, update UserToUpdate) {
+				if update.EmailVerified == nil || *update.EmailVerified {
+					t.Errorf("EmailVerified = %v, want false", update.EmailVerified)
+				}
+			},
+		},
+		{
+			name:        "display name and phone cleared",
+			want:        func(r UserRecord) UserRecord { r.DisplayName = ""; r.PhoneNumber = ""; return r },
+			wantChanged: true,
+			check: func(t *testing.T, update UserToUpdate) {
+				if update.DisplayName == nil || *update.DisplayName != "" {
+					t.Errorf("DisplayName = %v, want empty", update.DisplayName)
+				}
+				if update.PhoneNumber == nil || *update.PhoneNumber != "" {
+					t.Errorf("PhoneNumber = %v, want empty", update.PhoneNumber)
+				}
+				if update.Email != nil || update.Password != nil || update.Disabled != nil {
+					t.Error("fields that did not change are in the update")
+				}
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			update, changed := Changes(current, test.want(current))
+			if changed != test.wantChanged {
+				t.Fatalf("changed = %v, want %v", changed, test.wantChanged)
+			}
+			if !changed && update != (UserToUpdate{}) {
+				t.Errorf("update = %+v, want none", update)
+			}
+			if test.check != nil {
+				test.check(t, update)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+// Package secrets encrypts the small secrets stored in the database, e.g. TOTP keys, with AES-256-GCM
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+// KeySize is the length of the key NewBox takes, 32 bytes for AES-256
+const KeySize = 32
+
+// sealedPrefix marks a sealed value and the format it is in
+const sealedPrefix = "v1:"
+
+var errMalformed = errors.New("secrets: sealed value is malformed")
+
+// macLabel derives the MAC key of a Box from its key, so one configured key is not used for two algorithms
+const macLabel = "secrets: mac key"
+
+// Box seals and opens values with one key, and hashes the ones that only have to be recognised with MAC
+type Box struct {
+	aead   cipher.AEAD
+	macKey []byte
+}
+
+func NewBox(key []byte) (*Box, error) {
+	if len(key) != KeySize {
+		return nil, errors.New("secrets: key must be 32 bytes")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Box{aead: aead, macKey: hmacSHA256(key, macLabel)}, nil
+}
+
+// DecodeKey reads a base64 key as it is configured
+func DecodeKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, errors.New("secrets: key is not base64")
+	}
+	if len(key) != KeySize {
+		return nil, errors.New("secrets: key must be 32 bytes")
+	}
+	return key, nil
+}
+
+// Seal encrypts plaintext under a fresh random nonce
+func (b *Box) Seal(plaintext string) (string, error) {
+	nonce := make([]byte, b.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := b.aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return sealedPrefix + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Open decrypts what Seal returned
+func (b *Box) Open(value string) (string, error) {
+	if !strings.HasPrefix(value, sealedPrefix) {
+		return "", errMalformed
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(strings.TrimPrefix(value, sealedPrefix))
+	if err != nil || len(sealed) < b.aead.NonceSize() {
+		return "", errMalformed
+	}
+	nonce, ciphertext := sealed[:b.aead.NonceSize()], sealed[b.aead.NonceSize():]
+	plaintext, err := b.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// MAC is the hex HMAC-SHA256 of value under the key of the box, see the MAC function
+func (b *Box) MAC(value string) string {
+	return MAC(b.macKey, value)
+}
+
+// MAC is the hex HMAC-SHA256 of value under key, a lookup hash that cannot be reversed without the key
+func MAC(key []byte, value string) string {
+	return hex.EncodeToString(hmacSHA256(key, value))
+}
+
+func hmacSHA256(key []byte, value string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(value))
+	return mac.Sum(nil)
+}
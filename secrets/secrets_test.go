@@ -0,0 +1,85 @@
+package secrets
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func testBox(t *testing.T, fill byte) *Box {
+	t.Helper()
+	box, err := NewBox(bytes.Repeat([]byte{fill}, KeySize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return box
+}
+
+func TestSealOpen(t *testing.T) {
+	box := testBox(t, 1)
+
+	sealed, err := box.Seal("JBSWY3DPEHPK3PXP")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(sealed, sealedPrefix) || strings.Contains(sealed, "JBSWY3DPEHPK3PXP") {
+		t.Fatalf("sealed = %q, want the prefixed ciphertext", sealed)
+	}
+	again, err := box.Seal("JBSWY3DPEHPK3PXP")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again == sealed {
+		t.Error("sealing twice gave the same value, want a fresh nonce each time")
+	}
+
+	opened, err := box.Open(sealed)
+	if err != nil || opened != "JBSWY3DPEHPK3PXP" {
+		t.Fatalf("Open = %q, %v, want the plaintext", opened, err)
+	}
+	if _, err := testBox(t, 2).Open(sealed); err == nil {
+		t.Error("Open with another key succeeded")
+	}
+}
+
+func TestOpenMalformed(t *testing.T) {
+	box := testBox(t, 1)
+	sealed, err := box.Seal("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, value := range []string{"", "JBSWY3DPEHPK3PXP", "v1:", "v1:not base64!", sealedPrefix + "AAAA", sealed[:len(sealed)-2]} {
+		if _, err := box.Open(value); err == nil {
+			t.Errorf("Open(%q) succeeded, want an error", value)
+		}
+	}
+}
+
+func TestMAC(t *testing.T) {
+	box := testBox(t, 1)
+
+	if box.MAC("code") != box.MAC("code") {
+		t.Error("MAC is not deterministic")
+	}
+	if box.MAC("code") == box.MAC("other") {
+		t.Error("MAC of different values is equal")
+	}
+	if box.MAC("code") == testBox(t, 2).MAC("code") {
+		t.Error("MAC does not depend on the key")
+	}
+	if box.MAC("code") == MAC(bytes.Repeat([]byte{1}, KeySize), "code") {
+		t.Error("Box.MAC uses the encryption key itself, want the derived MAC key")
+	}
+}
+
+func TestDecodeKey(t *testing.T) {
+	if _, err := DecodeKey(" MDEyMzQ1Njc4OTAxMjM0NTY3ODkwMTIzNDU2Nzg5MDE=\n"); err != nil {
+		t.Errorf("DecodeKey of a 32 byte key: %v", err)
+	}
+	for _, encoded := range []string{"", "not base64", "MDEyMzQ1Njc4OTAx"} {
+		if _, err := DecodeKey(encoded); err == nil {
+			t.Errorf("DecodeKey(%q) succeeded, want an error", encoded)
+		}
+	}
+}
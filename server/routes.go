@@ -1,37 +1,139 @@
 package server
 
 import (
+	"context"
+	"firebaseAuth/audit"
+	"firebaseAuth/config"
 	"firebaseAuth/handler"
+	"firebaseAuth/lockout"
+	"firebaseAuth/mailer"
 	"firebaseAuth/middleware"
+	"firebaseAuth/models"
+	"firebaseAuth/provider"
 	"github.com/go-chi/chi/v5"
+	chimiddleware "github.com/go-chi/chi/v5/middleware"
 	"net/http"
+	"time"
 )
 
+const shutdownTimeout = 10 * time.Second
+
 type Server struct {
 	chi.Router
+	handler *handler.Handler
 }
 
-func SetupRoutes() *Server {
+func SetupRoutes(cfg config.Config, identityProvider provider.IdentityProvider, mail mailer.Mailer, guard *lockout.Guard, recorder *audit.Recorder) *Server {
+	h := handler.NewHandler(cfg, identityProvider, mail, guard, recorder)
+	// already checked by config.Validate
+	trustedProxies, _ := cfg.Server.TrustedProxyNets()
 	router := chi.NewRouter()
+	router.Use(chimiddleware.RequestID)
+	router.Use(middleware.ClientIP(trustedProxies))
+	// one per ip limiter in front of Auth for both authenticated groups, a bad token costs a verification and a lookup
+	authenticatedLimiter := middleware.NewRateLimiter(cfg.RateLimit.Authenticated)
 	router.Route("/", func(home chi.Router) {
-		home.Post("/register", handler.Register)
-		home.Post("/login", handler.Login)
+		home.Group(func(public chi.Router) {
+			public.Use(middleware.RateLimit(middleware.NewRateLimiter(cfg.RateLimit.Public)))
+			public.Post("/register", h.Register)
+			public.Post("/login", h.Login)
+			public.Post("/login/mfa", h.LoginMFA)
+			public.Post("/token/refresh", h.RefreshToken)
+			public.Post("/password/forgot", h.ForgotPassword)
+			public.Post("/password/reset", h.ResetPassword)
+			public.Get("/verify-email", h.VerifyEmail)
+			public.Post("/verify-email/resend", h.ResendVerification)
+		})
 		home.Route("/user", func(user chi.Router) {
-			user.Use(middleware.Auth)
-			user.Get("/friends", handler.GetFriendList)
-			user.Put("/", handler.UpdateUserInfo)
-			user.Get("/", handler.GetUsers)
-			user.Put("/logout", handler.Logout)
-			user.Route("/friend-request", func(request chi.Router) {
-				request.Post("/", handler.SendFriendRequest)
-				request.Get("/", handler.SeeFriendRequests)
-				request.Put("/", handler.UpdateFriendRequestStatus)
+			user.Use(middleware.RateLimit(authenticatedLimiter))
+			user.Use(middleware.Auth(identityProvider, cfg.Session))
+			// limited after Auth so the bucket belongs to the user and not to a shared ip
+			user.Use(middleware.RateLimit(middleware.NewRateLimiter(cfg.RateLimit.User)))
+			user.Patch("/", h.UpdateProfile)
+			// PUT is kept for older clients and has the same partial update semantics as PATCH
+			user.Put("/", h.UpdateProfile)
+			user.Delete("/", h.DeactivateAccount)
+			user.Delete("/erase", h.EraseAccount)
+			user.Route("/export", func(exports chi.Router) {
+				exports.Get("/", h.ExportData)
+				exports.Get("/jobs/{id}", h.GetExportJob)
+				exports.Get("/jobs/{id}/download", h.DownloadExport)
+			})
+			user.Put("/email", h.ChangeEmail)
+			user.Put("/password", h.ChangePassword)
+			user.Put("/logout", h.Logout)
+			user.Route("/mfa/totp", func(mfa chi.Router) {
+				mfa.Post("/", h.EnrollTOTP)
+				mfa.Post("/confirm", h.ConfirmTOTP)
+				mfa.Delete("/", h.DisableTOTP)
+			})
+			user.Route("/sessions", func(sessions chi.Router) {
+				sessions.Get("/", h.GetSessions)
+				sessions.Delete("/", h.LogoutOtherSessions)
+				sessions.Delete("/{sessionId}", h.RevokeSession)
+			})
+			// the social routes need a verified email, the account routes above stay open to fix a wrong address
+			user.Group(func(verified chi.Router) {
+				verified.Use(middleware.RequireVerifiedEmail(cfg.Verification.Policy))
+				verified.Get("/friends", h.GetFriendList)
+				verified.Delete("/friends/{id}", h.Unfriend)
+				verified.Get("/", h.GetUsers)
+				verified.Route("/blocks", func(blocks chi.Router) {
+					blocks.Get("/", h.GetBlockedUsers)
+					blocks.Post("/{id}", h.BlockUser)
+					blocks.Delete("/{id}", h.UnblockUser)
+				})
+				verified.Route("/friend-request", func(request chi.Router) {
+					request.Post("/", h.SendFriendRequest)
+					request.Get("/", h.SeeFriendRequests)
+					request.Put("/", h.UpdateFriendRequestStatus)
+					request.Delete("/{id}", h.CancelFriendRequest)
+				})
+			})
+		})
+		home.Route("/admin", func(admin chi.Router) {
+			admin.Use(middleware.RateLimit(authenticatedLimiter))
+			admin.Use(middleware.Auth(identityProvider, cfg.Session))
+			admin.Use(middleware.RequireRole(models.RoleModerator))
+			admin.Use(middleware.RateLimit(middleware.NewRateLimiter(cfg.RateLimit.User)))
+			// moderators can read the audit log and look users up, everything that changes something is for admins
+			admin.Get("/audit", h.GetAuditLog)
+			admin.Get("/users", h.ListUsers)
+			admin.Get("/users/{id}", h.GetUserDetails)
+			admin.Group(func(admins chi.Router) {
+				admins.Use(middleware.RequireRole(models.RoleAdmin))
+				admins.Delete("/lockouts", h.ClearLockout)
+				admins.Get("/erasures", h.GetErasures)
+				admins.Delete("/users/{id}", h.EraseUser)
+				admins.Put("/users/{id}/role", h.SetUserRole)
+				admins.Put("/users/{id}/disable", h.DisableUser)
+				admins.Put("/users/{id}/enable", h.EnableUser)
+				admins.Delete("/users/{id}/sessions", h.ForceLogout)
+				admins.Post("/users/{id}/password-reset", h.TriggerPasswordReset)
 			})
 		})
 	})
-	return &Server{router}
+	return &Server{Router: router, handler: h}
 }
 
-func (svc *Server) Run(port string) error {
-	return http.ListenAndServe(port, svc)
+// Run serves until ctx is cancelled and then waits up to shutdownTimeout for in-flight requests, then for the emails
+// they left to send in the background, each bounded by its own timeout
+func (svc *Server) Run(ctx context.Context, addr string) error {
+	httpServer := &http.Server{Addr: addr, Handler: svc}
+
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- httpServer.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errChan:
+		return err
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		err := httpServer.Shutdown(shutdownCtx)
+		svc.handler.WaitBackground()
+		return err
+	}
 }
@@ -0,0 +1,229 @@
+package server
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"firebaseAuth/audit"
+	"firebaseAuth/config"
+	"firebaseAuth/database"
+	"firebaseAuth/lockout"
+	"firebaseAuth/mailer"
+	"firebaseAuth/models"
+	"firebaseAuth/provider"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"golang.org/x/crypto/bcrypt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// testKey is base64 of 32 bytes, what mfa_secret_key and account_erasure_key expect
+const testKey = "MDEyMzQ1Njc4OTAxMjM0NTY3ODkwMTIzNDU2Nzg5MDE="
+
+// newTestServer wires the routes the way main does, with the in-memory identity provider and lockout store
+func newTestServer(t *testing.T) *Server {
+	t.Helper()
+	cfg := config.Default()
+	cfg.Identity.Provider = config.IdentityProviderMemory
+	cfg.MFA.SecretKey = testKey
+	cfg.Account.ErasureKey = testKey
+	cfg.Lockout.Store = config.LockoutStoreMemory
+
+	memoryProvider, err := provider.NewMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mail, err := mailer.New(cfg.Mail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	guard := lockout.NewGuard(lockout.NewMemory(), cfg.Lockout)
+
+	srv := SetupRoutes(cfg, memoryProvider, mail, guard, audit.NewRecorder())
+	srv.Post("/identitytoolkit.googleapis.com/v1/accounts:signInWithCustomToken", memoryProvider.SignInWithCustomTokenHandler)
+	return srv
+}
+
+// call sends body as json with the given headers and decodes the response into out unless it is nil
+func call(t *testing.T, srv *Server, method, path string, body interface{}, headers map[string]string, out interface{}) int {
+	t.Helper()
+	var payload bytes.Buffer
+	if body != nil {
+		if raw, ok := body.(string); ok {
+			payload.WriteString(raw)
+		} else if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r := httptest.NewRequest(method, path, &payload)
+	r.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		r.Header.Set(key, value)
+	}
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, r)
+
+	if out != nil {
+		if err := json.NewDecoder(w.Body).Decode(out); err != nil {
+			t.Fatalf("%s %s: cannot decode %d response: %v", method, path, w.Code, err)
+		}
+	}
+	return w.Code
+}
+
+// These requests are answered before any query runs, so they need no database
+func TestRoutesWithoutDatabase(t *testing.T) {
+	srv := newTestServer(t)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       interface{}
+		headers    map[string]string
+		wantStatus int
+	}{
+		{"register with a broken body", http.MethodPost, "/register", "{", nil, http.StatusBadRequest},
+		{"register without a password", http.MethodPost, "/register", map[string]string{"name": "Someone", "email": "someone@example.com"}, nil, http.StatusUnprocessableEntity},
+		{"register with a bad email", http.MethodPost, "/register", map[string]string{"name": "Someone", "email": "someone", "password": "Passw0rd!"}, nil, http.StatusUnprocessableEntity},
+		{"login without a password", http.MethodPost, "/login", map[string]string{"email": "someone@example.com"}, nil, http.StatusUnprocessableEntity},
+		{"user route without a token", http.MethodGet, "/user/sessions", nil, nil, http.StatusUnauthorized},
+		{"user route with a forged token", http.MethodGet, "/user/sessions", nil, map[string]string{"token": "not.a.jwt"}, http.StatusUnauthorized},
+		{"admin route without a token", http.MethodGet, "/admin/audit", nil, nil, http.StatusUnauthorized},
+		{"exchange of a forged custom token", http.MethodPost, "/identitytoolkit.googleapis.com/v1/accounts:signInWithCustomToken", map[string]string{"token": "not.a.jwt"}, nil, http.StatusUnauthorized},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var envelope map[string]interface{}
+			status := call(t, srv, test.method, test.path, test.body, test.headers, &envelope)
+			if status != test.wantStatus {
+				t.Errorf("status = %d, want %d, body %v", status, test.wantStatus, envelope)
+			}
+		})
+	}
+}
+
+// capture is a sqlmock argument that matches any value and keeps it, for the ids the handlers generate
+type capture struct {
+	value string
+}
+
+func (c *capture) Match(value driver.Value) bool {
+	switch v := value.(type) {
+	case string:
+		c.value = v
+	case []byte:
+		c.value = string(v)
+	}
+	return true
+}
+
+// mockDatabase points database.FirebaseDB at a sqlmock until the test ends and fails it on unmet expectations
+func mockDatabase(t *testing.T) sqlmock.Sqlmock {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := database.FirebaseDB
+	database.FirebaseDB = sqlx.NewDb(db, "postgres")
+	t.Cleanup(func() {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+		database.FirebaseDB = previous
+		db.Close()
+	})
+	return mock
+}
+
+// TestRegisterLoginFlow walks a new user through register, login, the custom token exchange of the memory
+// provider and an authenticated route, with the queries answered by sqlmock
+func TestRegisterLoginFlow(t *testing.T) {
+	mock := mockDatabase(t)
+	srv := newTestServer(t)
+
+	const userID, email, password = 42, "someone@example.com", "Passw0rd!"
+
+	uid := &capture{}
+	mock.ExpectQuery(`INSERT INTO users`).
+		WithArgs("Someone", email, sqlmock.AnyArg(), "", 0, "", uid).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(userID))
+	mock.ExpectExec(`INSERT INTO audit_log`).
+		WithArgs(audit.EventRegister, userID, userID, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT email`).WithArgs(userID).
+		WillReturnRows(sqlmock.NewRows([]string{"email", "email_verified"}).AddRow(email, false))
+	mock.ExpectExec(`UPDATE email_verifications`).WithArgs(userID).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`INSERT INTO email_verifications`).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	var registered map[string]int
+	status := call(t, srv, http.MethodPost, "/register", map[string]string{"name": "Someone", "email": "Someone@Example.com", "password": password}, nil, &registered)
+	if status != http.StatusOK {
+		t.Fatalf("register status = %d, want %d", status, http.StatusOK)
+	}
+	if uid.value == "" {
+		t.Fatal("register did not store the uid of the provider user")
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	credentials := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"id", "password", "email_verified", "disabled", "role"}).
+			AddRow(userID, string(hash), false, false, models.RoleUser)
+	}
+
+	sessionID := &capture{}
+	mock.ExpectQuery(`FROM\s+users\s+WHERE\s+email=\$1`).WithArgs(email).WillReturnRows(credentials())
+	mock.ExpectQuery(`FROM\s+user_mfa`).WithArgs(userID).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectQuery(`SELECT id,\s+email`).WithArgs(userID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "user_uid", "role"}).AddRow(userID, email, uid.value, models.RoleUser))
+	mock.ExpectExec(`INSERT INTO sessions`).
+		WithArgs(userID, sessionID, "laptop", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`INSERT INTO refresh_tokens`).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`INSERT INTO audit_log`).
+		WithArgs(audit.EventLoginSucceeded, userID, userID, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	var login struct {
+		Token        string `json:"token"`
+		RefreshToken string `json:"refreshToken"`
+	}
+	status = call(t, srv, http.MethodPost, "/login", map[string]string{"email": email, "password": password, "deviceName": "laptop"}, nil, &login)
+	if status != http.StatusOK || login.Token == "" || login.RefreshToken == "" {
+		t.Fatalf("login status = %d with token %q, want %d and both tokens", status, login.Token, http.StatusOK)
+	}
+
+	var signIn struct {
+		IDToken string `json:"idToken"`
+	}
+	status = call(t, srv, http.MethodPost, "/identitytoolkit.googleapis.com/v1/accounts:signInWithCustomToken", map[string]string{"token": login.Token}, nil, &signIn)
+	if status != http.StatusOK || signIn.IDToken == "" {
+		t.Fatalf("custom token exchange status = %d, want %d and an id token", status, http.StatusOK)
+	}
+
+	now := time.Now()
+	mock.ExpectQuery(`FROM\s+users\s+WHERE\s+email=\$1`).WithArgs(email).WillReturnRows(credentials())
+	mock.ExpectQuery(`UPDATE sessions`).WithArgs(sessionID.value, userID, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectQuery(`FROM\s+sessions`).WithArgs(userID, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"session_uid", "device_name", "ip_address", "user_agent", "created_at", "updated_at", "expires_at"}).
+			AddRow(sessionID.value, "laptop", "192.0.2.1", "", now, now, now.Add(time.Hour)))
+
+	var sessions []models.Session
+	status = call(t, srv, http.MethodGet, "/user/sessions", nil, map[string]string{"token": signIn.IDToken}, &sessions)
+	if status != http.StatusOK {
+		t.Fatalf("sessions status = %d, want %d", status, http.StatusOK)
+	}
+	if len(sessions) != 1 || !sessions[0].Current {
+		t.Errorf("sessions = %+v, want the one of this login marked current", sessions)
+	}
+}
@@ -0,0 +1,91 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA1 seed of RFC 6238 appendix B, "12345678901234567890" base32 encoded
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// The RFC lists 8 digit codes, a 6 digit code is the same value truncated to its last 6 digits
+func TestCodeRFC6238(t *testing.T) {
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, test := range tests {
+		code, err := Code(rfcSecret, Step(time.Unix(test.unix, 0)))
+		if err != nil {
+			t.Fatalf("Code at %d: %v", test.unix, err)
+		}
+		if code != test.code {
+			t.Errorf("Code at %d = %s, want %s", test.unix, code, test.code)
+		}
+	}
+}
+
+func TestValidateSkew(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := Step(now)
+	codeAt := func(step int64) string {
+		code, err := Code(rfcSecret, step)
+		if err != nil {
+			t.Fatalf("Code at step %d: %v", step, err)
+		}
+		return code
+	}
+
+	tests := []struct {
+		name     string
+		code     string
+		skew     int64
+		wantStep int64
+		wantOK   bool
+	}{
+		{"current step", codeAt(current), 0, current, true},
+		{"previous step without skew", codeAt(current - 1), 0, 0, false},
+		{"previous step within skew", codeAt(current - 1), 1, current - 1, true},
+		{"next step within skew", codeAt(current + 1), 1, current + 1, true},
+		{"two steps ahead outside skew", codeAt(current + 2), 1, 0, false},
+		{"wrong code", "000000", 1, 0, false},
+		{"too short", codeAt(current)[:5], 1, 0, false},
+		{"too long", codeAt(current) + "0", 1, 0, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			step, ok := Validate(rfcSecret, test.code, now, test.skew)
+			if ok != test.wantOK || step != test.wantStep {
+				t.Errorf("Validate = (%d, %v), want (%d, %v)", step, ok, test.wantStep, test.wantOK)
+			}
+		})
+	}
+}
+
+func TestCodeLowerCaseSecret(t *testing.T) {
+	upper, err := Code(rfcSecret, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lower, err := Code(strings.ToLower(rfcSecret), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if upper != lower {
+		t.Errorf("Code of the lower case secret = %s, want %s", lower, upper)
+	}
+}
+
+func TestValidateBadSecret(t *testing.T) {
+	if _, ok := Validate("not base32!", "123456", time.Now(), 1); ok {
+		t.Error("Validate accepted a code for a secret that is not base32")
+	}
+}
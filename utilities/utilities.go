@@ -1,18 +1,28 @@
 package utilities
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"firebaseAuth/apperror"
+	"firebaseAuth/models"
+	"github.com/go-chi/chi/v5/middleware"
 	"github.com/sirupsen/logrus"
+	"net"
 	"net/http"
+	"strings"
 )
 
 type Key string
 
 const (
-	UserContextKey Key    = "values"
-	Pending        string = "pending"
-	Accepted       string = "accepted"
-	Rejected       string = "rejected"
+	UserContextKey     Key    = "values"
+	ClientIPContextKey Key    = "clientIP"
+	Pending            string = "pending"
+	Accepted           string = "accepted"
+	Rejected           string = "rejected"
 )
 
 func Decoder(r *http.Request, inter interface{}) error {
@@ -33,3 +43,97 @@ func Encoder(w http.ResponseWriter, inter interface{}) error {
 	}
 	return nil
 }
+
+// GenerateToken returns a url safe random string built from size random bytes
+func GenerateToken(size int) (string, error) {
+	bytes := make([]byte, size)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(bytes), nil
+}
+
+// ClientIP is the address middleware.ClientIP resolved for r, the socket address when it did not run
+func ClientIP(r *http.Request) string {
+	if clientIP, ok := r.Context().Value(ClientIPContextKey).(string); ok {
+		return clientIP
+	}
+	return remoteHost(r)
+}
+
+// ResolveClientIP returns the socket address of r unless it is one of the trusted proxies. Then it walks
+// X-Forwarded-For from the right, past the trusted proxies, and returns the first hop it does not trust: everything
+// left of that was written by the client and proves nothing.
+func ResolveClientIP(r *http.Request, trusted []*net.IPNet) string {
+	peer := remoteHost(r)
+	if !isTrusted(peer, trusted) {
+		return peer
+	}
+
+	hops := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if net.ParseIP(hop) == nil {
+			// a garbled hop cannot be traced further, the last good one is the best we know
+			return peer
+		}
+		if !isTrusted(hop, trusted) {
+			return hop
+		}
+		peer = hop
+	}
+	return peer
+}
+
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func isTrusted(address string, trusted []*net.IPNet) bool {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range trusted {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// HashToken is how opaque tokens are stored, only the sha256 of a token ever reaches the database
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// RespondError writes err as the json error envelope with the status its apperror code maps to
+func RespondError(w http.ResponseWriter, r *http.Request, err error) {
+	appErr := apperror.From(err)
+	status := appErr.Status()
+	if status >= http.StatusInternalServerError {
+		logrus.Errorf("%s %s: %v", r.Method, r.URL.Path, err)
+	}
+
+	requestID := middleware.GetReqID(r.Context())
+	if requestID != "" {
+		w.Header().Set(middleware.RequestIDHeader, requestID)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	errorResponse := models.ErrorResponse{
+		Code:      string(appErr.Code),
+		Message:   appErr.Message,
+		Details:   appErr.Details,
+		RequestID: requestID,
+	}
+	if encodeErr := json.NewEncoder(w).Encode(errorResponse); encodeErr != nil {
+		logrus.Printf("RespondError: encoder error:%v", encodeErr)
+	}
+}
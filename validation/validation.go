@@ -0,0 +1,117 @@
+package validation
+
+import (
+	"errors"
+	"firebaseAuth/apperror"
+	"fmt"
+	"github.com/go-playground/validator/v10"
+	"reflect"
+	"strings"
+	"unicode"
+)
+
+const (
+	passwordMinLength = 8
+	// bcrypt ignores everything after the 72nd byte
+	passwordMaxLength = 72
+)
+
+// FieldError is one entry of the details of a validation_failed error
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+var validate = newValidator()
+
+func newValidator() *validator.Validate {
+	v := validator.New()
+	// report fields under the name the client sent them with
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+		if name == "-" || name == "" {
+			return field.Name
+		}
+		return name
+	})
+	if err := v.RegisterValidation("password", password); err != nil {
+		panic(err)
+	}
+	return v
+}
+
+// Struct checks the validate tags of s and returns a validation_failed error listing every failing field
+func Struct(s interface{}) error {
+	err := validate.Struct(s)
+	if err == nil {
+		return nil
+	}
+
+	var validationErrors validator.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		return err
+	}
+
+	fieldErrors := make([]FieldError, 0, len(validationErrors))
+	for _, fieldErr := range validationErrors {
+		fieldErrors = append(fieldErrors, FieldError{
+			Field:   fieldErr.Field(),
+			Rule:    fieldErr.Tag(),
+			Message: message(fieldErr),
+		})
+	}
+	return apperror.Wrap(err, apperror.CodeValidation, "request validation failed").WithDetails(fieldErrors)
+}
+
+func message(fieldErr validator.FieldError) string {
+	switch fieldErr.Tag() {
+	case "required":
+		return "is required"
+	case "email":
+		return "must be a valid email address"
+	case "e164":
+		return "must be an E.164 phone number such as +14155552671"
+	case "oneof":
+		return "must be one of: " + strings.Join(strings.Fields(fieldErr.Param()), ", ")
+	case "min", "gte":
+		if fieldErr.Kind() == reflect.String {
+			return fmt.Sprintf("must be at least %s characters", fieldErr.Param())
+		}
+		return "must be at least " + fieldErr.Param()
+	case "max", "lte":
+		if fieldErr.Kind() == reflect.String {
+			return fmt.Sprintf("must be at most %s characters", fieldErr.Param())
+		}
+		return "must be at most " + fieldErr.Param()
+	case "gt":
+		return "must be greater than " + fieldErr.Param()
+	case "nefield":
+		// the param is the go name of the other field, the client knows it by its json name
+		return "must be different from " + strings.ToLower(fieldErr.Param()[:1]) + fieldErr.Param()[1:]
+	case "isdefault":
+		return "cannot be changed through this endpoint"
+	case "password":
+		return fmt.Sprintf("must be %d to %d characters and contain a letter and a digit", passwordMinLength, passwordMaxLength)
+	}
+	return "is invalid"
+}
+
+// password is the password policy shared by registration and every later password change
+func password(fl validator.FieldLevel) bool {
+	value := fl.Field().String()
+	if len(value) < passwordMinLength || len(value) > passwordMaxLength {
+		return false
+	}
+
+	var hasLetter, hasDigit bool
+	for _, r := range value {
+		switch {
+		case unicode.IsLetter(r):
+			hasLetter = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		}
+	}
+	return hasLetter && hasDigit
+}